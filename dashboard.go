@@ -0,0 +1,271 @@
+package prom
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultDashboardTitle       = "prom metrics"
+	defaultDashboardLatestCmds  = 100
+	maxDashboardLatestCmds      = 1000
+	dashboardApiConnectionsPath = "/api/connections"
+	dashboardApiCommandsPath    = "/api/commands"
+)
+
+// NewDashboardHandler creates a new DashboardHandler instance.
+//   - title: title of the HTML page. If empty, a default title is used.
+//
+// @Available since <<VERSION>>
+func NewDashboardHandler(title string) *DashboardHandler {
+	if strings.TrimSpace(title) == "" {
+		title = defaultDashboardTitle
+	}
+	return &DashboardHandler{title: title}
+}
+
+// DashboardHandler is an http.Handler serving a self-contained HTML page that shows metrics of all categories of
+// registered connections, with a drill-down table of the latest commands of each category.
+//
+// The page is backed by a JSON API, relative to the path the handler is mounted at:
+//   - GET api/connections: metrics of all categories of all connections,
+//     {"connections": [{"name": <name>, "metrics": [<Metrics>, ...]}, ...]}
+//   - GET api/commands?conn=<name>&cat=<category>&n=<number>: metrics of a category, including the latest n commands
+//     (default 100, max 1000), {"conn": <name>, "metrics": <Metrics>}
+//
+// Mount the handler at a path ending with a slash, e.g.
+//
+//	http.Handle("/debug/prom/", http.StripPrefix("/debug/prom", prom.NewDashboardHandler("").AddConnection("main", conn)))
+//
+// Note: commands' requests (e.g. SQL queries and their parameters) are exposed as-is, the handler should be mounted
+// behind proper access control.
+//
+// @Available since <<VERSION>>
+type DashboardHandler struct {
+	metricsSources
+	title string
+}
+
+// DashboardConnection is an entry of the response of the api/connections endpoint.
+//
+// @Available since <<VERSION>>
+type DashboardConnection struct {
+	Name    string     `json:"name"`
+	Metrics []*Metrics `json:"metrics"`
+}
+
+// Title returns the title of the HTML page.
+func (d *DashboardHandler) Title() string {
+	return d.title
+}
+
+// AddLogger registers a metrics logger with the dashboard.
+//   - name: name of the connection shown on the dashboard.
+//   - categories: metrics categories to show. If empty, categories are discovered via IMetricsCategoryLister if the
+//     logger implements it, otherwise the common categories (MetricsCatAll, MetricsCatDDL, etc.) are shown.
+//
+// This function returns the dashboard itself for chaining.
+func (d *DashboardHandler) AddLogger(name string, logger IMetricsLogger, categories ...string) *DashboardHandler {
+	d.addSource(name, func() IMetricsLogger { return logger }, categories)
+	return d
+}
+
+// AddConnection is similar to AddLogger, but the metrics logger is obtained from the connection at every request.
+//
+// This function returns the dashboard itself for chaining.
+func (d *DashboardHandler) AddConnection(name string, conn IBaseConnection, categories ...string) *DashboardHandler {
+	d.addSource(name, conn.MetricsLogger, categories)
+	return d
+}
+
+// ServeHTTP implements http.Handler.
+func (d *DashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	path := r.URL.Path
+	switch {
+	case strings.HasSuffix(path, dashboardApiConnectionsPath):
+		d.serveConnections(w)
+	case strings.HasSuffix(path, dashboardApiCommandsPath):
+		d.serveCommands(w, r)
+	case strings.HasSuffix(path, "/"):
+		d.servePage(w)
+	default:
+		// the page uses relative URLs to reach the API, hence it must be served at a path ending with a slash
+		target := path + "/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
+
+// Connections returns metrics of all categories of all registered connections.
+func (d *DashboardHandler) Connections() ([]*DashboardConnection, error) {
+	result := make([]*DashboardConnection, 0)
+	for _, src := range d.getSources() {
+		conn := &DashboardConnection{Name: src.name, Metrics: make([]*Metrics, 0)}
+		if logger := src.logger(); logger != nil {
+			for _, category := range metricsCategories(logger, src.categories) {
+				m, err := logger.Metrics(category)
+				if err != nil {
+					return nil, err
+				}
+				if m != nil {
+					conn.Metrics = append(conn.Metrics, m)
+				}
+			}
+		}
+		result = append(result, conn)
+	}
+	return result, nil
+}
+
+func (d *DashboardHandler) serveConnections(w http.ResponseWriter) {
+	conns, err := d.Connections()
+	if err != nil {
+		writeDashboardJson(w, http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	writeDashboardJson(w, http.StatusOK, map[string]interface{}{"connections": conns})
+}
+
+func (d *DashboardHandler) serveCommands(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name, category := query.Get("conn"), query.Get("cat")
+	n := defaultDashboardLatestCmds
+	if v := query.Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			writeDashboardJson(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid parameter n: " + v})
+			return
+		}
+	}
+	if n > maxDashboardLatestCmds {
+		n = maxDashboardLatestCmds
+	}
+	var logger IMetricsLogger
+	var categories []string
+	for _, src := range d.getSources() {
+		if src.name == name {
+			logger, categories = src.logger(), src.categories
+			break
+		}
+	}
+	if logger == nil {
+		writeDashboardJson(w, http.StatusNotFound, map[string]interface{}{"error": "connection not found: " + name})
+		return
+	}
+	// only categories shown on the dashboard can be requested: reading an unknown category may create it
+	known := false
+	for _, cat := range metricsCategories(logger, categories) {
+		if cat == category {
+			known = true
+			break
+		}
+	}
+	if !known {
+		writeDashboardJson(w, http.StatusNotFound, map[string]interface{}{"error": "category not found: " + category})
+		return
+	}
+	m, err := logger.Metrics(category, MetricsOpts{ReturnLatestCommands: n})
+	if err != nil {
+		writeDashboardJson(w, http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	writeDashboardJson(w, http.StatusOK, map[string]interface{}{"conn": name, "metrics": m})
+}
+
+func (d *DashboardHandler) servePage(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = dashboardTemplate.Execute(w, map[string]interface{}{"Title": d.title})
+}
+
+func writeDashboardJson(w http.ResponseWriter, status int, data interface{}) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(js)
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body{font-family:-apple-system,"Segoe UI",Roboto,Helvetica,Arial,sans-serif;font-size:14px;margin:16px;color:#222}
+h1{font-size:20px}h2{font-size:16px;margin-top:24px}
+table{border-collapse:collapse;margin-bottom:8px}
+th,td{border:1px solid #ccc;padding:4px 8px;text-align:right;vertical-align:top}
+th{background:#f3f3f3}td.l{text-align:left}
+tr.cat{cursor:pointer}tr.cat:hover{background:#eef5ff}tr.sel{background:#dde9ff}
+.err{color:#b00}pre{margin:0;white-space:pre-wrap;word-break:break-all;max-width:640px}
+#status{color:#666}
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div><label>Latest commands: <input id="n" type="number" value="20" min="1" max="1000" style="width:64px"></label>
+<button id="refresh">Refresh</button> <span id="status"></span></div>
+<div id="conns"></div>
+<div id="cmds"></div>
+<script>
+(function(){
+var selected=null;
+function esc(v){return String(v===undefined||v===null?"":v).replace(/[&<>"']/g,function(c){return{"&":"&amp;","<":"&lt;",">":"&gt;","\"":"&quot;","'":"&#39;"}[c];});}
+function num(v){return typeof v==="number"?(Math.round(v*100)/100).toString():esc(v);}
+function json(v){return v===undefined||v===null?"":esc(JSON.stringify(v,null,1));}
+function get(url,cb){
+ fetch(url,{cache:"no-store"}).then(function(r){return r.json();}).then(function(data){
+  if(data.error){document.getElementById("status").textContent=data.error;return;}
+  document.getElementById("status").textContent="updated "+new Date().toLocaleTimeString();cb(data);
+ }).catch(function(e){document.getElementById("status").textContent=String(e);});
+}
+function loadConns(){
+ get("api/connections",function(data){
+  var h="";
+  data.connections.forEach(function(c){
+   h+="<h2>"+esc(c.name)+"</h2><table><tr><th class=l>category</th><th>total</th><th>window</th><th>min</th><th>mean</th><th>p50</th><th>p90</th><th>p95</th><th>p99</th><th>max</th></tr>";
+   c.metrics.forEach(function(m){
+    var sel=selected&&selected.conn===c.name&&selected.cat===m.cat?" sel":"";
+    h+="<tr class='cat"+sel+"' data-conn='"+esc(c.name)+"' data-cat='"+esc(m.cat)+"'><td class=l>"+esc(m.cat)+"</td><td>"+m.total+"</td><td>"+m.window+"</td><td>"+num(m.min)+"</td><td>"+num(m.avg)+"</td><td>"+num(m.p50)+"</td><td>"+num(m.p90)+"</td><td>"+num(m.p95)+"</td><td>"+num(m.p99)+"</td><td>"+num(m.max)+"</td></tr>";
+   });
+   h+="</table>";
+  });
+  document.getElementById("conns").innerHTML=h;
+  Array.prototype.forEach.call(document.querySelectorAll("tr.cat"),function(tr){
+   tr.onclick=function(){selected={conn:tr.getAttribute("data-conn"),cat:tr.getAttribute("data-cat")};refresh();};
+  });
+ });
+}
+function loadCmds(){
+ if(!selected){document.getElementById("cmds").innerHTML="";return;}
+ var n=document.getElementById("n").value;
+ get("api/commands?conn="+encodeURIComponent(selected.conn)+"&cat="+encodeURIComponent(selected.cat)+"&n="+encodeURIComponent(n),function(data){
+  var h="<h2>Latest commands: "+esc(data.conn)+" / "+esc(data.metrics.cat)+"</h2><table><tr><th class=l>id</th><th class=l>end</th><th class=l>cmd</th><th class=l>request</th><th>cost</th><th class=l>result</th><th class=l>error</th></tr>";
+  (data.metrics.last||[]).forEach(function(c){
+   var err=c.error?(c.error.msg||"")+(c.error.code?" ["+c.error.code+"]":""):"";
+   h+="<tr><td class=l>"+esc(c.id)+"</td><td class=l>"+esc(c.tend)+"</td><td class=l>"+esc(c.cname)+"</td><td class=l><pre>"+json(c.creq)+"</pre></td><td>"+num(c.cost)+"</td><td class=l>"+esc(c.result)+"</td><td class='l err'>"+esc(err)+"</td></tr>";
+  });
+  document.getElementById("cmds").innerHTML=h+"</table>";
+ });
+}
+function refresh(){loadConns();loadCmds();}
+document.getElementById("refresh").onclick=refresh;
+refresh();
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,141 @@
+package prom
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewDashboardHandler(t *testing.T) {
+	testName := "TestNewDashboardHandler"
+	if d := NewDashboardHandler(""); d.Title() != defaultDashboardTitle {
+		t.Fatalf("%s failed: expected title %#v but received %#v", testName, defaultDashboardTitle, d.Title())
+	}
+	if d := NewDashboardHandler("My <app>"); d.Title() != "My <app>" {
+		t.Fatalf("%s failed: expected title %#v but received %#v", testName, "My <app>", d.Title())
+	}
+}
+
+func newTestDashboard() *DashboardHandler {
+	conn := &BaseConnection{}
+	conn.RegisterMetricsLogger(NewMemoryStoreMetricsLogger(10))
+	_ = conn.LogMetrics(MetricsCatDQL, &CmdExecInfo{Id: "1", CmdName: "SELECT", CmdRequest: map[string]interface{}{"query": "SELECT ?", "params": []interface{}{1}}, Cost: 5, Result: CmdResultOk})
+	_ = conn.LogMetrics(MetricsCatDQL, &CmdExecInfo{Id: "2", CmdName: "SELECT", Cost: 7, Result: CmdResultError, Error: errors.New("dummy")})
+	_ = conn.LogMetrics(MetricsCatDML, &CmdExecInfo{Id: "3", CmdName: "INSERT", Cost: 3})
+	return NewDashboardHandler("My <app>").
+		AddConnection("main", conn).
+		AddLogger("other", NewMemoryStoreMetricsLogger(10), MetricsCatAll)
+}
+
+func TestDashboardHandler_Page(t *testing.T) {
+	testName := "TestDashboardHandler_Page"
+	d := newTestDashboard()
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("%s failed: unexpected response %#v / %#v", testName, w.Code, w.Header().Get("Content-Type"))
+	}
+	if body := w.Body.String(); !strings.Contains(body, "<title>My &lt;app&gt;</title>") || !strings.Contains(body, "api/connections") {
+		t.Fatalf("%s failed: unexpected page content", testName)
+	}
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/prom?x=1", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/debug/prom/?x=1" {
+		t.Fatalf("%s failed: expected redirect but received %#v / %#v", testName, w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("%s failed: expected status %#v but received %#v", testName, http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestDashboardHandler_Connections(t *testing.T) {
+	testName := "TestDashboardHandler_Connections"
+	d := newTestDashboard()
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/prom/api/connections", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s failed: expected status %#v but received %#v", testName, http.StatusOK, w.Code)
+	}
+	var resp struct {
+		Connections []*DashboardConnection `json:"connections"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if len(resp.Connections) != 2 || resp.Connections[0].Name != "main" || resp.Connections[1].Name != "other" {
+		t.Fatalf("%s failed: unexpected connections %s", testName, w.Body.String())
+	}
+	if m := resp.Connections[0].Metrics; len(m) != 2 || m[0].Category != MetricsCatDML || m[1].Category != MetricsCatDQL || m[1].TotalNumCmds != 2 || len(m[1].LastNCmds) != 0 {
+		t.Fatalf("%s failed: unexpected metrics of connection <main> %s", testName, w.Body.String())
+	}
+	if m := resp.Connections[1].Metrics; len(m) != 1 || m[0].Category != MetricsCatAll {
+		t.Fatalf("%s failed: unexpected metrics of connection <other> %s", testName, w.Body.String())
+	}
+}
+
+func TestDashboardHandler_Commands(t *testing.T) {
+	testName := "TestDashboardHandler_Commands"
+	d := newTestDashboard()
+	testCases := []struct {
+		name   string
+		url    string
+		status int
+		numCmd int
+	}{
+		{"default", "/api/commands?conn=main&cat=dql", http.StatusOK, 2},
+		{"limit", "/api/commands?conn=main&cat=dql&n=1", http.StatusOK, 1},
+		{"invalid_n", "/api/commands?conn=main&cat=dql&n=x", http.StatusBadRequest, 0},
+		{"no_conn", "/api/commands?conn=none&cat=dql", http.StatusNotFound, 0},
+		{"no_cat", "/api/commands?conn=main&cat=unknown", http.StatusNotFound, 0},
+		{"cat_not_shown", "/api/commands?conn=other&cat=dql", http.StatusNotFound, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			if w.Code != tc.status {
+				t.Fatalf("%s failed: expected status %#v but received %#v", testName, tc.status, w.Code)
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Conn    string   `json:"conn"`
+				Metrics *Metrics `json:"metrics"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s failed: %s", testName, err)
+			}
+			if resp.Conn != "main" || len(resp.Metrics.LastNCmds) != tc.numCmd || resp.Metrics.LastNCmds[0].Id != "2" || resp.Metrics.LastNCmds[0].Error.Error() != "dummy" {
+				t.Fatalf("%s failed: unexpected response %s", testName, w.Body.String())
+			}
+			if tc.numCmd == 2 && !strings.Contains(w.Body.String(), `"creq":{"params":[1],"query":"SELECT ?"}`) {
+				t.Fatalf("%s failed: command request not included %s", testName, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDashboardHandler_CommandsUnknownCategory(t *testing.T) {
+	testName := "TestDashboardHandler_CommandsUnknownCategory"
+	logger := NewMemoryStoreMetricsLogger(10)
+	_ = logger.Put(MetricsCatDQL, &CmdExecInfo{Id: "1", CmdName: "SELECT", Cost: 5})
+	d := NewDashboardHandler("").AddLogger("main", logger)
+	for _, cat := range []string{"random-1", "random-2", ""} {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/commands?conn=main&cat="+cat, nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("%s failed: expected status %#v but received %#v", testName, http.StatusNotFound, w.Code)
+		}
+	}
+	if cats := logger.(IMetricsCategoryLister).Categories(); len(cats) != 1 || cats[0] != MetricsCatDQL {
+		t.Fatalf("%s failed: requests of unknown categories should not create them, received %#v", testName, cats)
+	}
+}
@@ -0,0 +1,450 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPinger is implemented by connections that can verify their liveness, e.g. sql.SqlConnect.
+//
+// @Available since <<VERSION>>
+type IPinger interface {
+	// Ping verifies the connection is alive, establishing a connection if necessary.
+	Ping(ctx context.Context) error
+}
+
+// HealthState is the health state of a connection monitored by a HealthChecker.
+//
+// @Available since <<VERSION>>
+type HealthState int
+
+const (
+	// HealthUnknown means the connection has not been checked yet.
+	HealthUnknown HealthState = iota
+
+	// HealthHealthy means the connection responds to pings in time.
+	HealthHealthy
+
+	// HealthDegraded means the connection fails some pings, or responds slowly.
+	HealthDegraded
+
+	// HealthDown means the connection has failed HealthCheckerOpts.DownAfter consecutive pings.
+	HealthDown
+)
+
+// String implements fmt.Stringer.
+func (s HealthState) String() string {
+	switch s {
+	case HealthHealthy:
+		return "healthy"
+	case HealthDegraded:
+		return "degraded"
+	case HealthDown:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s HealthState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+const (
+	defaultHealthCheckInterval     = 10 * time.Second
+	defaultHealthCheckTimeout      = 2 * time.Second
+	defaultHealthCheckDownAfter    = 3
+	defaultHealthCheckRecoverAfter = 2
+)
+
+// HealthCheckerOpts configures a HealthChecker.
+//
+// @Available since <<VERSION>>
+type HealthCheckerOpts struct {
+	// Interval between two rounds of checks. Default value is 10 seconds.
+	Interval time.Duration
+
+	// Timeout of each ping. Default value is 2 seconds.
+	Timeout time.Duration
+
+	// Number of consecutive failed pings before a connection is considered down. A failed ping of a healthy
+	// connection makes it degraded. Default value is 3.
+	DownAfter int
+
+	// Number of consecutive successful pings (not slower than SlowThreshold) before a degraded or down connection is
+	// considered healthy again, to damp flapping. Default value is 2.
+	RecoverAfter int
+
+	// Successful pings slower than this value make the connection degraded. Set to zero or negative value to disable.
+	SlowThreshold time.Duration
+}
+
+// HealthEvent is published to subscribers of a HealthChecker when the state of a connection changes.
+//
+// @Available since <<VERSION>>
+type HealthEvent struct {
+	Name   string       // name of the connection
+	From   HealthState  // previous state
+	To     HealthState  // new state
+	Err    error        // error of the ping that caused the change, nil if the ping succeeded
+	Time   time.Time    // time of the ping that caused the change
+	Status HealthStatus // status of the connection after the change
+}
+
+// HealthStatus is a snapshot of the health of a connection.
+//
+// @Available since <<VERSION>>
+type HealthStatus struct {
+	Name                 string      `json:"name"`
+	State                HealthState `json:"state"`
+	Since                time.Time   `json:"since"`                // time the connection entered the current state
+	LastCheck            time.Time   `json:"last_check"`           // time of the last ping
+	Latency              float64     `json:"latency"`              // duration of the last ping, in milliseconds
+	LastError            string      `json:"last_error,omitempty"` // error of the last ping, empty if it succeeded
+	ConsecutiveFailures  int         `json:"consecutive_failures"`
+	ConsecutiveSuccesses int         `json:"consecutive_successes"`
+}
+
+// NewHealthChecker creates a new HealthChecker instance. Call Start to start checking periodically.
+//
+// @Available since <<VERSION>>
+func NewHealthChecker(opts HealthCheckerOpts) *HealthChecker {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultHealthCheckInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultHealthCheckTimeout
+	}
+	if opts.DownAfter <= 0 {
+		opts.DownAfter = defaultHealthCheckDownAfter
+	}
+	if opts.RecoverAfter <= 0 {
+		opts.RecoverAfter = defaultHealthCheckRecoverAfter
+	}
+	return &HealthChecker{opts: opts, subscribers: make(map[int]func(HealthEvent))}
+}
+
+// HealthChecker periodically pings connections, keeps a health state of each connection and publishes state changes
+// to subscribers.
+//
+// State transitions:
+//   - a failed ping makes a healthy connection degraded, DownAfter consecutive failed pings make it down.
+//   - a successful ping slower than SlowThreshold makes a healthy connection degraded.
+//   - RecoverAfter consecutive successful pings make a degraded or down connection healthy (or degraded if the last
+//     ping was slow) again.
+//
+// @Available since <<VERSION>>
+type HealthChecker struct {
+	opts        HealthCheckerOpts
+	lock        sync.RWMutex
+	targets     []*healthTarget
+	subscribers map[int]func(HealthEvent)
+	nextSubId   int
+	lastRound   time.Time
+	stopCh      chan struct{}
+	doneCh      chan struct{}
+}
+
+type healthTarget struct {
+	name      string
+	pinger    IPinger
+	status    HealthStatus
+	goodPings int // consecutive successful pings not slower than SlowThreshold
+}
+
+// Opts returns the options of this checker (with default values applied).
+func (hc *HealthChecker) Opts() HealthCheckerOpts {
+	return hc.opts
+}
+
+// Add adds a connection to be checked. This function returns error if the name is empty or has been taken.
+func (hc *HealthChecker) Add(name string, pinger IPinger) error {
+	if name == "" || pinger == nil {
+		return errors.New("connection must have a name and a pinger")
+	}
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	for _, t := range hc.targets {
+		if t.name == name {
+			return fmt.Errorf("connection <%s> has been added", name)
+		}
+	}
+	hc.targets = append(hc.targets, &healthTarget{name: name, pinger: pinger, status: HealthStatus{Name: name, Since: time.Now()}})
+	return nil
+}
+
+// AddConnection adds a connection to be checked. This function returns error if the connection does not implement
+// IPinger.
+func (hc *HealthChecker) AddConnection(name string, conn IBaseConnection) error {
+	pinger, ok := conn.(IPinger)
+	if !ok {
+		return fmt.Errorf("connection <%s> does not implement IPinger", name)
+	}
+	return hc.Add(name, pinger)
+}
+
+// AddRegistry adds all connections of a registry that implement IPinger, returning the names of added connections.
+func (hc *HealthChecker) AddRegistry(r *Registry) []string {
+	result := make([]string, 0)
+	for _, name := range r.Names() {
+		if hc.AddConnection(name, r.Get(name)) == nil {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// Remove stops checking a connection.
+func (hc *HealthChecker) Remove(name string) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	for i, t := range hc.targets {
+		if t.name == name {
+			hc.targets = append(hc.targets[:i], hc.targets[i+1:]...)
+			return
+		}
+	}
+}
+
+// Subscribe registers a function to receive state changes of connections. Events are delivered synchronously from
+// the checking goroutine, hence the function should return quickly.
+//
+// This function returns a function to unsubscribe.
+func (hc *HealthChecker) Subscribe(fn func(event HealthEvent)) (unsubscribe func()) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	id := hc.nextSubId
+	hc.nextSubId++
+	hc.subscribers[id] = fn
+	return func() {
+		hc.lock.Lock()
+		defer hc.lock.Unlock()
+		delete(hc.subscribers, id)
+	}
+}
+
+// Status returns the health status of a connection. This function returns false if the connection is not found.
+func (hc *HealthChecker) Status(name string) (HealthStatus, bool) {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	for _, t := range hc.targets {
+		if t.name == name {
+			return t.status, true
+		}
+	}
+	return HealthStatus{}, false
+}
+
+// Statuses returns the health status of all connections, in the order connections were added.
+func (hc *HealthChecker) Statuses() []HealthStatus {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	result := make([]HealthStatus, len(hc.targets))
+	for i, t := range hc.targets {
+		result[i] = t.status
+	}
+	return result
+}
+
+// Start starts checking connections periodically, with the first round of checks performed immediately. Calling
+// Start on a started checker has no effect.
+func (hc *HealthChecker) Start() {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	if hc.stopCh != nil {
+		return
+	}
+	hc.stopCh, hc.doneCh = make(chan struct{}), make(chan struct{})
+	go hc.loop(hc.stopCh, hc.doneCh)
+}
+
+// Stop stops checking connections and waits for the running round of checks (if any) to finish.
+func (hc *HealthChecker) Stop() {
+	hc.lock.Lock()
+	stopCh, doneCh := hc.stopCh, hc.doneCh
+	hc.stopCh, hc.doneCh = nil, nil
+	hc.lock.Unlock()
+	if stopCh != nil {
+		close(stopCh)
+		<-doneCh
+	}
+}
+
+func (hc *HealthChecker) loop(stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+	ticker := time.NewTicker(hc.opts.Interval)
+	defer ticker.Stop()
+	for {
+		hc.CheckNow(context.Background())
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckNow pings all connections concurrently, updates their states and publishes state changes. It returns when all
+// pings have finished (each ping is bounded by HealthCheckerOpts.Timeout).
+func (hc *HealthChecker) CheckNow(ctx context.Context) {
+	hc.lock.RLock()
+	targets := make([]*healthTarget, len(hc.targets))
+	copy(targets, hc.targets)
+	hc.lock.RUnlock()
+
+	type pingResult struct {
+		err     error
+		start   time.Time
+		latency time.Duration
+	}
+	results := make([]pingResult, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t *healthTarget) {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, hc.opts.Timeout)
+			defer cancel()
+			start := time.Now()
+			err := safePing(pingCtx, t.pinger)
+			results[i] = pingResult{err: err, start: start, latency: time.Since(start)}
+		}(i, t)
+	}
+	wg.Wait()
+
+	events := make([]HealthEvent, 0)
+	hc.lock.Lock()
+	for i, t := range targets {
+		if event, changed := hc.update(t, results[i].err, results[i].start, results[i].latency); changed {
+			events = append(events, event)
+		}
+	}
+	hc.lastRound = time.Now()
+	subscribers := make([]func(HealthEvent), 0, len(hc.subscribers))
+	for id := 0; id < hc.nextSubId; id++ {
+		if fn, ok := hc.subscribers[id]; ok {
+			subscribers = append(subscribers, fn)
+		}
+	}
+	hc.lock.Unlock()
+
+	for _, event := range events {
+		for _, fn := range subscribers {
+			fn(event)
+		}
+	}
+}
+
+func safePing(ctx context.Context, pinger IPinger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return pinger.Ping(ctx)
+}
+
+// update applies the result of a ping to the target's state, must be called with the lock held.
+func (hc *HealthChecker) update(t *healthTarget, err error, at time.Time, latency time.Duration) (HealthEvent, bool) {
+	s := &t.status
+	from := s.State
+	to := from
+	s.LastCheck, s.Latency = at, float64(latency.Nanoseconds())/1e6
+	if err != nil {
+		s.LastError = err.Error()
+		s.ConsecutiveFailures++
+		s.ConsecutiveSuccesses, t.goodPings = 0, 0
+		if s.ConsecutiveFailures >= hc.opts.DownAfter || from == HealthDown {
+			to = HealthDown
+		} else {
+			to = HealthDegraded
+		}
+	} else {
+		s.LastError = ""
+		s.ConsecutiveFailures = 0
+		s.ConsecutiveSuccesses++
+		slow := hc.opts.SlowThreshold > 0 && latency > hc.opts.SlowThreshold
+		if slow {
+			t.goodPings = 0
+		} else {
+			t.goodPings++
+		}
+		target := HealthHealthy
+		if slow {
+			target = HealthDegraded
+		}
+		switch from {
+		case HealthUnknown, HealthHealthy:
+			to = target
+		case HealthDegraded:
+			if t.goodPings >= hc.opts.RecoverAfter {
+				to = HealthHealthy
+			}
+		case HealthDown:
+			if s.ConsecutiveSuccesses >= hc.opts.RecoverAfter {
+				to = HealthDegraded
+				if t.goodPings >= hc.opts.RecoverAfter {
+					to = HealthHealthy
+				}
+			}
+		}
+	}
+	if to == from {
+		return HealthEvent{}, false
+	}
+	s.State, s.Since = to, at
+	return HealthEvent{Name: t.name, From: from, To: to, Err: err, Time: at, Status: *s}, true
+}
+
+// Ready returns true if all connections have been checked and none is down.
+func (hc *HealthChecker) Ready() bool {
+	for _, s := range hc.Statuses() {
+		if s.State == HealthUnknown || s.State == HealthDown {
+			return false
+		}
+	}
+	return true
+}
+
+// Live returns true if the checker is not stuck, i.e. it is stopped or its last round of checks finished recently
+// (within two intervals plus the ping timeout).
+func (hc *HealthChecker) Live() bool {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	if hc.stopCh == nil || hc.lastRound.IsZero() {
+		return true
+	}
+	return time.Since(hc.lastRound) <= 2*hc.opts.Interval+hc.opts.Timeout
+}
+
+// ServeHTTP implements http.Handler, serving health probes (relative to the path the handler is mounted at):
+//   - GET .../live: liveness probe, status 200 if Live returns true, 503 otherwise.
+//   - GET .../ready (or any other path): readiness probe, status 200 if Ready returns true, 503 otherwise.
+//
+// The response body reports the status of each connection:
+//
+//	{"status": "ok"|"unavailable", "connections": [<HealthStatus>, ...]}
+func (hc *HealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var ok bool
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/live") {
+		ok = hc.Live()
+	} else {
+		ok = hc.Ready()
+	}
+	status, code := "ok", http.StatusOK
+	if !ok {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	writeDashboardJson(w, code, map[string]interface{}{"status": status, "connections": hc.Statuses()})
+}
@@ -0,0 +1,228 @@
+package prom
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testPinger struct {
+	lock  sync.Mutex
+	err   error
+	delay time.Duration
+	count int
+}
+
+func (p *testPinger) set(err error, delay time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.err, p.delay = err, delay
+}
+
+func (p *testPinger) Ping(ctx context.Context) error {
+	p.lock.Lock()
+	err, delay := p.err, p.delay
+	p.count++
+	p.lock.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+func TestHealthState_String(t *testing.T) {
+	testName := "TestHealthState_String"
+	expected := map[HealthState]string{HealthUnknown: "unknown", HealthHealthy: "healthy", HealthDegraded: "degraded", HealthDown: "down"}
+	for state, str := range expected {
+		if state.String() != str {
+			t.Fatalf("%s failed: expected %q but received %q", testName, str, state.String())
+		}
+	}
+}
+
+func TestHealthChecker_StateMachine(t *testing.T) {
+	testName := "TestHealthChecker_StateMachine"
+	errPing := errors.New("ping failed")
+	hc := NewHealthChecker(HealthCheckerOpts{Timeout: 100 * time.Millisecond, DownAfter: 3, RecoverAfter: 2, SlowThreshold: 20 * time.Millisecond})
+	pinger := &testPinger{}
+	if err := hc.Add("db", pinger); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if err := hc.Add("db", pinger); err == nil {
+		t.Fatalf("%s failed: expected error adding duplicated name", testName)
+	}
+	events := make([]HealthEvent, 0)
+	unsubscribe := hc.Subscribe(func(event HealthEvent) { events = append(events, event) })
+
+	steps := []struct {
+		name  string
+		err   error
+		delay time.Duration
+		state HealthState
+	}{
+		{"first_ok", nil, 0, HealthHealthy},
+		{"fail_1", errPing, 0, HealthDegraded},
+		{"fail_2", errPing, 0, HealthDegraded},
+		{"fail_3", errPing, 0, HealthDown},
+		{"recover_1", nil, 0, HealthDown},
+		{"fail_again", errPing, 0, HealthDown},
+		{"recover_1_again", nil, 0, HealthDown},
+		{"recover_2", nil, 0, HealthHealthy},
+		{"slow", nil, 40 * time.Millisecond, HealthDegraded},
+		{"fast_1", nil, 0, HealthDegraded},
+		{"fast_2", nil, 0, HealthHealthy},
+		{"timeout", nil, 300 * time.Millisecond, HealthDegraded},
+	}
+	for _, step := range steps {
+		pinger.set(step.err, step.delay)
+		hc.CheckNow(context.Background())
+		status, _ := hc.Status("db")
+		if status.State != step.state {
+			t.Fatalf("%s failed: step %s: expected state %s but received %s", testName, step.name, step.state, status.State)
+		}
+	}
+	status, _ := hc.Status("db")
+	if status.LastError == "" || status.ConsecutiveFailures != 1 {
+		t.Fatalf("%s failed: expected timeout error recorded but received %#v", testName, status)
+	}
+
+	expected := []HealthState{HealthHealthy, HealthDegraded, HealthDown, HealthHealthy, HealthDegraded, HealthHealthy, HealthDegraded}
+	if len(events) != len(expected) {
+		t.Fatalf("%s failed: expected %d events but received %d", testName, len(expected), len(events))
+	}
+	for i, event := range events {
+		if event.Name != "db" || event.To != expected[i] || event.Status.State != expected[i] {
+			t.Fatalf("%s failed: event %d: expected state %s but received %#v", testName, i, expected[i], event)
+		}
+		if i > 0 && event.From != expected[i-1] {
+			t.Fatalf("%s failed: event %d: expected previous state %s but received %s", testName, i, expected[i-1], event.From)
+		}
+	}
+	if events[2].Err != errPing {
+		t.Fatalf("%s failed: expected ping error in event but received %v", testName, events[2].Err)
+	}
+
+	unsubscribe()
+	pinger.set(nil, 0)
+	hc.CheckNow(context.Background())
+	hc.CheckNow(context.Background())
+	if len(events) != len(expected) {
+		t.Fatalf("%s failed: expected no event after unsubscribing", testName)
+	}
+}
+
+func TestHealthChecker_AddConnection(t *testing.T) {
+	testName := "TestHealthChecker_AddConnection"
+	hc := NewHealthChecker(HealthCheckerOpts{})
+	if err := hc.AddConnection("base", &BaseConnection{}); err == nil {
+		t.Fatalf("%s failed: expected error adding connection not implementing IPinger", testName)
+	}
+	type pingConn struct {
+		*BaseConnection
+		*testPinger
+	}
+	r := NewRegistry()
+	_ = r.Register("a", &pingConn{&BaseConnection{}, &testPinger{}})
+	_ = r.Register("b", &BaseConnection{})
+	_ = r.Register("c", &pingConn{&BaseConnection{}, &testPinger{}})
+	if names := hc.AddRegistry(r); len(names) != 2 || names[0] != "a" || names[1] != "c" {
+		t.Fatalf("%s failed: expected connections [a c] added but received %#v", testName, names)
+	}
+	hc.Remove("a")
+	if statuses := hc.Statuses(); len(statuses) != 1 || statuses[0].Name != "c" || statuses[0].State != HealthUnknown {
+		t.Fatalf("%s failed: unexpected statuses %#v", testName, statuses)
+	}
+}
+
+func TestHealthChecker_StartStop(t *testing.T) {
+	testName := "TestHealthChecker_StartStop"
+	hc := NewHealthChecker(HealthCheckerOpts{Interval: 10 * time.Millisecond})
+	pinger := &testPinger{}
+	_ = hc.Add("db", pinger)
+	changed := make(chan HealthEvent, 10)
+	hc.Subscribe(func(event HealthEvent) { changed <- event })
+	hc.Start()
+	hc.Start()
+	select {
+	case event := <-changed:
+		if event.To != HealthHealthy {
+			t.Fatalf("%s failed: expected state %s but received %s", testName, HealthHealthy, event.To)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s failed: no event received", testName)
+	}
+	time.Sleep(50 * time.Millisecond)
+	hc.Stop()
+	pinger.lock.Lock()
+	count := pinger.count
+	pinger.lock.Unlock()
+	if count < 3 {
+		t.Fatalf("%s failed: expected periodic pings but received %d", testName, count)
+	}
+	time.Sleep(30 * time.Millisecond)
+	pinger.lock.Lock()
+	defer pinger.lock.Unlock()
+	if pinger.count != count {
+		t.Fatalf("%s failed: expected no ping after stopping", testName)
+	}
+}
+
+func TestHealthChecker_ServeHTTP(t *testing.T) {
+	testName := "TestHealthChecker_ServeHTTP"
+	hc := NewHealthChecker(HealthCheckerOpts{DownAfter: 1})
+	a, b := &testPinger{}, &testPinger{}
+	_ = hc.Add("a", a)
+	_ = hc.Add("b", b)
+	get := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		hc.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		result := make(map[string]interface{})
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+
+	if code, _ := get("/health/ready"); code != http.StatusServiceUnavailable {
+		t.Fatalf("%s failed: expected not ready before first check but received %d", testName, code)
+	}
+	if code, _ := get("/health/live"); code != http.StatusOK {
+		t.Fatalf("%s failed: expected live but received %d", testName, code)
+	}
+	hc.CheckNow(context.Background())
+	code, body := get("/health/ready")
+	if code != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("%s failed: expected ready but received %d %#v", testName, code, body)
+	}
+	conns, _ := body["connections"].([]interface{})
+	if len(conns) != 2 || conns[0].(map[string]interface{})["state"] != "healthy" {
+		t.Fatalf("%s failed: unexpected connections %#v", testName, body["connections"])
+	}
+
+	b.set(errors.New("ping failed"), 0)
+	hc.CheckNow(context.Background())
+	code, body = get("/health/")
+	if code != http.StatusServiceUnavailable || body["status"] != "unavailable" {
+		t.Fatalf("%s failed: expected not ready but received %d %#v", testName, code, body)
+	}
+	conns, _ = body["connections"].([]interface{})
+	if conn := conns[1].(map[string]interface{}); conn["state"] != "down" || conn["last_error"] != "ping failed" {
+		t.Fatalf("%s failed: unexpected connection status %#v", testName, conn)
+	}
+	if code, _ := get("/health/live/"); code != http.StatusOK {
+		t.Fatalf("%s failed: expected live but received %d", testName, code)
+	}
+
+	w := httptest.NewRecorder()
+	hc.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/health/ready", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("%s failed: expected status %d but received %d", testName, http.StatusMethodNotAllowed, w.Code)
+	}
+}
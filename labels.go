@@ -0,0 +1,287 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+// CmdMetaLabels is the key of labels in CmdExecInfo.CmdMeta, see CmdExecInfo.AttachLabels.
+//
+// @Available since <<VERSION>>
+const CmdMetaLabels = "labels"
+
+// LabelValueOther is the label value metrics of commands are aggregated under once a label has reached the maximum
+// number of distinct values, see LabelMetricsLoggerOpts.MaxValues.
+//
+// @Available since <<VERSION>>
+const LabelValueOther = "__other__"
+
+type labelsContextKey struct{}
+
+// WithLabels returns a copy of ctx carrying request-scoped labels (e.g. tenant id, HTTP route, trace id or user), to be
+// attached to commands executed with the returned context. Labels already carried by ctx are kept, unless overridden
+// by labels with the same names.
+//
+// @Available since <<VERSION>>
+func WithLabels(ctx context.Context, labels map[string]string) context.Context {
+	if len(labels) == 0 {
+		return ctx
+	}
+	parent := LabelsFromContext(ctx)
+	merged := make(map[string]string, len(parent)+len(labels))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, labelsContextKey{}, merged)
+}
+
+// LabelsFromContext returns the labels carried by ctx (see WithLabels), nil if none. The returned map must not be
+// modified.
+//
+// @Available since <<VERSION>>
+func LabelsFromContext(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	labels, _ := ctx.Value(labelsContextKey{}).(map[string]string)
+	return labels
+}
+
+// AttachLabels stores the labels carried by ctx (see WithLabels) in the command's CmdMeta, under key CmdMetaLabels.
+// CmdMeta is initialized as a map[string]interface{} if nil; labels are not attached if CmdMeta is of another type.
+//
+// @Available since <<VERSION>>
+func (cmd *CmdExecInfo) AttachLabels(ctx context.Context) *CmdExecInfo {
+	labels := LabelsFromContext(ctx)
+	if len(labels) == 0 {
+		return cmd
+	}
+	if cmd.CmdMeta == nil {
+		cmd.CmdMeta = map[string]interface{}{CmdMetaLabels: labels}
+	} else if meta, ok := cmd.CmdMeta.(map[string]interface{}); ok {
+		meta[CmdMetaLabels] = labels
+	}
+	return cmd
+}
+
+// Labels returns the labels attached to the command (see AttachLabels), nil if none.
+//
+// @Available since <<VERSION>>
+func (cmd *CmdExecInfo) Labels() map[string]string {
+	meta, ok := cmd.CmdMeta.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	switch labels := meta[CmdMetaLabels].(type) {
+	case map[string]string:
+		return labels
+	case map[string]interface{}:
+		// e.g. commands decoded from JSON
+		result := make(map[string]string, len(labels))
+		for k, v := range labels {
+			if s, ok := v.(string); ok {
+				result[k] = s
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+/*----------------------------------------------------------------------*/
+
+const defaultLabelMaxValues = 100
+
+// LabelMetricsLoggerOpts configures a LabelMetricsLogger.
+//
+// @Available since <<VERSION>>
+type LabelMetricsLoggerOpts struct {
+	// Names of labels metrics are aggregated by.
+	Labels []string `json:"labels"`
+
+	// Maximum number of distinct values tracked per category and label, including LabelValueOther: once reached,
+	// commands with further values are aggregated under LabelValueOther. Default value is 100.
+	MaxValues int `json:"max_values"`
+
+	// Categories metrics are aggregated by label for, commands of other categories are only put to the wrapped logger.
+	// Default value is DefaultLabelCategories.
+	Categories []string `json:"categories"`
+}
+
+// DefaultLabelCategories are the categories LabelMetricsLogger aggregates metrics by label for by default. Each
+// tracked label value adds a category to the wrapped logger, hence high-cardinality categories (e.g. per-query
+// fingerprint categories) are not included.
+//
+// @Available since <<VERSION>>
+var DefaultLabelCategories = []string{MetricsCatAll, MetricsCatDDL, MetricsCatDML, MetricsCatDQL, MetricsCatOther}
+
+// NewLabelMetricsLogger wraps an IMetricsLogger so that metrics are also aggregated per label value.
+//
+// @Available since <<VERSION>>
+func NewLabelMetricsLogger(logger IMetricsLogger, opts LabelMetricsLoggerOpts) *LabelMetricsLogger {
+	if opts.MaxValues <= 0 {
+		opts.MaxValues = defaultLabelMaxValues
+	}
+	if len(opts.Categories) == 0 {
+		opts.Categories = DefaultLabelCategories
+	}
+	categories := make(map[string]bool, len(opts.Categories))
+	for _, category := range opts.Categories {
+		categories[category] = true
+	}
+	return &LabelMetricsLogger{logger: logger, opts: opts, categories: categories, values: make(map[string]map[string]bool)}
+}
+
+// LabelMetricsLogger is an IMetricsLogger that puts each command to a wrapped logger under its category and, for each
+// configured label attached to the command (see CmdExecInfo.AttachLabels), under the category returned by
+// LabelCategory. Metrics per label value can then be retrieved via LabelMetrics.
+//
+// @Available since <<VERSION>>
+type LabelMetricsLogger struct {
+	logger     IMetricsLogger
+	opts       LabelMetricsLoggerOpts
+	categories map[string]bool // categories metrics are aggregated by label for
+	lock       sync.RWMutex
+	values     map[string]map[string]bool // category + label -> values
+}
+
+// LabelCategory returns the category metrics of a label value are aggregated under, e.g. "dml{tenant=acme}".
+//
+// @Available since <<VERSION>>
+func LabelCategory(category, label, value string) string {
+	return category + "{" + label + "=" + value + "}"
+}
+
+// Logger returns the wrapped logger.
+func (logger *LabelMetricsLogger) Logger() IMetricsLogger {
+	return logger.logger
+}
+
+// Opts returns the options this logger was created with.
+func (logger *LabelMetricsLogger) Opts() LabelMetricsLoggerOpts {
+	return logger.opts
+}
+
+// trackValue returns the value metrics of a command are aggregated under: the value itself, or LabelValueOther if the
+// label has reached the maximum number of distinct values.
+func (logger *LabelMetricsLogger) trackValue(category, label, value string) string {
+	key := LabelCategory(category, label, "")
+	logger.lock.RLock()
+	known := logger.values[key][value]
+	logger.lock.RUnlock()
+	if known {
+		return value
+	}
+
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	values := logger.values[key]
+	if values == nil {
+		values = make(map[string]bool)
+		logger.values[key] = values
+	}
+	if !values[value] {
+		// at most MaxValues values are tracked, LabelValueOther included
+		if len(values) >= logger.opts.MaxValues-1 {
+			value = LabelValueOther
+		}
+		values[value] = true
+	}
+	return value
+}
+
+// Put implements IMetricsLogger.Put.
+func (logger *LabelMetricsLogger) Put(category string, cmd *CmdExecInfo) error {
+	if cmd == nil {
+		return errors.New("nil input")
+	}
+	if err := logger.logger.Put(category, cmd); err != nil {
+		return err
+	}
+	labels := cmd.Labels()
+	if len(labels) == 0 || !logger.categories[category] {
+		return nil
+	}
+	for _, label := range logger.opts.Labels {
+		if value, ok := labels[label]; ok {
+			value = logger.trackValue(category, label, value)
+			if err := logger.logger.Put(LabelCategory(category, label, value), cmd); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Metrics implements IMetricsLogger.Metrics.
+func (logger *LabelMetricsLogger) Metrics(category string, opts ...MetricsOpts) (*Metrics, error) {
+	return logger.logger.Metrics(category, opts...)
+}
+
+// LabelMetrics returns metrics of commands of a category having the specified label value.
+func (logger *LabelMetricsLogger) LabelMetrics(category, label, value string, opts ...MetricsOpts) (*Metrics, error) {
+	return logger.logger.Metrics(LabelCategory(category, label, value), opts...)
+}
+
+// LabelValues returns the values of a label seen in commands of a category, sorted in ascending order.
+func (logger *LabelMetricsLogger) LabelValues(category, label string) []string {
+	logger.lock.RLock()
+	defer logger.lock.RUnlock()
+	values := logger.values[LabelCategory(category, label, "")]
+	result := make([]string, 0, len(values))
+	for value := range values {
+		result = append(result, value)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Categories implements IMetricsCategoryLister.Categories.
+// This function returns nil if the wrapped logger does not implement IMetricsCategoryLister.
+func (logger *LabelMetricsLogger) Categories() []string {
+	if lister, ok := logger.logger.(IMetricsCategoryLister); ok {
+		return lister.Categories()
+	}
+	return nil
+}
+
+// Reset implements IMetricsResetter.Reset.
+// This function does nothing if the wrapped logger does not implement IMetricsResetter.
+func (logger *LabelMetricsLogger) Reset(category string) {
+	if resetter, ok := logger.logger.(IMetricsResetter); ok {
+		resetter.Reset(category)
+	}
+}
+
+// ResetAll implements IMetricsResetter.ResetAll.
+// Tracked label values are discarded, and the wrapped logger is reset if it implements IMetricsResetter.
+func (logger *LabelMetricsLogger) ResetAll() {
+	logger.lock.Lock()
+	logger.values = make(map[string]map[string]bool)
+	logger.lock.Unlock()
+	if resetter, ok := logger.logger.(IMetricsResetter); ok {
+		resetter.ResetAll()
+	}
+}
+
+// Remove implements IMetricsCategoryRemover.Remove.
+// This function does nothing if the wrapped logger does not implement IMetricsCategoryRemover.
+func (logger *LabelMetricsLogger) Remove(category string) {
+	if remover, ok := logger.logger.(IMetricsCategoryRemover); ok {
+		remover.Remove(category)
+	}
+}
+
+// Close closes the wrapped logger if it implements io.Closer.
+func (logger *LabelMetricsLogger) Close() error {
+	if closer, ok := logger.logger.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package prom
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestWithLabels(t *testing.T) {
+	testName := "TestWithLabels"
+	if labels := LabelsFromContext(context.Background()); labels != nil {
+		t.Fatalf("%s failed: expected no labels but received %#v", testName, labels)
+	}
+	ctx := WithLabels(context.Background(), map[string]string{"tenant": "acme", "route": "/a"})
+	if WithLabels(ctx, nil) != ctx {
+		t.Fatalf("%s failed: expected same context when adding no labels", testName)
+	}
+	child := WithLabels(ctx, map[string]string{"route": "/b", "user": "u1"})
+	expected := map[string]string{"tenant": "acme", "route": "/b", "user": "u1"}
+	labels := LabelsFromContext(child)
+	if len(labels) != len(expected) {
+		t.Fatalf("%s failed: expected %#v but received %#v", testName, expected, labels)
+	}
+	for k, v := range expected {
+		if labels[k] != v {
+			t.Fatalf("%s failed: expected %#v but received %#v", testName, expected, labels)
+		}
+	}
+	if LabelsFromContext(ctx)["route"] != "/a" {
+		t.Fatalf("%s failed: parent context labels must not be modified", testName)
+	}
+}
+
+func TestCmdExecInfo_AttachLabels(t *testing.T) {
+	testName := "TestCmdExecInfo_AttachLabels"
+	ctx := WithLabels(context.Background(), map[string]string{"tenant": "acme"})
+
+	cmd := (&CmdExecInfo{}).AttachLabels(context.Background())
+	if cmd.CmdMeta != nil || cmd.Labels() != nil {
+		t.Fatalf("%s failed: expected no labels attached but received %#v", testName, cmd.CmdMeta)
+	}
+	cmd = (&CmdExecInfo{}).AttachLabels(ctx)
+	if cmd.Labels()["tenant"] != "acme" {
+		t.Fatalf("%s failed: expected labels attached but received %#v", testName, cmd.CmdMeta)
+	}
+	cmd = (&CmdExecInfo{CmdMeta: map[string]interface{}{"k": "v"}}).AttachLabels(ctx)
+	if meta := cmd.CmdMeta.(map[string]interface{}); meta["k"] != "v" || cmd.Labels()["tenant"] != "acme" {
+		t.Fatalf("%s failed: expected labels added to existing meta but received %#v", testName, cmd.CmdMeta)
+	}
+	cmd = (&CmdExecInfo{CmdMeta: "meta"}).AttachLabels(ctx)
+	if cmd.CmdMeta != "meta" || cmd.Labels() != nil {
+		t.Fatalf("%s failed: expected meta of other type kept as-is but received %#v", testName, cmd.CmdMeta)
+	}
+
+	// labels of commands decoded from JSON
+	js, _ := json.Marshal((&CmdExecInfo{}).AttachLabels(ctx))
+	decoded := &CmdExecInfo{}
+	_ = json.Unmarshal(js, decoded)
+	if decoded.Labels()["tenant"] != "acme" {
+		t.Fatalf("%s failed: expected labels decoded from JSON but received %#v", testName, decoded.CmdMeta)
+	}
+}
+
+func TestLabelMetricsLogger(t *testing.T) {
+	testName := "TestLabelMetricsLogger"
+	logger := NewLabelMetricsLogger(NewMemoryStoreMetricsLogger(100), LabelMetricsLoggerOpts{Labels: []string{"tenant", "route"}, MaxValues: 3})
+	if logger.Opts().MaxValues != 3 || len(logger.Opts().Categories) != len(DefaultLabelCategories) {
+		t.Fatalf("%s failed: unexpected options %#v", testName, logger.Opts())
+	}
+	put := func(labels map[string]string, result string) {
+		cmd := (&CmdExecInfo{Result: result, Cost: 10}).AttachLabels(WithLabels(context.Background(), labels))
+		if err := logger.Put(MetricsCatDML, cmd); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+	}
+	put(map[string]string{"tenant": "a", "route": "/x", "user": "u1"}, CmdResultOk)
+	put(map[string]string{"tenant": "a"}, CmdResultError)
+	put(map[string]string{"tenant": "b", "route": "/x"}, CmdResultOk)
+	put(map[string]string{"tenant": "c"}, CmdResultOk)
+	put(map[string]string{"tenant": "d"}, CmdResultOk)
+	put(nil, CmdResultOk)
+
+	expected := map[string]int64{"a": 2, "b": 1, LabelValueOther: 2}
+	for value, total := range expected {
+		if m, err := logger.LabelMetrics(MetricsCatDML, "tenant", value); err != nil || m.TotalNumCmds != total {
+			t.Fatalf("%s failed: expected %d commands for tenant %s but received %#v / %s", testName, total, value, m, err)
+		}
+	}
+	if m, _ := logger.LabelMetrics(MetricsCatDML, "route", "/x"); m.TotalNumCmds != 2 {
+		t.Fatalf("%s failed: expected 2 commands for route /x but received %d", testName, m.TotalNumCmds)
+	}
+	if m, _ := logger.Metrics(MetricsCatDML); m.TotalNumCmds != 6 {
+		t.Fatalf("%s failed: expected 6 commands but received %d", testName, m.TotalNumCmds)
+	}
+	if values := logger.LabelValues(MetricsCatDML, "tenant"); len(values) != 3 || values[0] != LabelValueOther || values[1] != "a" || values[2] != "b" {
+		t.Fatalf("%s failed: unexpected label values %#v", testName, values)
+	}
+	if values := logger.LabelValues(MetricsCatDML, "user"); len(values) != 0 {
+		t.Fatalf("%s failed: expected label not aggregated but received %#v", testName, values)
+	}
+	// categories not in the allow-list (e.g. fingerprint categories) are not aggregated by label
+	cmd := (&CmdExecInfo{Cost: 10}).AttachLabels(WithLabels(context.Background(), map[string]string{"tenant": "a"}))
+	_ = logger.Put("fp:0123456789abcdef", cmd)
+	if values := logger.LabelValues("fp:0123456789abcdef", "tenant"); len(values) != 0 {
+		t.Fatalf("%s failed: expected category not aggregated by label but received %#v", testName, values)
+	}
+	if m, _ := logger.Metrics("fp:0123456789abcdef"); m.TotalNumCmds != 1 {
+		t.Fatalf("%s failed: expected command put to the wrapped logger but received %#v", testName, m)
+	}
+	categories := logger.Categories()
+	if len(categories) != 6 || categories[0] != MetricsCatDML || categories[1] != LabelCategory(MetricsCatDML, "route", "/x") {
+		t.Fatalf("%s failed: unexpected categories %#v", testName, categories)
+	}
+
+	logger.ResetAll()
+	if values := logger.LabelValues(MetricsCatDML, "tenant"); len(values) != 0 {
+		t.Fatalf("%s failed: expected no label value after reset but received %#v", testName, values)
+	}
+	if err := logger.Put(MetricsCatDML, nil); err == nil {
+		t.Fatalf("%s failed: expected error putting nil command", testName)
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+}
+
+func TestLabelMetricsLogger_Categories(t *testing.T) {
+	testName := "TestLabelMetricsLogger_Categories"
+	logger := NewLabelMetricsLogger(NewMemoryStoreMetricsLogger(100), LabelMetricsLoggerOpts{Labels: []string{"tenant"}, MaxValues: 1, Categories: []string{"custom"}})
+	cmd := (&CmdExecInfo{Cost: 10}).AttachLabels(WithLabels(context.Background(), map[string]string{"tenant": "a"}))
+	for _, category := range []string{MetricsCatDML, "custom"} {
+		if err := logger.Put(category, cmd); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+	}
+	if values := logger.LabelValues(MetricsCatDML, "tenant"); len(values) != 0 {
+		t.Fatalf("%s failed: expected category not aggregated by label but received %#v", testName, values)
+	}
+	// with MaxValues=1, the only tracked value is LabelValueOther
+	if values := logger.LabelValues("custom", "tenant"); len(values) != 1 || values[0] != LabelValueOther {
+		t.Fatalf("%s failed: unexpected label values %#v", testName, values)
+	}
+}
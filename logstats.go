@@ -2,6 +2,8 @@ package prom
 
 import (
 	"errors"
+	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,6 +13,12 @@ import (
 const (
 	CmdResultOk    = "OK"
 	CmdResultError = "ERROR"
+
+	// CmdResultRejected is the result of commands rejected without being executed, e.g. by an open circuit breaker.
+	// Rejected commands are counted as errors in time-window statistics.
+	//
+	// @Available since <<VERSION>>
+	CmdResultRejected = "REJECTED"
 )
 
 const (
@@ -28,6 +36,16 @@ const (
 
 	// MetricsCatOther is a common metrics category for "other commands".
 	MetricsCatOther = "other"
+
+	// MetricsCatDCL is a common metrics category for "DCL commands" (e.g. GRANT, REVOKE).
+	//
+	// @Available since <<VERSION>>
+	MetricsCatDCL = "dcl"
+
+	// MetricsCatTCL is a common metrics category for "TCL commands" (e.g. BEGIN, COMMIT, SAVEPOINT).
+	//
+	// @Available since <<VERSION>>
+	MetricsCatTCL = "tcl"
 )
 
 // CmdExecInfo captures information around an executing command.
@@ -102,6 +120,11 @@ type Metrics struct {
 	// Total number of executed commands since the last reset.
 	TotalNumCmds int64 `json:"total"`
 
+	// Total execution cost of commands since the last reset.
+	//
+	// @Available since <<VERSION>>
+	TotalCost float64 `json:"total_cost,omitempty"`
+
 	// It might not be practical to store all executed commands to calculate metrics with 100% accuracy. Most of the
 	// time, stats of latest executed command is more important. This is the number of last executed commands used
 	// to calculate the metrics.
@@ -133,6 +156,18 @@ type Metrics struct {
 
 	// Last N executed commands.
 	LastNCmds []*CmdExecInfo `json:"last"`
+
+	// Metrics calculated over sliding time windows (e.g. last 1 minute, last 5 minutes, etc.), if supported by the
+	// metrics logger.
+	//
+	// @Available since <<VERSION>>
+	Windows []*WindowMetrics `json:"windows,omitempty"`
+
+	// Ratio (0..1] of commands that were kept by a sampling metrics logger (see SamplingMetricsLogger). Zero means
+	// commands were not sampled.
+	//
+	// @Available since <<VERSION>>
+	SampleRate float64 `json:"sample_rate,omitempty"`
 }
 
 // MetricsOpts is argument used by function IMetricsLogger.Metrics.
@@ -156,12 +191,42 @@ type IMetricsLogger interface {
 	Metrics(category string, opts ...MetricsOpts) (*Metrics, error)
 }
 
+// IMetricsCategoryLister is an optional interface an IMetricsLogger can implement to list the metrics categories it
+// currently holds.
+//
+// @Available since <<VERSION>>
+type IMetricsCategoryLister interface {
+	// Categories returns the names of metrics categories, sorted in ascending order.
+	Categories() []string
+}
+
+// IMetricsResetter is an optional interface an IMetricsLogger can implement to discard metrics collected so far.
+//
+// @Available since <<VERSION>>
+type IMetricsResetter interface {
+	// Reset discards metrics and commands of a category. The category remains listed (with empty metrics).
+	Reset(category string)
+
+	// ResetAll discards metrics and commands of all categories.
+	ResetAll()
+}
+
+// IMetricsCategoryRemover is an optional interface an IMetricsLogger can implement to remove a category entirely.
+//
+// @Available since <<VERSION>>
+type IMetricsCategoryRemover interface {
+	// Remove discards metrics and commands of a category and removes the category from the list of categories.
+	Remove(category string)
+}
+
 // NewMemoryStoreMetricsLogger creates a new MemoryStoreMetricsLogger instance.
 //   - capacity: max number of items MemoryStoreMetricsLogger can hold.
 //
+// (since <<VERSION>>) The returned logger calculates time-windowed metrics over DefaultMetricsTimeWindows.
+//
 // Available since v0.3.0
 func NewMemoryStoreMetricsLogger(capacity int) IMetricsLogger {
-	return &MemoryStoreMetricsLogger{capacity: capacity}
+	return &MemoryStoreMetricsLogger{capacity: capacity, windows: DefaultMetricsTimeWindows}
 }
 
 // MemoryStoreMetricsLogger is an in-memory bound storage implementation of IMetricsLogger.
@@ -169,7 +234,8 @@ func NewMemoryStoreMetricsLogger(capacity int) IMetricsLogger {
 // Available since v0.3.0
 type MemoryStoreMetricsLogger struct {
 	capacity int
-	lock     sync.Mutex
+	windows  []time.Duration
+	lock     sync.RWMutex
 	storage  map[string]*boundMemoryStackStore
 }
 
@@ -178,20 +244,54 @@ func (logger *MemoryStoreMetricsLogger) Capacity() int {
 	return logger.capacity
 }
 
+// TimeWindows returns the sliding time windows this logger calculates metrics for.
+//
+// @Available since <<VERSION>>
+func (logger *MemoryStoreMetricsLogger) TimeWindows() []time.Duration {
+	logger.lock.RLock()
+	defer logger.lock.RUnlock()
+	result := make([]time.Duration, len(logger.windows))
+	copy(result, logger.windows)
+	return result
+}
+
+// SetTimeWindows sets the sliding time windows this logger calculates metrics for. Call this function with no
+// argument to disable time-windowed metrics.
+//
+// Note: time-windowed metrics collected so far are discarded.
+//
+// @Available since <<VERSION>>
+func (logger *MemoryStoreMetricsLogger) SetTimeWindows(windows ...time.Duration) *MemoryStoreMetricsLogger {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	logger.windows = make([]time.Duration, len(windows))
+	copy(logger.windows, windows)
+	for _, store := range logger.storage {
+		store.setWindows(logger.windows)
+	}
+	return logger
+}
+
 // Put implements IMetricsLogger.Put
 func (logger *MemoryStoreMetricsLogger) Put(category string, cmd *CmdExecInfo) error {
 	return logger.getStore(category).put(cmd)
 }
 
 // Metrics implements IMetricsLogger.Metrics
+//
+// (since <<VERSION>>) Reading metrics of an unknown category returns empty metrics without creating the category.
 func (logger *MemoryStoreMetricsLogger) Metrics(category string, opts ...MetricsOpts) (*Metrics, error) {
-	s := logger.getStore(category)
+	s := logger.lookupStore(category)
+	if s == nil {
+		return &Metrics{Category: category, Windows: logger.emptyWindowsSnapshot()}, nil
+	}
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	h := s.histogramSnapshot()
 	m := &Metrics{
 		Category:         category,
 		TotalNumCmds:     h.Count(),
+		TotalCost:        s.totalCost,
 		ReservoirNumCmds: int64(s.size()),
 		MinCost:          float64(h.Min()),
 		MaxCost:          float64(h.Max()),
@@ -201,68 +301,142 @@ func (logger *MemoryStoreMetricsLogger) Metrics(category string, opts ...Metrics
 		P90Cost:          h.Percentile(0.90),
 		P75Cost:          h.Percentile(0.75),
 		P50Cost:          h.Percentile(0.50),
+		Windows:          s.windowsSnapshot(time.Now()),
 	}
-	if len(opts) > 0 && opts[0].ReturnLatestCommands > 0 && len(s.store) > 0 {
-		n, l := opts[0].ReturnLatestCommands, len(s.store)
-		if n > l {
-			n = l
+	if len(opts) > 0 && opts[0].ReturnLatestCommands > 0 && s.size() > 0 {
+		n := opts[0].ReturnLatestCommands
+		if n > s.size() {
+			n = s.size()
 		}
-		m.LastNCmds = make([]*CmdExecInfo, n)
-		copy(m.LastNCmds, s.store[l-n:l])
-		reserve(m.LastNCmds)
+		m.LastNCmds = s.appendLatest(make([]*CmdExecInfo, 0, n), n)
 	}
 	return m, nil
 }
 
-func (logger *MemoryStoreMetricsLogger) getStore(category string) *boundMemoryStackStore {
+// AppendLatestCommands appends at most n latest commands of a category to dst (newest first) and returns the
+// extended slice. Unlike Metrics, this function does not allocate if dst has enough capacity, which makes it
+// suitable for polling the latest commands frequently.
+//
+// @Available since <<VERSION>>
+func (logger *MemoryStoreMetricsLogger) AppendLatestCommands(dst []*CmdExecInfo, category string, n int) []*CmdExecInfo {
+	s := logger.lookupStore(category)
+	if s == nil {
+		return dst
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.appendLatest(dst, n)
+}
+
+// Categories implements IMetricsCategoryLister.Categories.
+//
+// @Available since <<VERSION>>
+func (logger *MemoryStoreMetricsLogger) Categories() []string {
+	logger.lock.RLock()
+	defer logger.lock.RUnlock()
+	result := make([]string, 0, len(logger.storage))
+	for category := range logger.storage {
+		result = append(result, category)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Reset implements IMetricsResetter.Reset.
+//
+// @Available since <<VERSION>>
+func (logger *MemoryStoreMetricsLogger) Reset(category string) {
 	logger.lock.Lock()
 	defer logger.lock.Unlock()
-	if logger.storage == nil {
-		logger.storage = make(map[string]*boundMemoryStackStore)
+	if _, ok := logger.storage[category]; ok {
+		logger.storage[category] = newBoundMemoryStackStore(logger.capacity, logger.windows)
 	}
-	store := logger.storage[category]
-	if store == nil {
-		store = newBoundMemoryStackStore(logger.capacity)
-		logger.storage[category] = store
+}
+
+// ResetAll implements IMetricsResetter.ResetAll.
+//
+// @Available since <<VERSION>>
+func (logger *MemoryStoreMetricsLogger) ResetAll() {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	for category := range logger.storage {
+		logger.storage[category] = newBoundMemoryStackStore(logger.capacity, logger.windows)
 	}
-	return store
 }
 
-/*----------------------------------------------------------------------*/
+// Remove implements IMetricsCategoryRemover.Remove.
+//
+// @Available since <<VERSION>>
+func (logger *MemoryStoreMetricsLogger) Remove(category string) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	delete(logger.storage, category)
+}
 
-func reserve(input []*CmdExecInfo) {
-	const batchSize = 100
-	inputMid := len(input) / 2
-	var wg sync.WaitGroup
-	for i := 0; i < inputMid; i += batchSize {
-		wg.Add(1)
-		j := i + batchSize
-		if j > inputMid {
-			j = inputMid
+// lookupStore returns the store of a category, nil if the category does not exist.
+func (logger *MemoryStoreMetricsLogger) lookupStore(category string) *boundMemoryStackStore {
+	logger.lock.RLock()
+	defer logger.lock.RUnlock()
+	return logger.storage[category]
+}
+
+// emptyWindowsSnapshot returns the time-windowed metrics of a category without commands.
+func (logger *MemoryStoreMetricsLogger) emptyWindowsSnapshot() []*WindowMetrics {
+	logger.lock.RLock()
+	defer logger.lock.RUnlock()
+	var result []*WindowMetrics
+	for _, w := range logger.windows {
+		if w > 0 {
+			result = append(result, &WindowMetrics{Window: w})
 		}
-		go reverseBatch(input, i, j, &wg)
 	}
-	wg.Wait()
+	return result
 }
 
-func reverseBatch(input []*CmdExecInfo, start, end int, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for i := start; i < end; i++ {
-		j := len(input) - i - 1
-		input[i], input[j] = input[j], input[i]
+// getStore returns the store of a category, creating it if the category does not exist.
+func (logger *MemoryStoreMetricsLogger) getStore(category string) *boundMemoryStackStore {
+	// fast path: the category's store already exists, only a read lock is needed
+	logger.lock.RLock()
+	store := logger.storage[category]
+	logger.lock.RUnlock()
+	if store != nil {
+		return store
+	}
+
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	if logger.storage == nil {
+		logger.storage = make(map[string]*boundMemoryStackStore)
+	}
+	store = logger.storage[category]
+	if store == nil {
+		store = newBoundMemoryStackStore(logger.capacity, logger.windows)
+		logger.storage[category] = store
 	}
+	return store
 }
 
-func newBoundMemoryStackStore(capacity int) *boundMemoryStackStore {
+/*----------------------------------------------------------------------*/
+
+func newBoundMemoryStackStore(capacity int, windows []time.Duration) *boundMemoryStackStore {
 	return &boundMemoryStackStore{
-		store:     make([]*CmdExecInfo, 0, capacity),
+		items:     make([]*CmdExecInfo, capacity),
 		histogram: metrics.NewHistogram(metrics.NewExpDecaySample(capacity, 0.015)),
+		windows:   newTimeWindows(windows),
+		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// boundMemoryStackStore keeps the latest commands in a fixed-size ring buffer: items[next] is the slot to be written
+// next, the newest command is at items[next-1] and the oldest one (once the buffer is full) is at items[next].
 type boundMemoryStackStore struct {
 	histogram metrics.Histogram
-	store     []*CmdExecInfo
+	items     []*CmdExecInfo
+	next      int
+	count     int
+	totalCost float64
+	windows   []*timeWindow
+	rnd       *rand.Rand
 	lock      sync.Mutex
 }
 
@@ -272,20 +446,63 @@ func (s *boundMemoryStackStore) put(item *CmdExecInfo) error {
 	}
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	c := cap(s.store)
-	l := len(s.store)
-	if l >= c {
-		copy(s.store, s.store[1:])
-		l--
+	s.items[s.next] = item
+	if s.next++; s.next == len(s.items) {
+		s.next = 0
+	}
+	if s.count < len(s.items) {
+		s.count++
 	}
-	s.store = s.store[0 : l+1]
-	s.store[l] = item
 	s.histogram.Update(int64(item.Cost))
+	s.totalCost += item.Cost
+	if len(s.windows) > 0 {
+		t := item.EndTime
+		if t.IsZero() {
+			t = time.Now()
+		}
+		isError := item.Result == CmdResultError || item.Result == CmdResultRejected
+		for _, w := range s.windows {
+			w.put(t, item.Cost, isError, s.rnd)
+		}
+	}
 	return nil
 }
 
+// appendLatest appends at most n latest commands to dst, newest first.
+// This function must be called with the store's lock held.
+func (s *boundMemoryStackStore) appendLatest(dst []*CmdExecInfo, n int) []*CmdExecInfo {
+	if n > s.count {
+		n = s.count
+	}
+	for i, idx := 0, s.next; i < n; i++ {
+		if idx--; idx < 0 {
+			idx = len(s.items) - 1
+		}
+		dst = append(dst, s.items[idx])
+	}
+	return dst
+}
+
+func (s *boundMemoryStackStore) setWindows(windows []time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.windows = newTimeWindows(windows)
+}
+
+// windowsSnapshot must be called with the store's lock held.
+func (s *boundMemoryStackStore) windowsSnapshot(now time.Time) []*WindowMetrics {
+	if len(s.windows) == 0 {
+		return nil
+	}
+	result := make([]*WindowMetrics, len(s.windows))
+	for i, w := range s.windows {
+		result[i] = w.snapshot(now)
+	}
+	return result
+}
+
 func (s *boundMemoryStackStore) size() int {
-	return len(s.store)
+	return s.count
 }
 
 func (s *boundMemoryStackStore) histogramSnapshot() metrics.Histogram {
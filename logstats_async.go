@@ -0,0 +1,324 @@
+package prom
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// MetricsRecord is a command logged under a metrics category.
+//
+// @Available since <<VERSION>>
+type MetricsRecord struct {
+	Category string
+	Cmd      *CmdExecInfo
+}
+
+// IMetricsBatchLogger is an optional interface an IMetricsLogger can implement to store multiple commands at once.
+//
+// @Available since <<VERSION>>
+type IMetricsBatchLogger interface {
+	// PutBatch stores a batch of commands.
+	PutBatch(records []MetricsRecord) error
+}
+
+// AsyncPolicy specifies what AsyncMetricsLogger does when its queue is full.
+//
+// @Available since <<VERSION>>
+type AsyncPolicy int
+
+const (
+	// AsyncPolicyDrop drops the command being put if the queue is full.
+	AsyncPolicyDrop AsyncPolicy = iota
+
+	// AsyncPolicyBlock blocks the caller until there is room in the queue.
+	AsyncPolicyBlock
+)
+
+const (
+	defaultAsyncQueueSize = 4096
+	defaultAsyncBatchSize = 128
+)
+
+// AsyncMetricsLoggerOpts configures an AsyncMetricsLogger.
+//
+// @Available since <<VERSION>>
+type AsyncMetricsLoggerOpts struct {
+	// Maximum number of commands waiting in the queue. Default value is 4096.
+	QueueSize int `json:"queue_size"`
+
+	// What to do when the queue is full. Default value is AsyncPolicyDrop.
+	Policy AsyncPolicy `json:"policy"`
+
+	// Maximum number of commands delivered to the wrapped logger at once. Default value is 128.
+	BatchSize int `json:"batch_size"`
+}
+
+// AsyncMetricsLoggerStats holds counters of an AsyncMetricsLogger.
+//
+// @Available since <<VERSION>>
+type AsyncMetricsLoggerStats struct {
+	// Number of commands accepted into the queue.
+	Queued int64 `json:"queued"`
+
+	// Number of commands dropped because the queue was full.
+	Dropped int64 `json:"dropped"`
+
+	// Number of commands delivered to the wrapped logger successfully.
+	Delivered int64 `json:"delivered"`
+
+	// Number of commands the wrapped logger failed to store.
+	Failed int64 `json:"failed"`
+}
+
+// NewAsyncMetricsLogger wraps an IMetricsLogger so that commands are put to it asynchronously by a background
+// goroutine. Call Close to flush pending commands and stop the background goroutine.
+//
+// @Available since <<VERSION>>
+func NewAsyncMetricsLogger(logger IMetricsLogger, opts AsyncMetricsLoggerOpts) *AsyncMetricsLogger {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultAsyncQueueSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultAsyncBatchSize
+	}
+	a := &AsyncMetricsLogger{
+		logger: logger,
+		opts:   opts,
+		queue:  make(chan asyncMetricsRecord, opts.QueueSize),
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// AsyncMetricsLogger is an IMetricsLogger that puts commands to a wrapped logger asynchronously, so that logging
+// metrics does not add lock contention or I/O to the command execution path.
+//
+// Commands are queued in a bounded queue and delivered in batches by a background goroutine (via
+// IMetricsBatchLogger.PutBatch if the wrapped logger implements it). When the queue is full, commands are either
+// dropped or the caller is blocked, depending on AsyncMetricsLoggerOpts.Policy.
+//
+// Metrics returned by AsyncMetricsLogger are eventually consistent: commands still in the queue are not reflected.
+// Call Flush to wait for queued commands to be delivered.
+//
+// @Available since <<VERSION>>
+type AsyncMetricsLogger struct {
+	// counters are placed first to guarantee 64-bit alignment for atomic operations
+	queued, dropped, delivered, failed int64
+	closed                             int32
+
+	logger    IMetricsLogger
+	opts      AsyncMetricsLoggerOpts
+	queue     chan asyncMetricsRecord
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+type asyncMetricsRecord struct {
+	MetricsRecord
+	ack chan struct{} // non-nil for flush markers
+}
+
+// Logger returns the wrapped logger.
+func (a *AsyncMetricsLogger) Logger() IMetricsLogger {
+	return a.logger
+}
+
+// Opts returns the options this logger was created with.
+func (a *AsyncMetricsLogger) Opts() AsyncMetricsLoggerOpts {
+	return a.opts
+}
+
+// Stats returns a snapshot of the counters.
+func (a *AsyncMetricsLogger) Stats() AsyncMetricsLoggerStats {
+	return AsyncMetricsLoggerStats{
+		Queued:    atomic.LoadInt64(&a.queued),
+		Dropped:   atomic.LoadInt64(&a.dropped),
+		Delivered: atomic.LoadInt64(&a.delivered),
+		Failed:    atomic.LoadInt64(&a.failed),
+	}
+}
+
+// Dropped returns the number of commands dropped because the queue was full.
+func (a *AsyncMetricsLogger) Dropped() int64 {
+	return atomic.LoadInt64(&a.dropped)
+}
+
+// Put implements IMetricsLogger.Put.
+//
+// This function returns ErrMetricsLoggerClosed if the logger has been closed. Dropped commands are not reported as
+// errors, they are counted instead (see Dropped).
+func (a *AsyncMetricsLogger) Put(category string, cmd *CmdExecInfo) error {
+	if cmd == nil {
+		return errors.New("nil input")
+	}
+	if atomic.LoadInt32(&a.closed) != 0 {
+		return ErrMetricsLoggerClosed
+	}
+	r := asyncMetricsRecord{MetricsRecord: MetricsRecord{Category: category, Cmd: cmd}}
+	if a.opts.Policy == AsyncPolicyBlock {
+		select {
+		case a.queue <- r:
+		case <-a.stopCh:
+			return ErrMetricsLoggerClosed
+		}
+	} else {
+		select {
+		case a.queue <- r:
+		default:
+			atomic.AddInt64(&a.dropped, 1)
+			return nil
+		}
+	}
+	atomic.AddInt64(&a.queued, 1)
+	return nil
+}
+
+// Metrics implements IMetricsLogger.Metrics.
+func (a *AsyncMetricsLogger) Metrics(category string, opts ...MetricsOpts) (*Metrics, error) {
+	return a.logger.Metrics(category, opts...)
+}
+
+// Categories implements IMetricsCategoryLister.Categories.
+// This function returns nil if the wrapped logger does not implement IMetricsCategoryLister.
+func (a *AsyncMetricsLogger) Categories() []string {
+	if lister, ok := a.logger.(IMetricsCategoryLister); ok {
+		return lister.Categories()
+	}
+	return nil
+}
+
+// Reset implements IMetricsResetter.Reset.
+// Queued commands are flushed before the wrapped logger is reset. This function does nothing if the wrapped logger
+// does not implement IMetricsResetter.
+func (a *AsyncMetricsLogger) Reset(category string) {
+	if resetter, ok := a.logger.(IMetricsResetter); ok {
+		_ = a.Flush()
+		resetter.Reset(category)
+	}
+}
+
+// ResetAll implements IMetricsResetter.ResetAll.
+// Queued commands are flushed before the wrapped logger is reset. This function does nothing if the wrapped logger
+// does not implement IMetricsResetter.
+func (a *AsyncMetricsLogger) ResetAll() {
+	if resetter, ok := a.logger.(IMetricsResetter); ok {
+		_ = a.Flush()
+		resetter.ResetAll()
+	}
+}
+
+// Remove implements IMetricsCategoryRemover.Remove.
+// Queued commands are flushed before the category is removed. This function does nothing if the wrapped logger
+// does not implement IMetricsCategoryRemover.
+func (a *AsyncMetricsLogger) Remove(category string) {
+	if remover, ok := a.logger.(IMetricsCategoryRemover); ok {
+		_ = a.Flush()
+		remover.Remove(category)
+	}
+}
+
+// Flush blocks until all commands queued before the call have been delivered to the wrapped logger.
+// This function returns ErrMetricsLoggerClosed if the logger has been closed.
+func (a *AsyncMetricsLogger) Flush() error {
+	if atomic.LoadInt32(&a.closed) != 0 {
+		return ErrMetricsLoggerClosed
+	}
+	ack := make(chan struct{})
+	select {
+	case a.queue <- asyncMetricsRecord{ack: ack}:
+	case <-a.stopCh:
+		return ErrMetricsLoggerClosed
+	}
+	select {
+	case <-ack:
+	case <-a.doneCh:
+	}
+	return nil
+}
+
+// Close stops accepting new commands, delivers queued commands to the wrapped logger and stops the background
+// goroutine. Commands put concurrently with Close may be dropped.
+func (a *AsyncMetricsLogger) Close() error {
+	a.closeOnce.Do(func() {
+		atomic.StoreInt32(&a.closed, 1)
+		close(a.stopCh)
+	})
+	<-a.doneCh
+	return nil
+}
+
+func (a *AsyncMetricsLogger) run() {
+	defer close(a.doneCh)
+	batch := make([]MetricsRecord, 0, a.opts.BatchSize)
+	for {
+		select {
+		case r := <-a.queue:
+			batch = a.collect(r, batch)
+		case <-a.stopCh:
+			for {
+				select {
+				case r := <-a.queue:
+					batch = a.collect(r, batch)
+				default:
+					a.deliver(batch)
+					return
+				}
+			}
+		}
+		// drain whatever is immediately available, up to the batch size
+	drain:
+		for len(batch) < a.opts.BatchSize {
+			select {
+			case r := <-a.queue:
+				batch = a.collect(r, batch)
+			default:
+				break drain
+			}
+		}
+		batch = a.deliver(batch)
+	}
+}
+
+// collect appends a record to the batch. A flush marker causes the current batch to be delivered and acknowledged.
+func (a *AsyncMetricsLogger) collect(r asyncMetricsRecord, batch []MetricsRecord) []MetricsRecord {
+	if r.ack != nil {
+		batch = a.deliver(batch)
+		close(r.ack)
+		return batch
+	}
+	batch = append(batch, r.MetricsRecord)
+	if len(batch) >= a.opts.BatchSize {
+		batch = a.deliver(batch)
+	}
+	return batch
+}
+
+// deliver puts the batch to the wrapped logger and returns the emptied batch for reuse.
+func (a *AsyncMetricsLogger) deliver(batch []MetricsRecord) []MetricsRecord {
+	if len(batch) == 0 {
+		return batch
+	}
+	if batchLogger, ok := a.logger.(IMetricsBatchLogger); ok {
+		if err := batchLogger.PutBatch(batch); err != nil {
+			atomic.AddInt64(&a.failed, int64(len(batch)))
+		} else {
+			atomic.AddInt64(&a.delivered, int64(len(batch)))
+		}
+	} else {
+		for _, r := range batch {
+			if err := a.logger.Put(r.Category, r.Cmd); err != nil {
+				atomic.AddInt64(&a.failed, 1)
+			} else {
+				atomic.AddInt64(&a.delivered, 1)
+			}
+		}
+	}
+	for i := range batch {
+		batch[i] = MetricsRecord{}
+	}
+	return batch[:0]
+}
@@ -0,0 +1,160 @@
+package prom
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type testBlockingMetricsLogger struct {
+	IMetricsLogger
+	release chan struct{}
+	err     error
+}
+
+func (l *testBlockingMetricsLogger) Put(category string, cmd *CmdExecInfo) error {
+	<-l.release
+	if l.err != nil {
+		return l.err
+	}
+	return l.IMetricsLogger.Put(category, cmd)
+}
+
+type testBatchMetricsLogger struct {
+	IMetricsLogger
+	lock    sync.Mutex
+	batches []int
+}
+
+func (l *testBatchMetricsLogger) PutBatch(records []MetricsRecord) error {
+	l.lock.Lock()
+	l.batches = append(l.batches, len(records))
+	l.lock.Unlock()
+	for _, r := range records {
+		_ = l.IMetricsLogger.Put(r.Category, r.Cmd)
+	}
+	return nil
+}
+
+func TestNewAsyncMetricsLogger(t *testing.T) {
+	testName := "TestNewAsyncMetricsLogger"
+	memLogger := NewMemoryStoreMetricsLogger(10)
+	logger := NewAsyncMetricsLogger(memLogger, AsyncMetricsLoggerOpts{})
+	defer func() { _ = logger.Close() }()
+	if logger.Logger() != memLogger {
+		t.Fatalf("%s failed: wrapped logger mismatched", testName)
+	}
+	if opts := logger.Opts(); opts.QueueSize != defaultAsyncQueueSize || opts.BatchSize != defaultAsyncBatchSize || opts.Policy != AsyncPolicyDrop {
+		t.Fatalf("%s failed: default options not applied %#v", testName, opts)
+	}
+	_ = logger.Put(MetricsCatDQL, &CmdExecInfo{Id: "1"})
+	_ = logger.Flush()
+	if cats := logger.Categories(); len(cats) != 1 || cats[0] != MetricsCatDQL {
+		t.Fatalf("%s failed: unexpected categories %#v", testName, cats)
+	}
+}
+
+func TestAsyncMetricsLogger_PutAndClose(t *testing.T) {
+	testName := "TestAsyncMetricsLogger_PutAndClose"
+	memLogger := NewMemoryStoreMetricsLogger(1000)
+	logger := NewAsyncMetricsLogger(memLogger, AsyncMetricsLoggerOpts{QueueSize: 16, Policy: AsyncPolicyBlock, BatchSize: 8})
+	if err := logger.Put(MetricsCatAll, nil); err == nil {
+		t.Fatalf("%s failed: expected error when putting nil command", testName)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = logger.Put(MetricsCatAll, &CmdExecInfo{Id: strconv.Itoa(i*100 + j)})
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := logger.Close(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if m, _ := logger.Metrics(MetricsCatAll); m.TotalNumCmds != 1000 {
+		t.Fatalf("%s failed: expected %#v commands but received %#v", testName, 1000, m.TotalNumCmds)
+	}
+	if stats := logger.Stats(); stats.Queued != 1000 || stats.Delivered != 1000 || stats.Dropped != 0 || stats.Failed != 0 {
+		t.Fatalf("%s failed: unexpected stats %#v", testName, stats)
+	}
+	if err := logger.Put(MetricsCatAll, &CmdExecInfo{}); !errors.Is(err, ErrMetricsLoggerClosed) {
+		t.Fatalf("%s failed: expected error %s but received %s", testName, ErrMetricsLoggerClosed, err)
+	}
+	if err := logger.Flush(); !errors.Is(err, ErrMetricsLoggerClosed) {
+		t.Fatalf("%s failed: expected error %s but received %s", testName, ErrMetricsLoggerClosed, err)
+	}
+	_ = logger.Close()
+}
+
+func TestAsyncMetricsLogger_Drop(t *testing.T) {
+	testName := "TestAsyncMetricsLogger_Drop"
+	blockingLogger := &testBlockingMetricsLogger{IMetricsLogger: NewMemoryStoreMetricsLogger(100), release: make(chan struct{})}
+	logger := NewAsyncMetricsLogger(blockingLogger, AsyncMetricsLoggerOpts{QueueSize: 4, BatchSize: 1})
+	for i := 0; i < 20; i++ {
+		if err := logger.Put(MetricsCatAll, &CmdExecInfo{Id: strconv.Itoa(i)}); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+	}
+	// worker holds at most 1 record, queue holds at most 4
+	if dropped := logger.Dropped(); dropped < 15 {
+		t.Fatalf("%s failed: expected at least %#v dropped commands but received %#v", testName, 15, dropped)
+	}
+	close(blockingLogger.release)
+	_ = logger.Close()
+	stats := logger.Stats()
+	if stats.Queued+stats.Dropped != 20 || stats.Delivered != stats.Queued {
+		t.Fatalf("%s failed: unexpected stats %#v", testName, stats)
+	}
+}
+
+func TestAsyncMetricsLogger_Failed(t *testing.T) {
+	testName := "TestAsyncMetricsLogger_Failed"
+	release := make(chan struct{})
+	close(release)
+	failingLogger := &testBlockingMetricsLogger{IMetricsLogger: NewMemoryStoreMetricsLogger(100), release: release, err: errors.New("dummy")}
+	logger := NewAsyncMetricsLogger(failingLogger, AsyncMetricsLoggerOpts{})
+	_ = logger.Put(MetricsCatAll, &CmdExecInfo{Id: "1"})
+	_ = logger.Close()
+	if stats := logger.Stats(); stats.Failed != 1 || stats.Delivered != 0 {
+		t.Fatalf("%s failed: unexpected stats %#v", testName, stats)
+	}
+}
+
+func TestAsyncMetricsLogger_Flush(t *testing.T) {
+	testName := "TestAsyncMetricsLogger_Flush"
+	batchLogger := &testBatchMetricsLogger{IMetricsLogger: NewMemoryStoreMetricsLogger(100)}
+	logger := NewAsyncMetricsLogger(batchLogger, AsyncMetricsLoggerOpts{BatchSize: 10})
+	defer func() { _ = logger.Close() }()
+	for i := 0; i < 25; i++ {
+		_ = logger.Put(MetricsCatDQL, &CmdExecInfo{Id: strconv.Itoa(i)})
+	}
+	if err := logger.Flush(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if m, _ := logger.Metrics(MetricsCatDQL); m.TotalNumCmds != 25 {
+		t.Fatalf("%s failed: expected %#v commands but received %#v", testName, 25, m.TotalNumCmds)
+	}
+	batchLogger.lock.Lock()
+	defer batchLogger.lock.Unlock()
+	total := 0
+	for _, n := range batchLogger.batches {
+		if n > 10 {
+			t.Fatalf("%s failed: batch size %#v exceeds %#v", testName, n, 10)
+		}
+		total += n
+	}
+	if total != 25 {
+		t.Fatalf("%s failed: expected %#v commands delivered in batches but received %#v", testName, 25, total)
+	}
+}
+
+func TestAsyncMetricsLogger_ResetAndRemove(t *testing.T) {
+	logger := NewAsyncMetricsLogger(NewMemoryStoreMetricsLogger(10), AsyncMetricsLoggerOpts{})
+	defer func() { _ = logger.Close() }()
+	testMetricsResetAndRemove(t, "TestAsyncMetricsLogger_ResetAndRemove", logger, func() { _ = logger.Flush() })
+}
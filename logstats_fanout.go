@@ -0,0 +1,322 @@
+package prom
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+)
+
+// FanoutSink is a destination of a FanoutMetricsLogger.
+//
+// @Available since <<VERSION>>
+type FanoutSink struct {
+	// Name of the sink, must be unique within a FanoutMetricsLogger.
+	Name string
+
+	// The logger commands are put to.
+	Logger IMetricsLogger
+
+	// Only commands of these categories are routed to the sink. Empty means all categories.
+	Categories []string
+
+	// Optional filter, commands are routed to the sink only if the filter returns true.
+	// Filter is applied after Categories.
+	Filter func(category string, cmd *CmdExecInfo) bool
+}
+
+// FanoutMetricsPolicy decides which sink of a FanoutMetricsLogger answers Metrics calls.
+//
+// @Available since <<VERSION>>
+type FanoutMetricsPolicy int
+
+const (
+	// FanoutMetricsFirst answers Metrics with the first sink (in the order sinks were added) that accepts the category
+	// and returns metrics without error.
+	FanoutMetricsFirst FanoutMetricsPolicy = iota
+
+	// FanoutMetricsNamed answers Metrics with the sink named FanoutMetricsLoggerOpts.MetricsSink.
+	FanoutMetricsNamed
+
+	// FanoutMetricsMostCmds answers Metrics with the sink, among those accepting the category, that reports the
+	// largest total number of commands.
+	FanoutMetricsMostCmds
+)
+
+// FanoutMetricsLoggerOpts configures a FanoutMetricsLogger.
+//
+// @Available since <<VERSION>>
+type FanoutMetricsLoggerOpts struct {
+	// Which sink answers Metrics calls. Default value is FanoutMetricsFirst.
+	MetricsPolicy FanoutMetricsPolicy
+
+	// Name of the sink answering Metrics calls, used with FanoutMetricsNamed.
+	MetricsSink string
+
+	// Optional callback invoked when a sink fails to store a command (either by returning an error or panicking).
+	OnError func(sink string, category string, cmd *CmdExecInfo, err error)
+}
+
+// FanoutSinkStats holds counters of a sink of a FanoutMetricsLogger.
+//
+// @Available since <<VERSION>>
+type FanoutSinkStats struct {
+	// Name of the sink.
+	Name string `json:"name"`
+
+	// Number of commands stored by the sink successfully.
+	Delivered int64 `json:"delivered"`
+
+	// Number of commands the sink failed to store.
+	Failed int64 `json:"failed"`
+}
+
+// ErrNoMetricsSink is returned by FanoutMetricsLogger.Metrics when no sink can answer the call.
+//
+// @Available since <<VERSION>>
+var ErrNoMetricsSink = errors.New("no sink available to answer metrics")
+
+// NewFanoutMetricsLogger creates a new FanoutMetricsLogger instance. This function returns error if a sink has no
+// name or no logger, or if sink names are duplicated.
+//
+// @Available since <<VERSION>>
+func NewFanoutMetricsLogger(opts FanoutMetricsLoggerOpts, sinks ...FanoutSink) (*FanoutMetricsLogger, error) {
+	logger := &FanoutMetricsLogger{opts: opts, sinks: make([]*fanoutSink, 0, len(sinks))}
+	names := make(map[string]bool)
+	for _, sink := range sinks {
+		if sink.Name == "" || sink.Logger == nil {
+			return nil, errors.New("sink must have a name and a logger")
+		}
+		if names[sink.Name] {
+			return nil, fmt.Errorf("duplicated sink name <%s>", sink.Name)
+		}
+		names[sink.Name] = true
+		s := &fanoutSink{FanoutSink: sink}
+		if len(sink.Categories) > 0 {
+			s.categories = make(map[string]struct{}, len(sink.Categories))
+			for _, category := range sink.Categories {
+				s.categories[category] = struct{}{}
+			}
+		}
+		logger.sinks = append(logger.sinks, s)
+	}
+	if opts.MetricsPolicy == FanoutMetricsNamed && !names[opts.MetricsSink] {
+		return nil, fmt.Errorf("metrics sink <%s> not found", opts.MetricsSink)
+	}
+	return logger, nil
+}
+
+// FanoutMetricsLogger is an IMetricsLogger that puts each command to multiple sinks, routing commands to sinks by
+// category (e.g. DDL commands to an audit sink).
+//
+// Sinks are isolated from each other: an error returned, or a panic raised, by a sink (or its filter) is counted (see
+// Stats) and reported to FanoutMetricsLoggerOpts.OnError, but does not stop other sinks from receiving the command and
+// is not returned by Put.
+//
+// @Available since <<VERSION>>
+type FanoutMetricsLogger struct {
+	opts  FanoutMetricsLoggerOpts
+	sinks []*fanoutSink
+}
+
+type fanoutSink struct {
+	FanoutSink
+	delivered, failed int64
+	categories        map[string]struct{}
+}
+
+// routes checks if the sink's categories include the specified one.
+func (sink *fanoutSink) routes(category string) bool {
+	if sink.categories == nil {
+		return true
+	}
+	_, ok := sink.categories[category]
+	return ok
+}
+
+func (sink *fanoutSink) accept(category string, cmd *CmdExecInfo) bool {
+	return sink.routes(category) && (sink.Filter == nil || sink.Filter(category, cmd))
+}
+
+// Opts returns the options this logger was created with.
+func (logger *FanoutMetricsLogger) Opts() FanoutMetricsLoggerOpts {
+	return logger.opts
+}
+
+// Sink returns the logger of the sink with the specified name, nil if not found.
+func (logger *FanoutMetricsLogger) Sink(name string) IMetricsLogger {
+	if s := logger.sink(name); s != nil {
+		return s.Logger
+	}
+	return nil
+}
+
+func (logger *FanoutMetricsLogger) sink(name string) *fanoutSink {
+	for _, s := range logger.sinks {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Stats returns counters of all sinks, in the order sinks were added.
+func (logger *FanoutMetricsLogger) Stats() []FanoutSinkStats {
+	result := make([]FanoutSinkStats, len(logger.sinks))
+	for i, s := range logger.sinks {
+		result[i] = FanoutSinkStats{
+			Name:      s.Name,
+			Delivered: atomic.LoadInt64(&s.delivered),
+			Failed:    atomic.LoadInt64(&s.failed),
+		}
+	}
+	return result
+}
+
+// Put implements IMetricsLogger.Put.
+//
+// This function returns error only if the input command is nil; failures of sinks are not returned.
+func (logger *FanoutMetricsLogger) Put(category string, cmd *CmdExecInfo) error {
+	if cmd == nil {
+		return errors.New("nil input")
+	}
+	for _, s := range logger.sinks {
+		accepted, err := s.safePut(category, cmd)
+		if !accepted {
+			continue
+		}
+		if err != nil {
+			atomic.AddInt64(&s.failed, 1)
+			if logger.opts.OnError != nil {
+				logger.opts.OnError(s.Name, category, cmd, err)
+			}
+		} else {
+			atomic.AddInt64(&s.delivered, 1)
+		}
+	}
+	return nil
+}
+
+// safePut puts a command to the sink if the sink accepts it. A panic raised by the sink's filter or logger is
+// recovered and returned as an error (the command is then considered accepted).
+func (sink *fanoutSink) safePut(category string, cmd *CmdExecInfo) (accepted bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			accepted, err = true, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if !sink.accept(category, cmd) {
+		return false, nil
+	}
+	return true, sink.Logger.Put(category, cmd)
+}
+
+func safeMetrics(logger IMetricsLogger, category string, opts ...MetricsOpts) (m *Metrics, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			m, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return logger.Metrics(category, opts...)
+}
+
+// Metrics implements IMetricsLogger.Metrics.
+//
+// The sink answering the call is selected according to FanoutMetricsLoggerOpts.MetricsPolicy. This function returns
+// ErrNoMetricsSink if no sink accepts the category.
+func (logger *FanoutMetricsLogger) Metrics(category string, opts ...MetricsOpts) (*Metrics, error) {
+	switch logger.opts.MetricsPolicy {
+	case FanoutMetricsNamed:
+		return safeMetrics(logger.sink(logger.opts.MetricsSink).Logger, category, opts...)
+	case FanoutMetricsMostCmds:
+		var result *Metrics
+		for _, s := range logger.sinks {
+			if !s.routes(category) {
+				continue
+			}
+			if m, err := safeMetrics(s.Logger, category, opts...); err == nil && m != nil && (result == nil || m.TotalNumCmds > result.TotalNumCmds) {
+				result = m
+			}
+		}
+		if result == nil {
+			return nil, ErrNoMetricsSink
+		}
+		return result, nil
+	default:
+		var lastErr error = ErrNoMetricsSink
+		for _, s := range logger.sinks {
+			if !s.routes(category) {
+				continue
+			}
+			m, err := safeMetrics(s.Logger, category, opts...)
+			if err == nil && m != nil {
+				return m, nil
+			}
+			if err != nil {
+				lastErr = err
+			}
+		}
+		return nil, lastErr
+	}
+}
+
+// Categories implements IMetricsCategoryLister.Categories, returning the union of categories of all sinks that
+// implement IMetricsCategoryLister.
+func (logger *FanoutMetricsLogger) Categories() []string {
+	set := make(map[string]bool)
+	for _, s := range logger.sinks {
+		if lister, ok := s.Logger.(IMetricsCategoryLister); ok {
+			for _, category := range lister.Categories() {
+				set[category] = true
+			}
+		}
+	}
+	result := make([]string, 0, len(set))
+	for category := range set {
+		result = append(result, category)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Reset implements IMetricsResetter.Reset, resetting the category of all sinks that implement IMetricsResetter.
+func (logger *FanoutMetricsLogger) Reset(category string) {
+	for _, s := range logger.sinks {
+		if resetter, ok := s.Logger.(IMetricsResetter); ok {
+			resetter.Reset(category)
+		}
+	}
+}
+
+// ResetAll implements IMetricsResetter.ResetAll, resetting all sinks that implement IMetricsResetter.
+func (logger *FanoutMetricsLogger) ResetAll() {
+	for _, s := range logger.sinks {
+		if resetter, ok := s.Logger.(IMetricsResetter); ok {
+			resetter.ResetAll()
+		}
+	}
+}
+
+// Remove implements IMetricsCategoryRemover.Remove, removing the category from all sinks that implement
+// IMetricsCategoryRemover.
+func (logger *FanoutMetricsLogger) Remove(category string) {
+	for _, s := range logger.sinks {
+		if remover, ok := s.Logger.(IMetricsCategoryRemover); ok {
+			remover.Remove(category)
+		}
+	}
+}
+
+// Close closes all sinks that implement io.Closer, returning the first error encountered.
+func (logger *FanoutMetricsLogger) Close() error {
+	var result error
+	for _, s := range logger.sinks {
+		if closer, ok := s.Logger.(io.Closer); ok {
+			if err := closer.Close(); err != nil && result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
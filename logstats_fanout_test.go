@@ -0,0 +1,185 @@
+package prom
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testFailingMetricsLogger struct {
+	panic bool
+}
+
+func (l *testFailingMetricsLogger) Put(string, *CmdExecInfo) error {
+	if l.panic {
+		panic("dummy")
+	}
+	return errors.New("dummy")
+}
+
+func (l *testFailingMetricsLogger) Metrics(string, ...MetricsOpts) (*Metrics, error) {
+	if l.panic {
+		panic("dummy")
+	}
+	return nil, errors.New("dummy")
+}
+
+func TestNewFanoutMetricsLogger(t *testing.T) {
+	testName := "TestNewFanoutMetricsLogger"
+	memLogger := NewMemoryStoreMetricsLogger(10)
+	if _, err := NewFanoutMetricsLogger(FanoutMetricsLoggerOpts{}, FanoutSink{Logger: memLogger}); err == nil {
+		t.Fatalf("%s failed: expected error when sink has no name", testName)
+	}
+	if _, err := NewFanoutMetricsLogger(FanoutMetricsLoggerOpts{}, FanoutSink{Name: "mem"}); err == nil {
+		t.Fatalf("%s failed: expected error when sink has no logger", testName)
+	}
+	if _, err := NewFanoutMetricsLogger(FanoutMetricsLoggerOpts{}, FanoutSink{Name: "mem", Logger: memLogger}, FanoutSink{Name: "mem", Logger: memLogger}); err == nil {
+		t.Fatalf("%s failed: expected error when sink names are duplicated", testName)
+	}
+	if _, err := NewFanoutMetricsLogger(FanoutMetricsLoggerOpts{MetricsPolicy: FanoutMetricsNamed, MetricsSink: "file"}, FanoutSink{Name: "mem", Logger: memLogger}); err == nil {
+		t.Fatalf("%s failed: expected error when metrics sink does not exist", testName)
+	}
+	logger, err := NewFanoutMetricsLogger(FanoutMetricsLoggerOpts{}, FanoutSink{Name: "mem", Logger: memLogger})
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if logger.Sink("mem") != memLogger || logger.Sink("file") != nil {
+		t.Fatalf("%s failed: sink lookup mismatched", testName)
+	}
+}
+
+func TestFanoutMetricsLogger_Put(t *testing.T) {
+	testName := "TestFanoutMetricsLogger_Put"
+	all := NewMemoryStoreMetricsLogger(10)
+	audit := NewMemoryStoreMetricsLogger(10)
+	errorsOnly := NewMemoryStoreMetricsLogger(10)
+	sinkErrors := make(map[string]int)
+	logger, _ := NewFanoutMetricsLogger(FanoutMetricsLoggerOpts{OnError: func(sink string, _ string, _ *CmdExecInfo, _ error) { sinkErrors[sink]++ }},
+		FanoutSink{Name: "failing", Logger: &testFailingMetricsLogger{}},
+		FanoutSink{Name: "panicking", Logger: &testFailingMetricsLogger{panic: true}},
+		FanoutSink{Name: "all", Logger: all},
+		FanoutSink{Name: "audit", Logger: audit, Categories: []string{MetricsCatDDL}},
+		FanoutSink{Name: "errors", Logger: errorsOnly, Filter: func(_ string, cmd *CmdExecInfo) bool { return cmd.Result == CmdResultError }},
+		FanoutSink{Name: "panicking_filter", Logger: NewMemoryStoreMetricsLogger(10), Filter: func(_ string, cmd *CmdExecInfo) bool {
+			if cmd.Id == "2" {
+				panic("dummy")
+			}
+			return true
+		}},
+	)
+	if err := logger.Put(MetricsCatAll, nil); err == nil {
+		t.Fatalf("%s failed: expected error when putting nil command", testName)
+	}
+	_ = logger.Put(MetricsCatDDL, &CmdExecInfo{Id: "1", Result: CmdResultOk})
+	_ = logger.Put(MetricsCatDML, &CmdExecInfo{Id: "2", Result: CmdResultError})
+	if err := logger.Put(MetricsCatDQL, &CmdExecInfo{Id: "3", Result: CmdResultOk}); err != nil {
+		t.Fatalf("%s failed: failing sinks must not break Put, received %s", testName, err)
+	}
+
+	if !reflect.DeepEqual(all.(IMetricsCategoryLister).Categories(), []string{MetricsCatDDL, MetricsCatDML, MetricsCatDQL}) {
+		t.Fatalf("%s failed: unexpected categories of sink <all> %#v", testName, all.(IMetricsCategoryLister).Categories())
+	}
+	if !reflect.DeepEqual(audit.(IMetricsCategoryLister).Categories(), []string{MetricsCatDDL}) {
+		t.Fatalf("%s failed: unexpected categories of sink <audit> %#v", testName, audit.(IMetricsCategoryLister).Categories())
+	}
+	if !reflect.DeepEqual(errorsOnly.(IMetricsCategoryLister).Categories(), []string{MetricsCatDML}) {
+		t.Fatalf("%s failed: unexpected categories of sink <errors> %#v", testName, errorsOnly.(IMetricsCategoryLister).Categories())
+	}
+	if sinkErrors["failing"] != 3 || sinkErrors["panicking"] != 3 || sinkErrors["panicking_filter"] != 1 {
+		t.Fatalf("%s failed: unexpected sink errors %#v", testName, sinkErrors)
+	}
+	expectedStats := []FanoutSinkStats{
+		{Name: "failing", Failed: 3},
+		{Name: "panicking", Failed: 3},
+		{Name: "all", Delivered: 3},
+		{Name: "audit", Delivered: 1},
+		{Name: "errors", Delivered: 1},
+		{Name: "panicking_filter", Delivered: 2, Failed: 1},
+	}
+	if stats := logger.Stats(); !reflect.DeepEqual(stats, expectedStats) {
+		t.Fatalf("%s failed: expected %#v but received %#v", testName, expectedStats, stats)
+	}
+	if cats := logger.Categories(); !reflect.DeepEqual(cats, []string{MetricsCatDDL, MetricsCatDML, MetricsCatDQL}) {
+		t.Fatalf("%s failed: unexpected categories %#v", testName, cats)
+	}
+}
+
+func TestFanoutMetricsLogger_Metrics(t *testing.T) {
+	testName := "TestFanoutMetricsLogger_Metrics"
+	audit := NewMemoryStoreMetricsLogger(10)
+	small := NewMemoryStoreMetricsLogger(10)
+	big := NewMemoryStoreMetricsLogger(10)
+	sinks := []FanoutSink{
+		{Name: "failing", Logger: &testFailingMetricsLogger{panic: true}},
+		{Name: "audit", Logger: audit, Categories: []string{MetricsCatDDL}},
+		{Name: "small", Logger: small},
+		{Name: "big", Logger: big},
+	}
+	for i := 0; i < 5; i++ {
+		_ = big.Put(MetricsCatDQL, &CmdExecInfo{})
+	}
+	_ = small.Put(MetricsCatDQL, &CmdExecInfo{})
+	_ = audit.Put(MetricsCatDDL, &CmdExecInfo{})
+
+	testCases := []struct {
+		name     string
+		opts     FanoutMetricsLoggerOpts
+		category string
+		expected int64
+	}{
+		{"first", FanoutMetricsLoggerOpts{}, MetricsCatDQL, 1},
+		{"first_routed", FanoutMetricsLoggerOpts{}, MetricsCatDDL, 1},
+		{"named", FanoutMetricsLoggerOpts{MetricsPolicy: FanoutMetricsNamed, MetricsSink: "big"}, MetricsCatDQL, 5},
+		{"most_cmds", FanoutMetricsLoggerOpts{MetricsPolicy: FanoutMetricsMostCmds}, MetricsCatDQL, 5},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger, _ := NewFanoutMetricsLogger(tc.opts, sinks...)
+			m, err := logger.Metrics(tc.category)
+			if err != nil {
+				t.Fatalf("%s failed: %s", testName, err)
+			}
+			if m.TotalNumCmds != tc.expected {
+				t.Fatalf("%s failed: expected %#v commands but received %#v", testName, tc.expected, m.TotalNumCmds)
+			}
+		})
+	}
+
+	logger, _ := NewFanoutMetricsLogger(FanoutMetricsLoggerOpts{}, FanoutSink{Name: "audit", Logger: audit, Categories: []string{MetricsCatDDL}})
+	if _, err := logger.Metrics(MetricsCatDQL); !errors.Is(err, ErrNoMetricsSink) {
+		t.Fatalf("%s failed: expected error %s but received %s", testName, ErrNoMetricsSink, err)
+	}
+	logger, _ = NewFanoutMetricsLogger(FanoutMetricsLoggerOpts{MetricsPolicy: FanoutMetricsNamed, MetricsSink: "failing"}, sinks...)
+	if _, err := logger.Metrics(MetricsCatDQL); err == nil {
+		t.Fatalf("%s failed: expected error from failing sink", testName)
+	}
+}
+
+func TestFanoutMetricsLogger_Close(t *testing.T) {
+	testName := "TestFanoutMetricsLogger_Close"
+	asyncLogger := NewAsyncMetricsLogger(NewMemoryStoreMetricsLogger(10), AsyncMetricsLoggerOpts{})
+	logger, _ := NewFanoutMetricsLogger(FanoutMetricsLoggerOpts{},
+		FanoutSink{Name: "mem", Logger: NewMemoryStoreMetricsLogger(10)},
+		FanoutSink{Name: "async", Logger: asyncLogger},
+	)
+	if err := logger.Close(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if err := asyncLogger.Put(MetricsCatAll, &CmdExecInfo{}); !errors.Is(err, ErrMetricsLoggerClosed) {
+		t.Fatalf("%s failed: expected sink to be closed", testName)
+	}
+}
+
+func TestFanoutMetricsLogger_ResetAndRemove(t *testing.T) {
+	testName := "TestFanoutMetricsLogger_ResetAndRemove"
+	other := NewMemoryStoreMetricsLogger(10)
+	logger, _ := NewFanoutMetricsLogger(FanoutMetricsLoggerOpts{},
+		FanoutSink{Name: "mem", Logger: NewMemoryStoreMetricsLogger(10)},
+		FanoutSink{Name: "failing", Logger: &testFailingMetricsLogger{}},
+		FanoutSink{Name: "other", Logger: other},
+	)
+	testMetricsResetAndRemove(t, testName, logger, nil)
+	if m, _ := other.Metrics(MetricsCatDQL); m.TotalNumCmds != 0 {
+		t.Fatalf("%s failed: all sinks must be reset %#v", testName, m)
+	}
+}
@@ -0,0 +1,348 @@
+package prom
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrMetricsLoggerClosed is returned when putting a command to a metrics logger that has been closed.
+//
+// @Available since <<VERSION>>
+var ErrMetricsLoggerClosed = errors.New("metrics logger has been closed")
+
+const (
+	defaultFileMetricsLoggerPrefix   = "prom-metrics"
+	defaultFileMetricsLoggerCapacity = 1028
+	fileMetricsLoggerExt             = ".jsonl"
+	fileMetricsLoggerTimeLayout      = "20060102T150405.000000000"
+)
+
+// FileMetricsLoggerOpts configures a FileMetricsLogger.
+//
+// @Available since <<VERSION>>
+type FileMetricsLoggerOpts struct {
+	// Directory to store log files. It is created if not exist.
+	Dir string `json:"dir"`
+
+	// Prefix of log file names. Default value is "prom-metrics".
+	// Log files are named <prefix>-<timestamp>.jsonl
+	FilePrefix string `json:"file_prefix"`
+
+	// The current log file is rotated when its size would exceed this value (in bytes).
+	// Set to zero or negative value to disable size-based rotation.
+	MaxFileSize int64 `json:"max_file_size"`
+
+	// The current log file is rotated when it is older than this value.
+	// Set to zero or negative value to disable time-based rotation.
+	RotateInterval time.Duration `json:"rotate_interval"`
+
+	// Maximum number of log files to retain, older files are deleted upon rotation.
+	// Set to zero or negative value to retain all log files.
+	MaxFiles int `json:"max_files"`
+
+	// Number of most recent log files to replay upon startup to rebuild metrics.
+	// Set to zero to replay all retained log files, negative value to disable replaying.
+	ReplayFiles int `json:"replay_files"`
+
+	// Capacity of the in-memory store used to calculate metrics. Default value is 1028.
+	Capacity int `json:"capacity"`
+}
+
+// FileMetricsLogger is an IMetricsLogger implementation that appends each logged command as a JSON line to a
+// rolling log file, so that command history survives restarts and can be inspected offline.
+//
+// Metrics are calculated by an embedded MemoryStoreMetricsLogger, which is rebuilt upon startup by replaying the
+// most recent log files.
+//
+// Each line is a JSON object {"cat": <category>, "cmd": <CmdExecInfo>}, see CmdExecInfo.MarshalJSON for the
+// encoding of commands.
+//
+// @Available since <<VERSION>>
+type FileMetricsLogger struct {
+	opts        FileMetricsLoggerOpts
+	memLogger   *MemoryStoreMetricsLogger
+	lock        sync.Mutex
+	file        *os.File
+	fileSize    int64
+	fileCreated time.Time
+	closed      bool
+}
+
+type fileMetricsRecord struct {
+	Category string       `json:"cat"`
+	Cmd      *CmdExecInfo `json:"cmd"`
+}
+
+// NewFileMetricsLogger creates a new FileMetricsLogger instance, replays the most recent log files to rebuild
+// metrics and opens a new log file for writing.
+//
+// @Available since <<VERSION>>
+func NewFileMetricsLogger(opts FileMetricsLoggerOpts) (*FileMetricsLogger, error) {
+	if strings.TrimSpace(opts.Dir) == "" {
+		return nil, errors.New("log directory is not specified")
+	}
+	if opts.FilePrefix == "" {
+		opts.FilePrefix = defaultFileMetricsLoggerPrefix
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = defaultFileMetricsLoggerCapacity
+	}
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return nil, err
+	}
+	logger := &FileMetricsLogger{
+		opts:      opts,
+		memLogger: NewMemoryStoreMetricsLogger(opts.Capacity).(*MemoryStoreMetricsLogger),
+	}
+	if err := logger.replay(); err != nil {
+		return nil, err
+	}
+	if err := logger.rotate(); err != nil {
+		return nil, err
+	}
+	return logger, nil
+}
+
+// Opts returns the options this logger was created with.
+func (logger *FileMetricsLogger) Opts() FileMetricsLoggerOpts {
+	return logger.opts
+}
+
+// MemoryLogger returns the embedded in-memory logger used to calculate metrics.
+func (logger *FileMetricsLogger) MemoryLogger() *MemoryStoreMetricsLogger {
+	return logger.memLogger
+}
+
+// LogFiles returns the full paths of current log files, sorted from oldest to newest.
+func (logger *FileMetricsLogger) LogFiles() ([]string, error) {
+	entries, err := os.ReadDir(logger.opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix := logger.opts.FilePrefix + "-"
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, fileMetricsLoggerExt) {
+			result = append(result, filepath.Join(logger.opts.Dir, name))
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Put implements IMetricsLogger.Put.
+func (logger *FileMetricsLogger) Put(category string, cmd *CmdExecInfo) error {
+	return logger.PutBatch([]MetricsRecord{{Category: category, Cmd: cmd}})
+}
+
+// PutBatch implements IMetricsBatchLogger.PutBatch.
+func (logger *FileMetricsLogger) PutBatch(records []MetricsRecord) error {
+	lines := make([][]byte, len(records))
+	for i, r := range records {
+		if r.Cmd == nil {
+			return errors.New("nil input")
+		}
+		line, err := encodeFileMetricsRecord(r.Category, r.Cmd)
+		if err != nil {
+			return err
+		}
+		lines[i] = line
+	}
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	if logger.closed {
+		return ErrMetricsLoggerClosed
+	}
+	if err := logger.writeLines(lines); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := logger.memLogger.Put(r.Category, r.Cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLines writes lines to the current log file with as few write calls as possible, rotating the log file when needed.
+func (logger *FileMetricsLogger) writeLines(lines [][]byte) error {
+	buf := make([]byte, 0)
+	for _, line := range lines {
+		if logger.shouldRotate(int64(len(buf)), int64(len(line))) {
+			if err := logger.write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+			if err := logger.rotate(); err != nil {
+				return err
+			}
+		}
+		buf = append(buf, line...)
+	}
+	return logger.write(buf)
+}
+
+func (logger *FileMetricsLogger) write(buf []byte) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	n, err := logger.file.Write(buf)
+	logger.fileSize += int64(n)
+	return err
+}
+
+// Metrics implements IMetricsLogger.Metrics.
+func (logger *FileMetricsLogger) Metrics(category string, opts ...MetricsOpts) (*Metrics, error) {
+	return logger.memLogger.Metrics(category, opts...)
+}
+
+// Categories implements IMetricsCategoryLister.Categories.
+func (logger *FileMetricsLogger) Categories() []string {
+	return logger.memLogger.Categories()
+}
+
+// Reset implements IMetricsResetter.Reset.
+// Only in-memory metrics are reset, log files are left untouched (and are replayed upon restart).
+func (logger *FileMetricsLogger) Reset(category string) {
+	logger.memLogger.Reset(category)
+}
+
+// ResetAll implements IMetricsResetter.ResetAll.
+// Only in-memory metrics are reset, log files are left untouched (and are replayed upon restart).
+func (logger *FileMetricsLogger) ResetAll() {
+	logger.memLogger.ResetAll()
+}
+
+// Remove implements IMetricsCategoryRemover.Remove.
+// Only in-memory metrics are removed, log files are left untouched (and are replayed upon restart).
+func (logger *FileMetricsLogger) Remove(category string) {
+	logger.memLogger.Remove(category)
+}
+
+// Close closes the current log file. Subsequent calls to Put return ErrMetricsLoggerClosed.
+func (logger *FileMetricsLogger) Close() error {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	if logger.closed {
+		return nil
+	}
+	logger.closed = true
+	if logger.file != nil {
+		return logger.file.Close()
+	}
+	return nil
+}
+
+func (logger *FileMetricsLogger) shouldRotate(pendingSize, nextWriteSize int64) bool {
+	if logger.file == nil {
+		return true
+	}
+	size := logger.fileSize + pendingSize
+	if logger.opts.MaxFileSize > 0 && size > 0 && size+nextWriteSize > logger.opts.MaxFileSize {
+		return true
+	}
+	return logger.opts.RotateInterval > 0 && time.Since(logger.fileCreated) >= logger.opts.RotateInterval
+}
+
+// rotate closes the current log file (if any), opens a new one and deletes old log files exceeding the retention.
+func (logger *FileMetricsLogger) rotate() error {
+	if logger.file != nil {
+		if err := logger.file.Close(); err != nil {
+			return err
+		}
+		logger.file = nil
+	}
+	now := time.Now()
+	fileName := logger.opts.FilePrefix + "-" + now.UTC().Format(fileMetricsLoggerTimeLayout) + fileMetricsLoggerExt
+	file, err := os.OpenFile(filepath.Join(logger.opts.Dir, fileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	logger.file, logger.fileSize, logger.fileCreated = file, 0, now
+	if logger.opts.MaxFiles > 0 {
+		files, err := logger.LogFiles()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(files)-logger.opts.MaxFiles; i++ {
+			if err := os.Remove(files[i]); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (logger *FileMetricsLogger) replay() error {
+	if logger.opts.ReplayFiles < 0 {
+		return nil
+	}
+	files, err := logger.LogFiles()
+	if err != nil {
+		return err
+	}
+	if logger.opts.MaxFiles > 0 && len(files) > logger.opts.MaxFiles {
+		files = files[len(files)-logger.opts.MaxFiles:]
+	}
+	if logger.opts.ReplayFiles > 0 && len(files) > logger.opts.ReplayFiles {
+		files = files[len(files)-logger.opts.ReplayFiles:]
+	}
+	for _, file := range files {
+		if err := logger.replayFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (logger *FileMetricsLogger) replayFile(fileName string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			// lines that cannot be decoded (e.g. partially written upon crash) are skipped
+			if category, cmd, decodeErr := decodeFileMetricsRecord(line); decodeErr == nil {
+				_ = logger.memLogger.Put(category, cmd)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func encodeFileMetricsRecord(category string, cmd *CmdExecInfo) ([]byte, error) {
+	line, err := json.Marshal(fileMetricsRecord{Category: category, Cmd: cmd})
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+func decodeFileMetricsRecord(line []byte) (string, *CmdExecInfo, error) {
+	record := fileMetricsRecord{}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return "", nil, err
+	}
+	if record.Cmd == nil {
+		return "", nil, errors.New("invalid record: no command")
+	}
+	return record.Category, record.Cmd, nil
+}
@@ -0,0 +1,202 @@
+package prom
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewFileMetricsLogger(t *testing.T) {
+	testName := "TestNewFileMetricsLogger"
+	if _, err := NewFileMetricsLogger(FileMetricsLoggerOpts{}); err == nil {
+		t.Fatalf("%s failed: expected error when log directory is not specified", testName)
+	}
+	dir := t.TempDir()
+	logger, err := NewFileMetricsLogger(FileMetricsLoggerOpts{Dir: dir})
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer func() { _ = logger.Close() }()
+	if opts := logger.Opts(); opts.FilePrefix != defaultFileMetricsLoggerPrefix || opts.Capacity != defaultFileMetricsLoggerCapacity {
+		t.Fatalf("%s failed: default options not applied %#v", testName, opts)
+	}
+	if files, err := logger.LogFiles(); err != nil || len(files) != 1 {
+		t.Fatalf("%s failed: expected 1 log file but received %#v / %s", testName, files, err)
+	}
+}
+
+func TestFileMetricsLogger_Put(t *testing.T) {
+	testName := "TestFileMetricsLogger_Put"
+	dir := t.TempDir()
+	logger, err := NewFileMetricsLogger(FileMetricsLoggerOpts{Dir: dir})
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if err := logger.Put(MetricsCatAll, nil); err == nil {
+		t.Fatalf("%s failed: expected error when putting nil command", testName)
+	}
+	cmd := &CmdExecInfo{Id: "1", CmdName: "SELECT", CmdRequest: map[string]interface{}{"query": "SELECT 1"}, Cost: 12, Result: CmdResultError, Error: errors.New("dummy")}
+	if err := logger.Put(MetricsCatDQL, cmd); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if cmd.Error == nil {
+		t.Fatalf("%s failed: input command must not be modified", testName)
+	}
+	m, _ := logger.Metrics(MetricsCatDQL)
+	if m.TotalNumCmds != 1 {
+		t.Fatalf("%s failed: expected %#v command but received %#v", testName, 1, m.TotalNumCmds)
+	}
+	if cats := logger.Categories(); len(cats) != 1 || cats[0] != MetricsCatDQL {
+		t.Fatalf("%s failed: unexpected categories %#v", testName, cats)
+	}
+
+	files, _ := logger.LogFiles()
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), `"cat":"dql"`) || !strings.Contains(string(data), `"error":{"msg":"dummy"`) {
+		t.Fatalf("%s failed: unexpected log file content %s", testName, data)
+	}
+
+	if err := logger.Close(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if err := logger.Put(MetricsCatDQL, cmd); !errors.Is(err, ErrMetricsLoggerClosed) {
+		t.Fatalf("%s failed: expected error %s but received %s", testName, ErrMetricsLoggerClosed, err)
+	}
+}
+
+func TestFileMetricsLogger_RotateBySize(t *testing.T) {
+	testName := "TestFileMetricsLogger_RotateBySize"
+	dir := t.TempDir()
+	logger, err := NewFileMetricsLogger(FileMetricsLoggerOpts{Dir: dir, MaxFileSize: 512, MaxFiles: 3})
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer func() { _ = logger.Close() }()
+	for i := 0; i < 100; i++ {
+		if err := logger.Put(MetricsCatAll, &CmdExecInfo{Id: strconv.Itoa(i), Cost: float64(i)}); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+	}
+	files, _ := logger.LogFiles()
+	if len(files) != 3 {
+		t.Fatalf("%s failed: expected %#v log files but received %#v", testName, 3, len(files))
+	}
+	for _, file := range files {
+		if fi, _ := os.Stat(file); fi.Size() > 512 {
+			t.Fatalf("%s failed: log file %s exceeds max size (%d)", testName, file, fi.Size())
+		}
+	}
+}
+
+func TestFileMetricsLogger_RotateByTime(t *testing.T) {
+	testName := "TestFileMetricsLogger_RotateByTime"
+	dir := t.TempDir()
+	logger, err := NewFileMetricsLogger(FileMetricsLoggerOpts{Dir: dir, RotateInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer func() { _ = logger.Close() }()
+	_ = logger.Put(MetricsCatAll, &CmdExecInfo{Id: "1"})
+	time.Sleep(60 * time.Millisecond)
+	_ = logger.Put(MetricsCatAll, &CmdExecInfo{Id: "2"})
+	if files, _ := logger.LogFiles(); len(files) != 2 {
+		t.Fatalf("%s failed: expected %#v log files but received %#v", testName, 2, len(files))
+	}
+}
+
+func TestFileMetricsLogger_Replay(t *testing.T) {
+	testName := "TestFileMetricsLogger_Replay"
+	dir := t.TempDir()
+	opts := FileMetricsLoggerOpts{Dir: dir, MaxFileSize: 1024}
+	logger, err := NewFileMetricsLogger(opts)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	for i := 1; i <= 20; i++ {
+		cmd := &CmdExecInfo{Id: strconv.Itoa(i), Cost: float64(i), Result: CmdResultOk}
+		if i == 20 {
+			cmd.Result, cmd.Error = CmdResultError, errors.New("dummy")
+		}
+		_ = logger.Put(MetricsCatAll, cmd)
+	}
+	_ = logger.Close()
+
+	// partially written line must be skipped
+	files, _ := logger.LogFiles()
+	f, _ := os.OpenFile(files[len(files)-1], os.O_APPEND|os.O_WRONLY, 0o640)
+	_, _ = f.WriteString(`{"cat":"all","cmd":{"id":"21"`)
+	_ = f.Close()
+
+	logger, err = NewFileMetricsLogger(opts)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer func() { _ = logger.Close() }()
+	m, _ := logger.Metrics(MetricsCatAll, MetricsOpts{ReturnLatestCommands: 1})
+	if m.TotalNumCmds != 20 || m.MaxCost != 20 {
+		t.Fatalf("%s failed: metrics not rebuilt %#v", testName, m)
+	}
+	if last := m.LastNCmds[0]; last.Id != "20" || last.Error == nil || last.Error.Error() != "dummy" {
+		t.Fatalf("%s failed: unexpected last command %#v", testName, last)
+	}
+
+	logger2, err := NewFileMetricsLogger(FileMetricsLoggerOpts{Dir: dir, ReplayFiles: -1})
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer func() { _ = logger2.Close() }()
+	if m, _ := logger2.Metrics(MetricsCatAll); m.TotalNumCmds != 0 {
+		t.Fatalf("%s failed: expected no replay but received %#v commands", testName, m.TotalNumCmds)
+	}
+}
+
+func TestFileMetricsLogger_PutBatch(t *testing.T) {
+	testName := "TestFileMetricsLogger_PutBatch"
+	dir := t.TempDir()
+	logger, err := NewFileMetricsLogger(FileMetricsLoggerOpts{Dir: dir, MaxFileSize: 1024})
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer func() { _ = logger.Close() }()
+	if err := logger.PutBatch([]MetricsRecord{{Category: MetricsCatAll, Cmd: nil}}); err == nil {
+		t.Fatalf("%s failed: expected error when putting nil command", testName)
+	}
+	records := make([]MetricsRecord, 0)
+	for i := 0; i < 50; i++ {
+		records = append(records, MetricsRecord{Category: MetricsCatAll, Cmd: &CmdExecInfo{Id: strconv.Itoa(i), Cost: float64(i)}})
+	}
+	if err := logger.PutBatch(records); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if m, _ := logger.Metrics(MetricsCatAll); m.TotalNumCmds != 50 {
+		t.Fatalf("%s failed: expected %#v commands but received %#v", testName, 50, m.TotalNumCmds)
+	}
+	files, _ := logger.LogFiles()
+	if len(files) < 2 {
+		t.Fatalf("%s failed: expected log file to be rotated but received %#v log files", testName, len(files))
+	}
+	numLines := 0
+	for _, file := range files {
+		fi, _ := os.Stat(file)
+		if fi.Size() > 1024 {
+			t.Fatalf("%s failed: log file %s exceeds max size (%d)", testName, file, fi.Size())
+		}
+		data, _ := os.ReadFile(file)
+		numLines += strings.Count(string(data), "\n")
+	}
+	if numLines != 50 {
+		t.Fatalf("%s failed: expected %#v lines but received %#v", testName, 50, numLines)
+	}
+}
+
+func TestFileMetricsLogger_ResetAndRemove(t *testing.T) {
+	logger, err := NewFileMetricsLogger(FileMetricsLoggerOpts{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("%s failed: %s", "TestFileMetricsLogger_ResetAndRemove", err)
+	}
+	defer func() { _ = logger.Close() }()
+	testMetricsResetAndRemove(t, "TestFileMetricsLogger_ResetAndRemove", logger, nil)
+}
@@ -0,0 +1,281 @@
+package prom
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CmdError is a serializable representation of a command execution error.
+//
+// CmdExecInfo.Error is restored as a *CmdError when decoding a JSON-encoded CmdExecInfo.
+//
+// @Available since <<VERSION>>
+type CmdError struct {
+	// Message is the error message, i.e. the output of the original error's Error().
+	Message string `json:"msg"`
+
+	// Type is the Go type name of the original error (e.g. "*mysql.MySQLError"), if known.
+	Type string `json:"type,omitempty"`
+
+	// Code is the driver/server specific error code (e.g. "1213" for MySQL, "40001" for PostgreSQL), if known.
+	Code string `json:"code,omitempty"`
+}
+
+// Error implements error.Error.
+func (e *CmdError) Error() string {
+	return e.Message
+}
+
+// NewCmdError creates a CmdError from an error, capturing its message, type and driver error code (see ErrorCode).
+// This function returns nil if the input is nil.
+//
+// @Available since <<VERSION>>
+func NewCmdError(err error) *CmdError {
+	if err == nil {
+		return nil
+	}
+	if cmdErr, ok := err.(*CmdError); ok {
+		return cmdErr
+	}
+	result := &CmdError{Message: err.Error(), Type: fmt.Sprintf("%T", err)}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if code, ok := errorCodeOf(e); ok {
+			result.Code, result.Type = code, fmt.Sprintf("%T", e)
+			break
+		}
+	}
+	return result
+}
+
+// ErrorCode extracts the driver/server specific error code from an error or any error in its chain.
+//
+// The code is looked up from the following, in order:
+//   - methods SQLState() string, Code() string, Code() int, Number() int, Number() int32, ErrCode() string or
+//     ErrCode() int (e.g. pgconn.PgError, godror.OraErr, modernc.org/sqlite.Error).
+//   - exported fields SQLState, Code, Number or ErrCode of string or integer type (e.g. mysql.MySQLError, mssql.Error,
+//     go-ora's OracleError, sqlite3.Error).
+//
+// This function returns an empty string if no error code can be found.
+//
+// @Available since <<VERSION>>
+func ErrorCode(err error) string {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if code, ok := errorCodeOf(e); ok {
+			return code
+		}
+	}
+	return ""
+}
+
+var errorCodeNames = []string{"SQLState", "Code", "Number", "ErrCode"}
+
+func errorCodeOf(err error) (string, bool) {
+	if cmdErr, ok := err.(*CmdError); ok {
+		return cmdErr.Code, cmdErr.Code != ""
+	}
+	if code, ok := errorCodeFromMethods(err); ok {
+		return code, true
+	}
+	rv := reflect.ValueOf(err)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return "", false
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return "", false
+	}
+	for _, name := range errorCodeNames {
+		if f, ok := rv.Type().FieldByName(name); ok && f.IsExported() {
+			if code, ok := errorCodeValueToString(rv.FieldByIndex(f.Index)); ok {
+				return code, true
+			}
+		}
+	}
+	return "", false
+}
+
+// errorCodeFromMethods looks up the error code from methods of the error. Panics (e.g. methods called on a nil
+// pointer) are recovered and treated as no error code.
+func errorCodeFromMethods(err error) (code string, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			code, ok = "", false
+		}
+	}()
+	if e, ok := err.(interface{ SQLState() string }); ok {
+		code = e.SQLState()
+	}
+	if e, ok := err.(interface{ Code() string }); ok && code == "" {
+		code = e.Code()
+	}
+	if e, ok := err.(interface{ Code() int }); ok && code == "" {
+		code = intErrorCode(int64(e.Code()))
+	}
+	if e, ok := err.(interface{ Number() int }); ok && code == "" {
+		code = intErrorCode(int64(e.Number()))
+	}
+	if e, ok := err.(interface{ Number() int32 }); ok && code == "" {
+		code = intErrorCode(int64(e.Number()))
+	}
+	if e, ok := err.(interface{ ErrCode() string }); ok && code == "" {
+		code = e.ErrCode()
+	}
+	if e, ok := err.(interface{ ErrCode() int }); ok && code == "" {
+		code = intErrorCode(int64(e.ErrCode()))
+	}
+	return code, code != ""
+}
+
+func intErrorCode(code int64) string {
+	if code == 0 {
+		return ""
+	}
+	return strconv.FormatInt(code, 10)
+}
+
+func errorCodeValueToString(v reflect.Value) (string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), v.String() != ""
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), v.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), v.Uint() != 0
+	default:
+		return "", false
+	}
+}
+
+type cmdExecInfoJson struct {
+	Id          string          `json:"id"`
+	BeginTime   time.Time       `json:"tbegin"`
+	EndTime     time.Time       `json:"tend"`
+	Duration    time.Duration   `json:"dur"`
+	CmdName     string          `json:"cname"`
+	CmdRequest  json.RawMessage `json:"creq"`
+	CmdResponse json.RawMessage `json:"cres"`
+	CmdMeta     json.RawMessage `json:"meta"`
+	Result      json.RawMessage `json:"result"`
+	Cost        float64         `json:"cost"`
+	Error       *CmdError       `json:"error"`
+}
+
+// MarshalJSON implements json.Marshaler.
+//
+// In addition to the exported fields, the JSON output contains:
+//   - "dur": the execution duration (EndTime - BeginTime) in nanoseconds, 0 if the command has not finished.
+//   - "error": the error as a CmdError object (message, Go type and driver error code), or null.
+//
+// @Available since <<VERSION>>
+func (cmd CmdExecInfo) MarshalJSON() ([]byte, error) {
+	var err error
+	data := cmdExecInfoJson{
+		Id:        cmd.Id,
+		BeginTime: cmd.BeginTime,
+		EndTime:   cmd.EndTime,
+		CmdName:   cmd.CmdName,
+		Cost:      cmd.Cost,
+		Error:     NewCmdError(cmd.Error),
+	}
+	if !cmd.BeginTime.IsZero() && !cmd.EndTime.IsZero() {
+		data.Duration = cmd.EndTime.Sub(cmd.BeginTime)
+	}
+	if data.CmdRequest, err = json.Marshal(cmd.CmdRequest); err != nil {
+		return nil, err
+	}
+	if data.CmdResponse, err = json.Marshal(cmd.CmdResponse); err != nil {
+		return nil, err
+	}
+	if data.CmdMeta, err = json.Marshal(cmd.CmdMeta); err != nil {
+		return nil, err
+	}
+	if data.Result, err = json.Marshal(cmd.Result); err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+//
+// Untyped fields (CmdRequest, CmdResponse, CmdMeta and Result) are decoded to stable types: JSON objects to
+// map[string]interface{}, arrays to []interface{}, integral numbers to int64 and other numbers to float64.
+// Error is restored as a *CmdError.
+//
+// @Available since <<VERSION>>
+func (cmd *CmdExecInfo) UnmarshalJSON(input []byte) error {
+	data := cmdExecInfoJson{}
+	if err := json.Unmarshal(input, &data); err != nil {
+		return err
+	}
+	result := CmdExecInfo{
+		Id:        data.Id,
+		BeginTime: data.BeginTime,
+		EndTime:   data.EndTime,
+		CmdName:   data.CmdName,
+		Cost:      data.Cost,
+	}
+	var err error
+	if result.CmdRequest, err = decodeStableJson(data.CmdRequest); err != nil {
+		return err
+	}
+	if result.CmdResponse, err = decodeStableJson(data.CmdResponse); err != nil {
+		return err
+	}
+	if result.CmdMeta, err = decodeStableJson(data.CmdMeta); err != nil {
+		return err
+	}
+	if result.Result, err = decodeStableJson(data.Result); err != nil {
+		return err
+	}
+	if data.Error != nil {
+		result.Error = data.Error
+	}
+	*cmd = result
+	return nil
+}
+
+func decodeStableJson(data json.RawMessage) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return normalizeJsonNumbers(v), nil
+}
+
+func normalizeJsonNumbers(v interface{}) interface{} {
+	switch vt := v.(type) {
+	case json.Number:
+		if !strings.ContainsAny(vt.String(), ".eE") {
+			if i, err := vt.Int64(); err == nil {
+				return i
+			}
+		}
+		f, _ := vt.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range vt {
+			vt[k] = normalizeJsonNumbers(e)
+		}
+		return vt
+	case []interface{}:
+		for i, e := range vt {
+			vt[i] = normalizeJsonNumbers(e)
+		}
+		return vt
+	default:
+		return v
+	}
+}
@@ -0,0 +1,178 @@
+package prom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testMysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *testMysqlError) Error() string {
+	return fmt.Sprintf("Error %d: %s", e.Number, e.Message)
+}
+
+type testPgError struct {
+	Code string
+}
+
+func (e *testPgError) Error() string {
+	return "pg error"
+}
+
+func (e *testPgError) SQLState() string {
+	return e.Code
+}
+
+type testOraError struct {
+	code int
+}
+
+func (e testOraError) Error() string {
+	return fmt.Sprintf("ORA-%05d", e.code)
+}
+
+func (e testOraError) Code() int {
+	return e.code
+}
+
+type testMssqlError struct {
+	number int32
+}
+
+func (e testMssqlError) Error() string {
+	return "mssql error"
+}
+
+func (e testMssqlError) Number() int32 {
+	return e.number
+}
+
+func TestErrorCode(t *testing.T) {
+	testName := "TestErrorCode"
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"nil", nil, ""},
+		{"no_code", errors.New("dummy"), ""},
+		{"field_number", &testMysqlError{Number: 1213, Message: "deadlock"}, "1213"},
+		{"method_sqlstate", &testPgError{Code: "40001"}, "40001"},
+		{"method_code", testOraError{code: 60}, "60"},
+		{"method_number_int32", testMssqlError{number: 1205}, "1205"},
+		{"method_nil_receiver", (*testPgError)(nil), ""},
+		{"wrapped", fmt.Errorf("wrapped: %w", &testMysqlError{Number: 1205}), "1205"},
+		{"cmd_error", &CmdError{Message: "dummy", Code: "ORA-08177"}, "ORA-08177"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := ErrorCode(tc.err); code != tc.expected {
+				t.Fatalf("%s failed: expected %#v but received %#v", testName, tc.expected, code)
+			}
+		})
+	}
+}
+
+func TestNewCmdError(t *testing.T) {
+	testName := "TestNewCmdError"
+	if NewCmdError(nil) != nil {
+		t.Fatalf("%s failed: expected nil", testName)
+	}
+	err := fmt.Errorf("wrapped: %w", &testMysqlError{Number: 1213, Message: "deadlock"})
+	cmdErr := NewCmdError(err)
+	if cmdErr.Message != err.Error() || cmdErr.Type != "*prom.testMysqlError" || cmdErr.Code != "1213" {
+		t.Fatalf("%s failed: unexpected result %#v", testName, cmdErr)
+	}
+	if NewCmdError(cmdErr) != cmdErr {
+		t.Fatalf("%s failed: expected the same CmdError instance", testName)
+	}
+	cmdErr = NewCmdError(errors.New("dummy"))
+	if cmdErr.Message != "dummy" || cmdErr.Type != "*errors.errorString" || cmdErr.Code != "" {
+		t.Fatalf("%s failed: unexpected result %#v", testName, cmdErr)
+	}
+}
+
+func TestCmdExecInfo_JSON(t *testing.T) {
+	testName := "TestCmdExecInfo_JSON"
+	begin := time.Now().Add(-1500 * time.Millisecond).Round(0)
+	cmd := &CmdExecInfo{
+		Id:          "1",
+		BeginTime:   begin,
+		EndTime:     begin.Add(1500 * time.Millisecond),
+		CmdName:     "INSERT",
+		CmdRequest:  map[string]interface{}{"query": "INSERT INTO t VALUES (?, ?)", "params": []interface{}{1, 2.5, "a"}},
+		CmdResponse: map[string]interface{}{"rowsAffected": int64(1)},
+		Result:      CmdResultError,
+		Cost:        1500000,
+		Error:       &testPgError{Code: "23505"},
+	}
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if !strings.Contains(string(data), `"dur":1500000000`) {
+		t.Fatalf("%s failed: duration not encoded %s", testName, data)
+	}
+	if !strings.Contains(string(data), `"error":{"msg":"pg error","type":"*prom.testPgError","code":"23505"}`) {
+		t.Fatalf("%s failed: error not encoded %s", testName, data)
+	}
+
+	decoded := &CmdExecInfo{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if decoded.Id != cmd.Id || decoded.CmdName != cmd.CmdName || decoded.Cost != cmd.Cost || decoded.Result != cmd.Result {
+		t.Fatalf("%s failed: expected %#v but received %#v", testName, cmd, decoded)
+	}
+	if !decoded.BeginTime.Equal(cmd.BeginTime) || !decoded.EndTime.Equal(cmd.EndTime) {
+		t.Fatalf("%s failed: timestamps mismatched %#v", testName, decoded)
+	}
+	expectedReq := map[string]interface{}{"query": "INSERT INTO t VALUES (?, ?)", "params": []interface{}{int64(1), 2.5, "a"}}
+	if !reflect.DeepEqual(decoded.CmdRequest, expectedReq) {
+		t.Fatalf("%s failed: expected request %#v but received %#v", testName, expectedReq, decoded.CmdRequest)
+	}
+	if !reflect.DeepEqual(decoded.CmdResponse, map[string]interface{}{"rowsAffected": int64(1)}) {
+		t.Fatalf("%s failed: unexpected response %#v", testName, decoded.CmdResponse)
+	}
+	cmdErr, ok := decoded.Error.(*CmdError)
+	if !ok || cmdErr.Message != "pg error" || cmdErr.Code != "23505" || cmdErr.Type != "*prom.testPgError" {
+		t.Fatalf("%s failed: unexpected error %#v", testName, decoded.Error)
+	}
+
+	// round-trip of a decoded command must be stable
+	data2, _ := json.Marshal(decoded)
+	decoded2 := &CmdExecInfo{}
+	_ = json.Unmarshal(data2, decoded2)
+	if !reflect.DeepEqual(decoded, decoded2) {
+		t.Fatalf("%s failed: expected %#v but received %#v", testName, decoded, decoded2)
+	}
+}
+
+func TestMetrics_JSON(t *testing.T) {
+	testName := "TestMetrics_JSON"
+	logger := NewMemoryStoreMetricsLogger(10)
+	_ = logger.Put(MetricsCatAll, &CmdExecInfo{Id: "1", Cost: 1, EndTime: time.Now(), Result: CmdResultError, Error: errors.New("dummy")})
+	m, _ := logger.Metrics(MetricsCatAll, MetricsOpts{ReturnLatestCommands: 1})
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	decoded := &Metrics{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if decoded.TotalNumCmds != 1 || len(decoded.LastNCmds) != 1 || decoded.LastNCmds[0].Error.Error() != "dummy" {
+		t.Fatalf("%s failed: unexpected result %#v", testName, decoded)
+	}
+	if len(decoded.Windows) != len(m.Windows) || decoded.Windows[0].Window != m.Windows[0].Window || decoded.Windows[0].NumErrors != 1 {
+		t.Fatalf("%s failed: unexpected time-windowed metrics %#v", testName, decoded.Windows)
+	}
+}
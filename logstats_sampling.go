@@ -0,0 +1,251 @@
+package prom
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// SamplingMode specifies how SamplingMetricsLogger selects commands to keep.
+//
+// @Available since <<VERSION>>
+type SamplingMode int
+
+const (
+	// SamplingOneInN keeps 1 command out of every N commands of a category.
+	SamplingOneInN SamplingMode = iota
+
+	// SamplingProbabilistic keeps each command with a fixed probability.
+	SamplingProbabilistic
+)
+
+// SamplingMetricsLoggerOpts configures a SamplingMetricsLogger.
+//
+// @Available since <<VERSION>>
+type SamplingMetricsLoggerOpts struct {
+	// Sampling mode. Default value is SamplingOneInN.
+	Mode SamplingMode `json:"mode"`
+
+	// Used with SamplingOneInN: keep 1 command out of every N commands. Value less than 2 keeps all commands.
+	N int `json:"n"`
+
+	// Used with SamplingProbabilistic: probability (0..1] that a command is kept. Value out of range keeps all commands.
+	Probability float64 `json:"probability"`
+
+	// If true, failed commands (Result is CmdResultError or Error is not nil) are always kept.
+	KeepErrors bool `json:"keep_errors"`
+
+	// If positive, commands whose cost is greater than this value are always kept.
+	KeepCostAbove float64 `json:"keep_cost_above"`
+}
+
+// NewSamplingMetricsLogger wraps an IMetricsLogger so that only a sample of commands is put to it.
+//
+// @Available since <<VERSION>>
+func NewSamplingMetricsLogger(logger IMetricsLogger, opts SamplingMetricsLoggerOpts) *SamplingMetricsLogger {
+	return &SamplingMetricsLogger{logger: logger, opts: opts, counters: make(map[string]*samplingCounter)}
+}
+
+// SamplingMetricsLogger is an IMetricsLogger that puts only a sample of commands to a wrapped logger, for
+// connections executing so many commands that keeping all of them is not worth the cost.
+//
+// Metrics returned by SamplingMetricsLogger are calculated by the wrapped logger from the sampled commands, except
+// that Metrics.TotalNumCmds counts all commands (sampled or not) and Metrics.SampleRate reports the ratio of commands
+// that were kept, and Metrics.TotalCost sums up the cost of all commands. Counts and rates of time-windowed metrics (Metrics.Windows) are scaled up to estimate all commands:
+// by the sample rate of failed commands and of other commands separately if KeepErrors is set, by SampleRate
+// otherwise. Cost statistics are calculated from the sampled commands only, and commands kept because of
+// KeepCostAbove are over-represented.
+//
+// @Available since <<VERSION>>
+type SamplingMetricsLogger struct {
+	logger   IMetricsLogger
+	opts     SamplingMetricsLoggerOpts
+	lock     sync.RWMutex
+	counters map[string]*samplingCounter
+}
+
+type samplingCounter struct {
+	total, kept int64
+	errors      int64  // number of failed commands, used if KeepErrors is set (failed commands are then all kept)
+	costBits    uint64 // total cost of all commands, as float64 bits
+}
+
+func (c *samplingCounter) addCost(cost float64) {
+	for {
+		old := atomic.LoadUint64(&c.costBits)
+		if atomic.CompareAndSwapUint64(&c.costBits, old, math.Float64bits(math.Float64frombits(old)+cost)) {
+			return
+		}
+	}
+}
+
+// Logger returns the wrapped logger.
+func (logger *SamplingMetricsLogger) Logger() IMetricsLogger {
+	return logger.logger
+}
+
+// Opts returns the options this logger was created with.
+func (logger *SamplingMetricsLogger) Opts() SamplingMetricsLoggerOpts {
+	return logger.opts
+}
+
+func (logger *SamplingMetricsLogger) getCounter(category string) *samplingCounter {
+	logger.lock.RLock()
+	counter := logger.counters[category]
+	logger.lock.RUnlock()
+	if counter != nil {
+		return counter
+	}
+
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	counter = logger.counters[category]
+	if counter == nil {
+		counter = &samplingCounter{}
+		logger.counters[category] = counter
+	}
+	return counter
+}
+
+func isErrorCmd(cmd *CmdExecInfo) bool {
+	return cmd.Result == CmdResultError || cmd.Error != nil
+}
+
+// shouldKeep decides if the n-th command (1-based) of a category is kept.
+func (logger *SamplingMetricsLogger) shouldKeep(n int64, cmd *CmdExecInfo) bool {
+	if logger.opts.KeepErrors && isErrorCmd(cmd) {
+		return true
+	}
+	if logger.opts.KeepCostAbove > 0 && cmd.Cost > logger.opts.KeepCostAbove {
+		return true
+	}
+	switch logger.opts.Mode {
+	case SamplingProbabilistic:
+		p := logger.opts.Probability
+		return p <= 0 || p >= 1 || rand.Float64() < p
+	default:
+		return logger.opts.N < 2 || n%int64(logger.opts.N) == 1
+	}
+}
+
+// Put implements IMetricsLogger.Put.
+func (logger *SamplingMetricsLogger) Put(category string, cmd *CmdExecInfo) error {
+	if cmd == nil {
+		return errors.New("nil input")
+	}
+	counter := logger.getCounter(category)
+	n := atomic.AddInt64(&counter.total, 1)
+	counter.addCost(cmd.Cost)
+	if logger.opts.KeepErrors && isErrorCmd(cmd) {
+		atomic.AddInt64(&counter.errors, 1)
+	}
+	if !logger.shouldKeep(n, cmd) {
+		return nil
+	}
+	atomic.AddInt64(&counter.kept, 1)
+	return logger.logger.Put(category, cmd)
+}
+
+// Metrics implements IMetricsLogger.Metrics.
+func (logger *SamplingMetricsLogger) Metrics(category string, opts ...MetricsOpts) (*Metrics, error) {
+	m, err := logger.logger.Metrics(category, opts...)
+	if err != nil || m == nil {
+		return m, err
+	}
+	result := *m
+	counter := logger.getCounter(category)
+	total, kept, errors := atomic.LoadInt64(&counter.total), atomic.LoadInt64(&counter.kept), atomic.LoadInt64(&counter.errors)
+	result.TotalNumCmds = total
+	result.TotalCost = math.Float64frombits(atomic.LoadUint64(&counter.costBits))
+	if total > 0 {
+		result.SampleRate = float64(kept) / float64(total)
+	}
+	if len(m.Windows) > 0 {
+		result.Windows = make([]*WindowMetrics, len(m.Windows))
+		for i, w := range m.Windows {
+			result.Windows[i] = scaleWindowMetrics(w, total, kept, errors, logger.opts.KeepErrors)
+		}
+	}
+	return &result, nil
+}
+
+// scaleWindowMetrics scales counts and rate of sampled time-windowed metrics up to estimate all commands.
+func scaleWindowMetrics(w *WindowMetrics, total, kept, errors int64, keepErrors bool) *WindowMetrics {
+	result := *w
+	if kept <= 0 || kept >= total || w.NumCmds == 0 {
+		return &result
+	}
+	if keepErrors {
+		// failed commands are all kept, only the other ones are sampled
+		numOthers := float64(w.NumCmds - w.NumErrors)
+		if kept > errors {
+			numOthers *= float64(total-errors) / float64(kept-errors)
+		}
+		result.NumCmds = w.NumErrors + int64(math.Round(numOthers))
+	} else {
+		scale := float64(total) / float64(kept)
+		result.NumCmds = int64(math.Round(float64(w.NumCmds) * scale))
+		result.NumErrors = int64(math.Round(float64(w.NumErrors) * scale))
+	}
+	if result.NumCmds > 0 {
+		result.ErrorRatio = float64(result.NumErrors) / float64(result.NumCmds)
+	}
+	result.CmdsPerSec = w.CmdsPerSec * float64(result.NumCmds) / float64(w.NumCmds)
+	return &result
+}
+
+// Categories implements IMetricsCategoryLister.Categories.
+// This function returns nil if the wrapped logger does not implement IMetricsCategoryLister.
+func (logger *SamplingMetricsLogger) Categories() []string {
+	if lister, ok := logger.logger.(IMetricsCategoryLister); ok {
+		return lister.Categories()
+	}
+	return nil
+}
+
+// Reset implements IMetricsResetter.Reset.
+// Counters of the category are reset, and so is the wrapped logger if it implements IMetricsResetter.
+func (logger *SamplingMetricsLogger) Reset(category string) {
+	logger.lock.Lock()
+	if _, ok := logger.counters[category]; ok {
+		logger.counters[category] = &samplingCounter{}
+	}
+	logger.lock.Unlock()
+	if resetter, ok := logger.logger.(IMetricsResetter); ok {
+		resetter.Reset(category)
+	}
+}
+
+// ResetAll implements IMetricsResetter.ResetAll.
+// All counters are reset, and so is the wrapped logger if it implements IMetricsResetter.
+func (logger *SamplingMetricsLogger) ResetAll() {
+	logger.lock.Lock()
+	logger.counters = make(map[string]*samplingCounter)
+	logger.lock.Unlock()
+	if resetter, ok := logger.logger.(IMetricsResetter); ok {
+		resetter.ResetAll()
+	}
+}
+
+// Remove implements IMetricsCategoryRemover.Remove.
+// Counters of the category are removed, and so is the category of the wrapped logger if it implements
+// IMetricsCategoryRemover.
+func (logger *SamplingMetricsLogger) Remove(category string) {
+	logger.lock.Lock()
+	delete(logger.counters, category)
+	logger.lock.Unlock()
+	if remover, ok := logger.logger.(IMetricsCategoryRemover); ok {
+		remover.Remove(category)
+	}
+}
+
+// Close closes the wrapped logger if it implements io.Closer.
+func (logger *SamplingMetricsLogger) Close() error {
+	if closer, ok := logger.logger.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
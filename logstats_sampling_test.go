@@ -0,0 +1,137 @@
+package prom
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestSamplingMetricsLogger_OneInN(t *testing.T) {
+	testName := "TestSamplingMetricsLogger_OneInN"
+	memLogger := NewMemoryStoreMetricsLogger(1000)
+	logger := NewSamplingMetricsLogger(memLogger, SamplingMetricsLoggerOpts{N: 10})
+	if logger.Logger() != memLogger {
+		t.Fatalf("%s failed: wrapped logger mismatched", testName)
+	}
+	if err := logger.Put(MetricsCatAll, nil); err == nil {
+		t.Fatalf("%s failed: expected error when putting nil command", testName)
+	}
+	for i := 1; i <= 100; i++ {
+		_ = logger.Put(MetricsCatAll, &CmdExecInfo{Id: strconv.Itoa(i), Cost: 1})
+	}
+	m, err := logger.Metrics(MetricsCatAll, MetricsOpts{ReturnLatestCommands: 100})
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if m.TotalNumCmds != 100 || m.ReservoirNumCmds != 10 || m.SampleRate != 0.1 || m.TotalCost != 100 {
+		t.Fatalf("%s failed: unexpected metrics %#v", testName, m)
+	}
+	if m.LastNCmds[0].Id != "91" || m.LastNCmds[9].Id != "1" {
+		t.Fatalf("%s failed: unexpected sampled commands %#v / %#v", testName, m.LastNCmds[0], m.LastNCmds[9])
+	}
+	if inner, _ := memLogger.Metrics(MetricsCatAll); inner.TotalNumCmds != 10 || inner.SampleRate != 0 {
+		t.Fatalf("%s failed: wrapped logger's metrics must not be modified %#v", testName, inner)
+	}
+	if cats := logger.Categories(); len(cats) != 1 || cats[0] != MetricsCatAll {
+		t.Fatalf("%s failed: unexpected categories %#v", testName, cats)
+	}
+}
+
+func TestSamplingMetricsLogger_KeepAll(t *testing.T) {
+	testName := "TestSamplingMetricsLogger_KeepAll"
+	for _, opts := range []SamplingMetricsLoggerOpts{{}, {N: 1}, {Mode: SamplingProbabilistic}, {Mode: SamplingProbabilistic, Probability: 1.5}} {
+		logger := NewSamplingMetricsLogger(NewMemoryStoreMetricsLogger(100), opts)
+		for i := 0; i < 20; i++ {
+			_ = logger.Put(MetricsCatAll, &CmdExecInfo{})
+		}
+		if m, _ := logger.Metrics(MetricsCatAll); m.TotalNumCmds != 20 || m.ReservoirNumCmds != 20 || m.SampleRate != 1 {
+			t.Fatalf("%s failed: unexpected metrics %#v for options %#v", testName, m, opts)
+		}
+	}
+}
+
+func TestSamplingMetricsLogger_Probabilistic(t *testing.T) {
+	testName := "TestSamplingMetricsLogger_Probabilistic"
+	logger := NewSamplingMetricsLogger(NewMemoryStoreMetricsLogger(10000), SamplingMetricsLoggerOpts{Mode: SamplingProbabilistic, Probability: 0.25})
+	for i := 0; i < 10000; i++ {
+		_ = logger.Put(MetricsCatAll, &CmdExecInfo{})
+	}
+	m, _ := logger.Metrics(MetricsCatAll)
+	if m.TotalNumCmds != 10000 {
+		t.Fatalf("%s failed: expected %#v commands but received %#v", testName, 10000, m.TotalNumCmds)
+	}
+	if m.SampleRate < 0.2 || m.SampleRate > 0.3 || float64(m.ReservoirNumCmds) != m.SampleRate*10000 {
+		t.Fatalf("%s failed: unexpected sample rate %#v (%#v kept)", testName, m.SampleRate, m.ReservoirNumCmds)
+	}
+}
+
+func TestSamplingMetricsLogger_AlwaysKeep(t *testing.T) {
+	testName := "TestSamplingMetricsLogger_AlwaysKeep"
+	logger := NewSamplingMetricsLogger(NewMemoryStoreMetricsLogger(1000), SamplingMetricsLoggerOpts{N: 1000, KeepErrors: true, KeepCostAbove: 100})
+	for i := 1; i <= 100; i++ {
+		cmd := &CmdExecInfo{Id: strconv.Itoa(i), Cost: 1, Result: CmdResultOk}
+		switch i {
+		case 20:
+			cmd.Result = CmdResultError
+		case 30:
+			cmd.Error = errors.New("dummy")
+		case 40:
+			cmd.Cost = 101
+		case 50:
+			cmd.Cost = 100
+		}
+		_ = logger.Put(MetricsCatAll, cmd)
+	}
+	m, _ := logger.Metrics(MetricsCatAll, MetricsOpts{ReturnLatestCommands: 10})
+	if m.TotalNumCmds != 100 || m.ReservoirNumCmds != 4 || m.SampleRate != 0.04 {
+		t.Fatalf("%s failed: unexpected metrics %#v", testName, m)
+	}
+	ids := make([]string, 0)
+	for _, cmd := range m.LastNCmds {
+		ids = append(ids, cmd.Id)
+	}
+	if len(ids) != 4 || ids[0] != "40" || ids[1] != "30" || ids[2] != "20" || ids[3] != "1" {
+		t.Fatalf("%s failed: unexpected kept commands %#v", testName, ids)
+	}
+}
+
+func TestSamplingMetricsLogger_Windows(t *testing.T) {
+	testName := "TestSamplingMetricsLogger_Windows"
+	for _, keepErrors := range []bool{false, true} {
+		memLogger := NewMemoryStoreMetricsLogger(1000)
+		logger := NewSamplingMetricsLogger(memLogger, SamplingMetricsLoggerOpts{N: 10, KeepErrors: keepErrors})
+		for i := 1; i <= 100; i++ {
+			cmd := &CmdExecInfo{Id: strconv.Itoa(i), Cost: 1, Result: CmdResultOk}
+			if i%10 == 5 {
+				cmd.Result = CmdResultError
+			}
+			_ = logger.Put(MetricsCatAll, cmd)
+		}
+		m, _ := logger.Metrics(MetricsCatAll)
+		if m.SampleRate >= 1 || len(m.Windows) != len(DefaultMetricsTimeWindows) {
+			t.Fatalf("%s failed: unexpected metrics %#v", testName, m)
+		}
+		for _, w := range m.Windows {
+			if w.NumCmds != 100 || math.Abs(w.CmdsPerSec-100/w.Window.Seconds()) > 1e-9 {
+				t.Fatalf("%s failed: expected 100 commands but received %#v (keepErrors: %#v)", testName, w, keepErrors)
+			}
+			// without KeepErrors, failed commands are sampled like the others (1 out of 10 commands is kept)
+			expectedErrors := int64(10)
+			if !keepErrors {
+				expectedErrors = 0
+			}
+			if w.NumErrors != expectedErrors || math.Abs(w.ErrorRatio-float64(expectedErrors)/100) > 1e-9 {
+				t.Fatalf("%s failed: expected %#v errors but received %#v (keepErrors: %#v)", testName, expectedErrors, w, keepErrors)
+			}
+		}
+		if inner, _ := memLogger.Metrics(MetricsCatAll); inner.Windows[0].NumCmds == 100 {
+			t.Fatalf("%s failed: wrapped logger's metrics must not be modified %#v", testName, inner.Windows[0])
+		}
+	}
+}
+
+func TestSamplingMetricsLogger_ResetAndRemove(t *testing.T) {
+	logger := NewSamplingMetricsLogger(NewMemoryStoreMetricsLogger(10), SamplingMetricsLoggerOpts{KeepErrors: true})
+	testMetricsResetAndRemove(t, "TestSamplingMetricsLogger_ResetAndRemove", logger, nil)
+}
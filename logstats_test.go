@@ -5,6 +5,8 @@ import (
 	"math"
 	"math/rand"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -144,6 +146,9 @@ func TestMemoryStoreMetricsLogger_Metrics(t *testing.T) {
 		if m.TotalNumCmds != int64(i+1) {
 			t.Fatalf("%s failed: expected TotalNumCmds to be %#v but received %#v", testName, i+1, m.TotalNumCmds)
 		}
+		if e := float64((i + 1) * (i + 2) / 2); m.TotalCost != e {
+			t.Fatalf("%s failed: expected TotalCost to be %#v but received %#v", testName, e, m.TotalCost)
+		}
 		if v, e := m.ReservoirNumCmds, int64(math.Min(float64(i+1), float64(capacity))); v != e {
 			t.Fatalf("%s failed: expected ReservoirNumCmds to be %#v but received %#v", testName, e, v)
 		}
@@ -157,3 +162,264 @@ func TestMemoryStoreMetricsLogger_Metrics(t *testing.T) {
 		}
 	}
 }
+
+func TestMemoryStoreMetricsLogger_AppendLatestCommands(t *testing.T) {
+	testName := "TestMemoryStoreMetricsLogger_AppendLatestCommands"
+	capacity := 10
+	logger := NewMemoryStoreMetricsLogger(capacity).(*MemoryStoreMetricsLogger)
+	if cmds := logger.AppendLatestCommands(nil, "*", 5); len(cmds) != 0 {
+		t.Fatalf("%s failed: expected no command but received %#v", testName, len(cmds))
+	}
+	for i := 0; i < 2*capacity+3; i++ {
+		_ = logger.Put("*", &CmdExecInfo{Id: strconv.Itoa(i + 1)})
+	}
+	buf := make([]*CmdExecInfo, 0, capacity)
+	cmds := logger.AppendLatestCommands(buf, "*", capacity+5)
+	if len(cmds) != capacity {
+		t.Fatalf("%s failed: expected %#v commands but received %#v", testName, capacity, len(cmds))
+	}
+	for j, cmd := range cmds {
+		if v, e := cmd.Id, strconv.Itoa(2*capacity+3-j); v != e {
+			t.Fatalf("%s failed: expected cmds[%d] to be %#v but received %#v", testName, j, e, v)
+		}
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = logger.AppendLatestCommands(buf[:0], "*", capacity)
+	})
+	if allocs != 0 {
+		t.Fatalf("%s failed: expected no allocation but received %#v", testName, allocs)
+	}
+}
+
+func TestMemoryStoreMetricsLogger_Categories(t *testing.T) {
+	testName := "TestMemoryStoreMetricsLogger_Categories"
+	logger := &MemoryStoreMetricsLogger{capacity: 10}
+	if cats := logger.Categories(); len(cats) != 0 {
+		t.Fatalf("%s failed: expected no category but received %#v", testName, cats)
+	}
+	for _, cat := range []string{"dql", "all", "dml"} {
+		_ = logger.Put(cat, &CmdExecInfo{Id: cat})
+	}
+	if cats := strings.Join(logger.Categories(), ","); cats != "all,dml,dql" {
+		t.Fatalf("%s failed: expected categories %#v but received %#v", testName, "all,dml,dql", cats)
+	}
+}
+
+func TestMemoryStoreMetricsLogger_ReadDoesNotCreate(t *testing.T) {
+	testName := "TestMemoryStoreMetricsLogger_ReadDoesNotCreate"
+	logger := NewMemoryStoreMetricsLogger(10).(*MemoryStoreMetricsLogger)
+	_ = logger.Put(MetricsCatDQL, &CmdExecInfo{Id: "1", Cost: 1})
+	m, err := logger.Metrics("unknown", MetricsOpts{ReturnLatestCommands: 10})
+	if err != nil || m == nil || m.Category != "unknown" || m.TotalNumCmds != 0 || len(m.LastNCmds) != 0 {
+		t.Fatalf("%s failed: expected empty metrics but received %#v / %s", testName, m, err)
+	}
+	if len(m.Windows) != len(DefaultMetricsTimeWindows) || m.Windows[0].Window != DefaultMetricsTimeWindows[0] || m.Windows[0].NumCmds != 0 {
+		t.Fatalf("%s failed: unexpected time-windowed metrics %#v", testName, m.Windows)
+	}
+	if cmds := logger.AppendLatestCommands(nil, "unknown-2", 10); len(cmds) != 0 {
+		t.Fatalf("%s failed: expected no command but received %#v", testName, cmds)
+	}
+	if cats := logger.Categories(); len(cats) != 1 || cats[0] != MetricsCatDQL {
+		t.Fatalf("%s failed: reading unknown categories must not create them %#v", testName, cats)
+	}
+}
+
+// testMetricsResetAndRemove verifies IMetricsResetter and IMetricsCategoryRemover implementations of a logger
+// (flush is called, if not nil, before verifying metrics).
+func testMetricsResetAndRemove(t *testing.T, testName string, logger IMetricsLogger, flush func()) {
+	if flush == nil {
+		flush = func() {}
+	}
+	resetter, ok := logger.(IMetricsResetter)
+	if !ok {
+		t.Fatalf("%s failed: IMetricsResetter not implemented", testName)
+	}
+	remover, ok := logger.(IMetricsCategoryRemover)
+	if !ok {
+		t.Fatalf("%s failed: IMetricsCategoryRemover not implemented", testName)
+	}
+	lister := logger.(IMetricsCategoryLister)
+	for _, category := range []string{MetricsCatDDL, MetricsCatDML, MetricsCatDQL} {
+		for i := 0; i < 3; i++ {
+			_ = logger.Put(category, &CmdExecInfo{Id: strconv.Itoa(i), Cost: 1})
+		}
+	}
+	flush()
+
+	resetter.Reset(MetricsCatDML)
+	resetter.Reset("not-exist")
+	if m, _ := logger.Metrics(MetricsCatDML, MetricsOpts{ReturnLatestCommands: 10}); m.TotalNumCmds != 0 || m.ReservoirNumCmds != 0 || len(m.LastNCmds) != 0 {
+		t.Fatalf("%s failed: category not reset %#v", testName, m)
+	}
+	if m, _ := logger.Metrics(MetricsCatDQL); m.TotalNumCmds != 3 {
+		t.Fatalf("%s failed: other categories must not be reset %#v", testName, m)
+	}
+	if cats := lister.Categories(); strings.Join(cats, ",") != "ddl,dml,dql" {
+		t.Fatalf("%s failed: unexpected categories %#v", testName, cats)
+	}
+
+	remover.Remove(MetricsCatDDL)
+	if cats := lister.Categories(); strings.Join(cats, ",") != "dml,dql" {
+		t.Fatalf("%s failed: unexpected categories %#v", testName, cats)
+	}
+	if m, _ := logger.Metrics(MetricsCatDDL); m == nil || m.TotalNumCmds != 0 {
+		t.Fatalf("%s failed: expected empty metrics of removed category but received %#v", testName, m)
+	}
+	if cats := lister.Categories(); strings.Join(cats, ",") != "dml,dql" {
+		t.Fatalf("%s failed: reading metrics must not bring back the removed category %#v", testName, cats)
+	}
+	_ = logger.Put(MetricsCatDDL, &CmdExecInfo{Id: "1"})
+	flush()
+	if m, _ := logger.Metrics(MetricsCatDDL); m.TotalNumCmds != 1 {
+		t.Fatalf("%s failed: removed category must start from scratch %#v", testName, m)
+	}
+
+	resetter.ResetAll()
+	for _, category := range lister.Categories() {
+		if m, _ := logger.Metrics(category); m.TotalNumCmds != 0 {
+			t.Fatalf("%s failed: category %s not reset %#v", testName, category, m)
+		}
+	}
+}
+
+func TestMemoryStoreMetricsLogger_ResetAndRemove(t *testing.T) {
+	testMetricsResetAndRemove(t, "TestMemoryStoreMetricsLogger_ResetAndRemove", NewMemoryStoreMetricsLogger(10), nil)
+}
+
+func TestMemoryStoreMetricsLogger_SetTimeWindows(t *testing.T) {
+	testName := "TestMemoryStoreMetricsLogger_SetTimeWindows"
+	logger := NewMemoryStoreMetricsLogger(10).(*MemoryStoreMetricsLogger)
+	if v, e := len(logger.TimeWindows()), len(DefaultMetricsTimeWindows); v != e {
+		t.Fatalf("%s failed: expected %#v time windows but received %#v", testName, e, v)
+	}
+	_ = logger.Put("*", &CmdExecInfo{Id: "1", Cost: 1, EndTime: time.Now()})
+	logger.SetTimeWindows(10 * time.Second)
+	if v := logger.TimeWindows(); len(v) != 1 || v[0] != 10*time.Second {
+		t.Fatalf("%s failed: expected time windows %#v but received %#v", testName, []time.Duration{10 * time.Second}, v)
+	}
+	m, _ := logger.Metrics("*")
+	if len(m.Windows) != 1 || m.Windows[0].Window != 10*time.Second || m.Windows[0].NumCmds != 0 {
+		t.Fatalf("%s failed: unexpected time-windowed metrics %#v", testName, m.Windows)
+	}
+	logger.SetTimeWindows()
+	if m, _ = logger.Metrics("*"); m.Windows != nil {
+		t.Fatalf("%s failed: expected no time-windowed metrics but received %#v", testName, m.Windows)
+	}
+}
+
+func TestMemoryStoreMetricsLogger_Metrics_Windows(t *testing.T) {
+	testName := "TestMemoryStoreMetricsLogger_Metrics_Windows"
+	logger := NewMemoryStoreMetricsLogger(1000).(*MemoryStoreMetricsLogger)
+	logger.SetTimeWindows(1*time.Minute, 5*time.Minute)
+	now := time.Now()
+	// 100 commands within the last minute, every 4th fails
+	for i := 1; i <= 100; i++ {
+		cmd := &CmdExecInfo{Id: strconv.Itoa(i), Cost: float64(i), EndTime: now.Add(-time.Duration(i) * 100 * time.Millisecond), Result: CmdResultOk}
+		if i%4 == 0 {
+			cmd.Result = CmdResultError
+		}
+		_ = logger.Put("*", cmd)
+	}
+	// 50 commands between 2 and 3 minutes ago
+	for i := 1; i <= 50; i++ {
+		_ = logger.Put("*", &CmdExecInfo{Id: strconv.Itoa(i + 100), Cost: 1000, EndTime: now.Add(-2*time.Minute - time.Duration(i)*time.Second), Result: CmdResultOk})
+	}
+	// too old to be included in any window
+	_ = logger.Put("*", &CmdExecInfo{Id: "old", Cost: 1, EndTime: now.Add(-time.Hour), Result: CmdResultError})
+
+	m, err := logger.Metrics("*")
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if len(m.Windows) != 2 {
+		t.Fatalf("%s failed: expected %#v time windows but received %#v", testName, 2, len(m.Windows))
+	}
+	w1, w5 := m.Windows[0], m.Windows[1]
+	if w1.Window != time.Minute || w1.NumCmds != 100 || w1.NumErrors != 25 || w1.ErrorRatio != 0.25 {
+		t.Fatalf("%s failed: unexpected 1m window metrics %#v", testName, w1)
+	}
+	if w1.MinCost != 1 || w1.MaxCost != 100 || w1.MeanCost != 50.5 || w1.P50Cost != 50 || w1.P99Cost != 99 {
+		t.Fatalf("%s failed: unexpected 1m window cost statistics %#v", testName, w1)
+	}
+	if w1.CmdsPerSec != 100.0/60 {
+		t.Fatalf("%s failed: expected command rate %#v but received %#v", testName, 100.0/60, w1.CmdsPerSec)
+	}
+	if w5.Window != 5*time.Minute || w5.NumCmds != 150 || w5.NumErrors != 25 || w5.MaxCost != 1000 || w5.CmdsPerSec != 150.0/300 {
+		t.Fatalf("%s failed: unexpected 5m window metrics %#v", testName, w5)
+	}
+}
+
+func TestTimeWindow_Sampling(t *testing.T) {
+	testName := "TestTimeWindow_Sampling"
+	w := newTimeWindows([]time.Duration{time.Minute})[0]
+	rnd := rand.New(rand.NewSource(1))
+	now := time.Now()
+	n := 10000
+	for i := 0; i < n; i++ {
+		w.put(now, float64(i%100), false, rnd)
+	}
+	m := w.snapshot(now)
+	if m.NumCmds != int64(n) || m.MinCost != 0 || m.MaxCost != 99 {
+		t.Fatalf("%s failed: unexpected window metrics %#v", testName, m)
+	}
+	if m.P50Cost < 30 || m.P50Cost > 70 {
+		t.Fatalf("%s failed: sampled p50 %#v is too far from expected value %#v", testName, m.P50Cost, 50)
+	}
+}
+
+func benchmarkMemoryStoreMetricsLoggerPut(b *testing.B, numCategories int) {
+	logger := NewMemoryStoreMetricsLogger(1028)
+	categories := make([]string, numCategories)
+	for i := range categories {
+		categories[i] = "cat" + strconv.Itoa(i)
+	}
+	var counter int64
+	b.ReportAllocs()
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddInt64(&counter, 1))
+		cmd := &CmdExecInfo{Id: "1", Cost: 123, Result: CmdResultOk, EndTime: time.Now()}
+		for pb.Next() {
+			_ = logger.Put(categories[i%numCategories], cmd)
+			i++
+		}
+	})
+}
+
+func BenchmarkMemoryStoreMetricsLogger_Put_1Category(b *testing.B) {
+	benchmarkMemoryStoreMetricsLoggerPut(b, 1)
+}
+
+func BenchmarkMemoryStoreMetricsLogger_Put_16Categories(b *testing.B) {
+	benchmarkMemoryStoreMetricsLoggerPut(b, 16)
+}
+
+func BenchmarkMemoryStoreMetricsLogger_Put_256Categories(b *testing.B) {
+	benchmarkMemoryStoreMetricsLoggerPut(b, 256)
+}
+
+func BenchmarkMemoryStoreMetricsLogger_Metrics(b *testing.B) {
+	logger := NewMemoryStoreMetricsLogger(1028)
+	for i := 0; i < 2000; i++ {
+		_ = logger.Put(MetricsCatAll, &CmdExecInfo{Id: strconv.Itoa(i), Cost: float64(i)})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = logger.Metrics(MetricsCatAll, MetricsOpts{ReturnLatestCommands: 100})
+	}
+}
+
+func BenchmarkMemoryStoreMetricsLogger_AppendLatestCommands(b *testing.B) {
+	logger := NewMemoryStoreMetricsLogger(1028).(*MemoryStoreMetricsLogger)
+	for i := 0; i < 2000; i++ {
+		_ = logger.Put(MetricsCatAll, &CmdExecInfo{Id: strconv.Itoa(i), Cost: float64(i)})
+	}
+	buf := make([]*CmdExecInfo, 0, 1028)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = logger.AppendLatestCommands(buf[:0], MetricsCatAll, 1028)
+	}
+}
@@ -0,0 +1,188 @@
+package prom
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// DefaultMetricsTimeWindows are the sliding time windows MemoryStoreMetricsLogger calculates metrics for by default.
+//
+// @Available since <<VERSION>>
+var DefaultMetricsTimeWindows = []time.Duration{1 * time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// WindowMetrics is the snapshot of command execution metrics within a sliding time window.
+//
+// Commands are placed into time windows based on their EndTime (or the time they are logged, if EndTime is zero).
+// Cost statistics are calculated from a bounded sample of commands within the window, hence they are approximated
+// values when the window holds a large number of commands.
+//
+// @Available since <<VERSION>>
+type WindowMetrics struct {
+	// Length of the time window.
+	Window time.Duration `json:"window"`
+
+	// Number of commands executed within the time window.
+	NumCmds int64 `json:"total"`
+
+	// Number of failed or rejected commands (Result is CmdResultError or CmdResultRejected) within the time window.
+	NumErrors int64 `json:"errors"`
+
+	// Ratio of failed or rejected commands over all commands within the time window.
+	ErrorRatio float64 `json:"error_ratio"`
+
+	// Number of commands per second executed within the time window: NumCmds divided by the length of the window, hence
+	// the rate is under-reported until the window has been filled (e.g. right after the logger is created).
+	CmdsPerSec float64 `json:"rate"`
+
+	// The statistics minimum value of command execution cost.
+	MinCost float64 `json:"min"`
+
+	// The statistics maximum value of command execution cost.
+	MaxCost float64 `json:"max"`
+
+	// The statistics mean value of command execution cost.
+	MeanCost float64 `json:"avg"`
+
+	// The statistics p99 value of command execution cost.
+	P99Cost float64 `json:"p99"`
+
+	// The statistics p95 value of command execution cost.
+	P95Cost float64 `json:"p95"`
+
+	// The statistics p90 value of command execution cost.
+	P90Cost float64 `json:"p90"`
+
+	// The statistics p75 value of command execution cost.
+	P75Cost float64 `json:"p75"`
+
+	// The statistics p50 value of command execution cost.
+	P50Cost float64 `json:"p50"`
+}
+
+const (
+	windowNumBuckets       = 60
+	windowBucketSampleSize = 64
+)
+
+func newTimeWindows(windows []time.Duration) []*timeWindow {
+	result := make([]*timeWindow, 0, len(windows))
+	for _, w := range windows {
+		if w <= 0 {
+			continue
+		}
+		width := int64(w) / windowNumBuckets
+		if width <= 0 {
+			width = 1
+		}
+		result = append(result, &timeWindow{window: w, width: width})
+	}
+	return result
+}
+
+// timeWindow is a sliding time window made of windowNumBuckets buckets. Each bucket covers a slot of
+// window/windowNumBuckets and keeps counters as well as a reservoir of sampled costs.
+//
+// timeWindow is not thread-safe, access must be guarded by the owner's lock.
+type timeWindow struct {
+	window  time.Duration
+	width   int64 // bucket width in nanoseconds
+	buckets [windowNumBuckets]windowBucket
+}
+
+type windowBucket struct {
+	epoch    int64
+	count    int64
+	errors   int64
+	sum      float64
+	min, max float64
+	samples  []float64
+}
+
+func (w *timeWindow) put(t time.Time, cost float64, isError bool, rnd *rand.Rand) {
+	epoch := t.UnixNano() / w.width
+	b := &w.buckets[epoch%windowNumBuckets]
+	if b.epoch != epoch {
+		if epoch < b.epoch {
+			// the slot has been taken by a newer bucket, the item is too old
+			return
+		}
+		b.epoch, b.count, b.errors, b.sum = epoch, 0, 0, 0
+		b.samples = b.samples[:0]
+	}
+	b.count++
+	if isError {
+		b.errors++
+	}
+	b.sum += cost
+	if b.count == 1 || cost < b.min {
+		b.min = cost
+	}
+	if b.count == 1 || cost > b.max {
+		b.max = cost
+	}
+	if len(b.samples) < windowBucketSampleSize {
+		b.samples = append(b.samples, cost)
+	} else if j := rnd.Int63n(b.count); j < windowBucketSampleSize {
+		b.samples[j] = cost
+	}
+}
+
+type weightedSample struct {
+	value, weight float64
+}
+
+func (w *timeWindow) snapshot(now time.Time) *WindowMetrics {
+	m := &WindowMetrics{Window: w.window}
+	nowEpoch := now.UnixNano() / w.width
+	samples := make([]weightedSample, 0)
+	var sum float64
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.count == 0 || b.epoch > nowEpoch || b.epoch <= nowEpoch-windowNumBuckets {
+			continue
+		}
+		if m.NumCmds == 0 || b.min < m.MinCost {
+			m.MinCost = b.min
+		}
+		if m.NumCmds == 0 || b.max > m.MaxCost {
+			m.MaxCost = b.max
+		}
+		m.NumCmds += b.count
+		m.NumErrors += b.errors
+		sum += b.sum
+		weight := float64(b.count) / float64(len(b.samples))
+		for _, v := range b.samples {
+			samples = append(samples, weightedSample{value: v, weight: weight})
+		}
+	}
+	if m.NumCmds == 0 {
+		return m
+	}
+	m.MeanCost = sum / float64(m.NumCmds)
+	m.ErrorRatio = float64(m.NumErrors) / float64(m.NumCmds)
+	m.CmdsPerSec = float64(m.NumCmds) / w.window.Seconds()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].value < samples[j].value })
+	m.P99Cost = weightedPercentile(samples, float64(m.NumCmds), 0.99)
+	m.P95Cost = weightedPercentile(samples, float64(m.NumCmds), 0.95)
+	m.P90Cost = weightedPercentile(samples, float64(m.NumCmds), 0.90)
+	m.P75Cost = weightedPercentile(samples, float64(m.NumCmds), 0.75)
+	m.P50Cost = weightedPercentile(samples, float64(m.NumCmds), 0.50)
+	return m
+}
+
+// weightedPercentile returns the smallest sample value at which the cumulative weight reaches p of the total weight.
+// Input samples must be sorted by value in ascending order.
+func weightedPercentile(samples []weightedSample, totalWeight, p float64) float64 {
+	threshold := math.Ceil(p*totalWeight - 1e-9)
+	var cumulative float64
+	for _, s := range samples {
+		cumulative += s.weight
+		if cumulative >= threshold-1e-9 {
+			return s.value
+		}
+	}
+	return samples[len(samples)-1].value
+}
@@ -1,6 +1,9 @@
 package prom
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
 // IBasePoolOpts is the base interface to define configurations for a connection pool.
 //
@@ -22,6 +25,19 @@ type BasePoolOpts struct {
 	// Maximum amount of time a connection may be reused.
 	// Set to zero or negative value to use default value.
 	ConnLifetime time.Duration `json:"conn_lifetime"`
+
+	// Maximum amount of time a connection may be idle before being closed.
+	// Set to zero or negative value to keep idle connections open.
+	//
+	// @Available since <<VERSION>>
+	IdleTimeout time.Duration `json:"idle_timeout"`
+
+	// Maximum amount of time to wait for a connection when the pool is exhausted, applied if the context passed to
+	// the pool has no deadline. Set to zero or negative value to wait until the context is done.
+	// Note: not every connection type supports this setting (e.g. database/sql's pool does not).
+	//
+	// @Available since <<VERSION>>
+	AcquireTimeout time.Duration `json:"acquire_timeout"`
 }
 
 // IBaseConnection is the base interface to define a connection.
@@ -57,6 +73,20 @@ type IBaseConnection interface {
 type BaseConnection struct {
 	poolOpts      IBasePoolOpts
 	metricsLogger IMetricsLogger
+	slowCmdLock   sync.RWMutex
+	slowCmdHooks  map[string][]slowCmdHook
+}
+
+// SlowCmdHandler is a callback invoked by BaseConnection.LogMetrics when a logged command's execution cost exceeds
+// the registered threshold. Handlers are invoked synchronously on the command execution path, hence they should
+// return quickly.
+//
+// @Available since <<VERSION>>
+type SlowCmdHandler func(category string, cmd *CmdExecInfo)
+
+type slowCmdHook struct {
+	threshold float64
+	handler   SlowCmdHandler
 }
 
 // PoolOpts implements IBaseConnection.PoolOpts.
@@ -90,14 +120,66 @@ func (c *BaseConnection) NewCmdExecInfo() *CmdExecInfo {
 	}
 }
 
+// RegisterSlowCmdHandler registers a handler to be invoked when a command logged under the specified category has
+// execution cost greater than the threshold. Multiple handlers can be registered for the same category.
+//
+// Note: a command is usually logged under several categories (e.g. MetricsCatAll and MetricsCatDQL), register the
+// handler for only one of them to be notified once per command.
+//
+// This function returns the connection itself for chaining.
+//
+// @Available since <<VERSION>>
+func (c *BaseConnection) RegisterSlowCmdHandler(category string, threshold float64, handler SlowCmdHandler) *BaseConnection {
+	if handler == nil {
+		return c
+	}
+	c.slowCmdLock.Lock()
+	defer c.slowCmdLock.Unlock()
+	if c.slowCmdHooks == nil {
+		c.slowCmdHooks = make(map[string][]slowCmdHook)
+	}
+	c.slowCmdHooks[category] = append(c.slowCmdHooks[category], slowCmdHook{threshold: threshold, handler: handler})
+	return c
+}
+
+// UnregisterSlowCmdHandlers removes all slow-command handlers registered for the specified category.
+//
+// This function returns the connection itself for chaining.
+//
+// @Available since <<VERSION>>
+func (c *BaseConnection) UnregisterSlowCmdHandlers(category string) *BaseConnection {
+	c.slowCmdLock.Lock()
+	defer c.slowCmdLock.Unlock()
+	delete(c.slowCmdHooks, category)
+	return c
+}
+
 // LogMetrics implements IBaseConnection.LogMetrics.
+//
+// (since <<VERSION>>) Slow-command handlers registered for the category are invoked if the command's cost exceeds
+// their thresholds, regardless of whether a metrics logger is attached.
 func (c *BaseConnection) LogMetrics(category string, cmd *CmdExecInfo) error {
-	if cmd != nil && c.metricsLogger != nil {
+	if cmd == nil {
+		return nil
+	}
+	c.notifySlowCmd(category, cmd)
+	if c.metricsLogger != nil {
 		return c.metricsLogger.Put(category, cmd)
 	}
 	return nil
 }
 
+func (c *BaseConnection) notifySlowCmd(category string, cmd *CmdExecInfo) {
+	c.slowCmdLock.RLock()
+	hooks := c.slowCmdHooks[category]
+	c.slowCmdLock.RUnlock()
+	for _, hook := range hooks {
+		if cmd.Cost > hook.threshold {
+			hook.handler(category, cmd)
+		}
+	}
+}
+
 // Metrics implements IBaseConnection.Metrics.
 func (c *BaseConnection) Metrics(category string, opts ...MetricsOpts) (*Metrics, error) {
 	if c.metricsLogger != nil {
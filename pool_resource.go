@@ -0,0 +1,424 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// MetricsCatPool is the metrics category of resource acquisitions from a Pool.
+	//
+	// @Available since <<VERSION>>
+	MetricsCatPool = "pool"
+
+	// MetricsCatPoolExhausted is the metrics category of resource acquisitions that found the Pool exhausted, i.e.
+	// had to wait for a resource to be released.
+	//
+	// @Available since <<VERSION>>
+	MetricsCatPoolExhausted = "pool_exhausted"
+)
+
+const (
+	defaultResourcePoolMaxSize = 8
+	minResourcePoolEvictEvery  = 100 * time.Millisecond
+)
+
+var (
+	// ErrPoolClosed is returned when acquiring a resource from a Pool that has been closed.
+	//
+	// @Available since <<VERSION>>
+	ErrPoolClosed = errors.New("pool has been closed")
+
+	// ErrPoolAcquireTimeout is returned when no resource becomes available within BasePoolOpts.AcquireTimeout.
+	//
+	// @Available since <<VERSION>>
+	ErrPoolAcquireTimeout = errors.New("timeout waiting for a resource from the pool")
+)
+
+// PoolHooks are callbacks a Pool uses to manage its resources.
+//
+// @Available since <<VERSION>>
+type PoolHooks[T any] struct {
+	// Factory creates a new resource. Required.
+	Factory func(ctx context.Context) (T, error)
+
+	// Validate checks if an idle resource is still healthy before it is handed out. Optional.
+	// Resources failing the check are closed and another resource is acquired instead.
+	Validate func(ctx context.Context, resource T) error
+
+	// Close releases a resource that is removed from the pool. Optional.
+	Close func(resource T) error
+}
+
+// PoolStats is a snapshot of a Pool's state and counters.
+//
+// @Available since <<VERSION>>
+type PoolStats struct {
+	// Number of resources currently held by the pool (idle and in use).
+	Size int `json:"size"`
+
+	// Number of idle resources.
+	Idle int `json:"idle"`
+
+	// Number of resources in use.
+	InUse int `json:"in_use"`
+
+	// Total number of resources created.
+	Created int64 `json:"created"`
+
+	// Total number of resources closed (expired, idle for too long, failed health check or destroyed).
+	Closed int64 `json:"closed"`
+
+	// Total number of acquisitions that found the pool exhausted.
+	Exhausted int64 `json:"exhausted"`
+
+	// Total number of acquisitions that failed because no resource became available in time.
+	Timeouts int64 `json:"timeouts"`
+}
+
+// NewPool creates a new Pool instance.
+//   - poolOpts: pooling options. If nil, default options are used (MaxPoolSize=8, MinPoolSize=1).
+//     MaxPoolSize limits the number of resources, MinPoolSize is the number of idle resources kept open when evicting
+//     idle resources, ConnLifetime/IdleTimeout are the maximum age/idle time of resources and AcquireTimeout is the
+//     default acquisition timeout.
+//   - hooks: callbacks to create, validate and close resources.
+//
+// MinPoolSize resources are created upfront, this function returns error if any of them cannot be created.
+//
+// The returned pool logs resource acquisitions (with waiting time, in microseconds, as cost) to a
+// MemoryStoreMetricsLogger under categories MetricsCatAll and MetricsCatPool (and MetricsCatPoolExhausted if the pool
+// is exhausted); use RegisterMetricsLogger to use another logger.
+//
+// @Available since <<VERSION>>
+func NewPool[T any](poolOpts *BasePoolOpts, hooks PoolHooks[T]) (*Pool[T], error) {
+	if hooks.Factory == nil {
+		return nil, errors.New("resource factory is required")
+	}
+	opts := BasePoolOpts{MaxPoolSize: defaultResourcePoolMaxSize, MinPoolSize: 1}
+	if poolOpts != nil {
+		opts = *poolOpts
+		if opts.MaxPoolSize <= 0 {
+			opts.MaxPoolSize = defaultResourcePoolMaxSize
+		}
+		if opts.MinPoolSize < 0 {
+			opts.MinPoolSize = 0
+		}
+		if opts.MinPoolSize > opts.MaxPoolSize {
+			opts.MinPoolSize = opts.MaxPoolSize
+		}
+	}
+	baseConn := &BaseConnection{}
+	baseConn.SetPoolOpts(&opts).RegisterMetricsLogger(NewMemoryStoreMetricsLogger(1028))
+	p := &Pool[T]{
+		BaseConnection: baseConn,
+		opts:           opts,
+		hooks:          hooks,
+		tokens:         make(chan struct{}, opts.MaxPoolSize),
+		stopCh:         make(chan struct{}),
+	}
+	for i := 0; i < opts.MinPoolSize; i++ {
+		r, err := p.create(context.Background())
+		if err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+		p.idle = append(p.idle, r)
+	}
+	if opts.IdleTimeout > 0 {
+		go p.evictLoop()
+	}
+	return p, nil
+}
+
+// Pool is a generic pool of resources of type T (e.g. network connections or clients), for sub-packages that do not
+// have a pool of their own.
+//
+// Resources are borrowed with Acquire and must be returned with PoolResource.Release (or PoolResource.Destroy if
+// they are broken).
+//
+// @Available since <<VERSION>>
+type Pool[T any] struct {
+	*BaseConnection
+	opts   BasePoolOpts
+	hooks  PoolHooks[T]
+	tokens chan struct{} // one token per resource in use, bounds the number of resources
+	stopCh chan struct{}
+
+	lock                                    sync.Mutex
+	idle                                    []*PoolResource[T] // most recently used last
+	closed                                  bool
+	created, numClosed, exhausted, timeouts int64
+}
+
+// PoolResource is a resource borrowed from a Pool.
+//
+// @Available since <<VERSION>>
+type PoolResource[T any] struct {
+	pool     *Pool[T]
+	value    T
+	created  time.Time
+	lastUsed time.Time
+	released bool
+}
+
+// Value returns the underlying resource.
+func (r *PoolResource[T]) Value() T {
+	return r.value
+}
+
+// CreatedTime returns the time the resource was created.
+func (r *PoolResource[T]) CreatedTime() time.Time {
+	return r.created
+}
+
+// Release returns the resource to the pool. Calling Release (or Destroy) more than once is a no-op.
+func (r *PoolResource[T]) Release() {
+	r.pool.release(r, false)
+}
+
+// Destroy closes the resource and removes it from the pool, e.g. because it is broken.
+// Calling Destroy (or Release) more than once is a no-op.
+func (r *PoolResource[T]) Destroy() {
+	r.pool.release(r, true)
+}
+
+// Opts returns the effective pooling options.
+func (p *Pool[T]) Opts() BasePoolOpts {
+	return p.opts
+}
+
+// Stats returns a snapshot of the pool's state and counters.
+func (p *Pool[T]) Stats() PoolStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	inUse := len(p.tokens)
+	return PoolStats{
+		Size:      inUse + len(p.idle),
+		Idle:      len(p.idle),
+		InUse:     inUse,
+		Created:   p.created,
+		Closed:    p.numClosed,
+		Exhausted: p.exhausted,
+		Timeouts:  p.timeouts,
+	}
+}
+
+// Acquire borrows a resource from the pool, creating a new one if there is no idle resource and the pool is not
+// full. If the pool is full, Acquire waits until a resource is released, ctx is done or BasePoolOpts.AcquireTimeout
+// (if ctx has no deadline) elapses.
+func (p *Pool[T]) Acquire(ctx context.Context) (*PoolResource[T], error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cmd := p.NewCmdExecInfo()
+	cmd.CmdName = "acquire"
+	exhausted := false
+	defer func() {
+		cmd.CmdResponse = map[string]interface{}{"exhausted": exhausted}
+		_ = p.LogMetrics(MetricsCatAll, cmd)
+		_ = p.LogMetrics(MetricsCatPool, cmd)
+		if exhausted {
+			_ = p.LogMetrics(MetricsCatPoolExhausted, cmd)
+		}
+	}()
+
+	r, err := p.acquire(ctx, &exhausted)
+	cmd.EndWithCostAsExecutionTime(CmdResultOk, CmdResultError, err)
+	return r, err
+}
+
+func (p *Pool[T]) acquire(ctx context.Context, exhausted *bool) (*PoolResource[T], error) {
+	if p.isClosed() {
+		return nil, ErrPoolClosed
+	}
+	select {
+	case p.tokens <- struct{}{}:
+	default:
+		*exhausted = true
+		p.lock.Lock()
+		p.exhausted++
+		p.lock.Unlock()
+		if _, hasDeadline := ctx.Deadline(); !hasDeadline && p.opts.AcquireTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, p.opts.AcquireTimeout)
+			defer cancel()
+		}
+		select {
+		case p.tokens <- struct{}{}:
+		case <-p.stopCh:
+			return nil, ErrPoolClosed
+		case <-ctx.Done():
+			p.lock.Lock()
+			p.timeouts++
+			p.lock.Unlock()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrPoolAcquireTimeout
+			}
+			return nil, ctx.Err()
+		}
+	}
+	// a token is held from here, it must be given back if no resource is handed out
+	for {
+		r, err := p.takeIdle()
+		if err != nil {
+			<-p.tokens
+			return nil, err
+		}
+		if r == nil {
+			break
+		}
+		if p.hooks.Validate == nil {
+			return r, nil
+		}
+		if err := p.hooks.Validate(ctx, r.value); err == nil {
+			return r, nil
+		}
+		p.closeResource(r)
+	}
+	r, err := p.create(ctx)
+	if err != nil {
+		<-p.tokens
+		return nil, err
+	}
+	return r, nil
+}
+
+// takeIdle pops the most recently used idle resource that has not expired, closing expired ones on the way.
+func (p *Pool[T]) takeIdle() (*PoolResource[T], error) {
+	now := time.Now()
+	for {
+		p.lock.Lock()
+		if p.closed {
+			p.lock.Unlock()
+			return nil, ErrPoolClosed
+		}
+		n := len(p.idle)
+		if n == 0 {
+			p.lock.Unlock()
+			return nil, nil
+		}
+		r := p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+		r.released = false
+		p.lock.Unlock()
+		if !p.expired(r, now) {
+			return r, nil
+		}
+		p.closeResource(r)
+	}
+}
+
+func (p *Pool[T]) expired(r *PoolResource[T], now time.Time) bool {
+	return (p.opts.ConnLifetime > 0 && now.Sub(r.created) >= p.opts.ConnLifetime) ||
+		(p.opts.IdleTimeout > 0 && now.Sub(r.lastUsed) >= p.opts.IdleTimeout)
+}
+
+func (p *Pool[T]) create(ctx context.Context) (*PoolResource[T], error) {
+	value, err := p.hooks.Factory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	p.lock.Lock()
+	p.created++
+	p.lock.Unlock()
+	return &PoolResource[T]{pool: p, value: value, created: now, lastUsed: now}, nil
+}
+
+func (p *Pool[T]) closeResource(r *PoolResource[T]) {
+	p.lock.Lock()
+	p.numClosed++
+	p.lock.Unlock()
+	if p.hooks.Close != nil {
+		_ = p.hooks.Close(r.value)
+	}
+}
+
+func (p *Pool[T]) release(r *PoolResource[T], destroy bool) {
+	p.lock.Lock()
+	if r.released {
+		p.lock.Unlock()
+		return
+	}
+	r.released = true
+	r.lastUsed = time.Now()
+	keep := !destroy && !p.closed && !(p.opts.ConnLifetime > 0 && r.lastUsed.Sub(r.created) >= p.opts.ConnLifetime)
+	if keep {
+		p.idle = append(p.idle, r)
+	}
+	p.lock.Unlock()
+	if !keep {
+		p.closeResource(r)
+	}
+	<-p.tokens
+}
+
+func (p *Pool[T]) isClosed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.closed
+}
+
+func (p *Pool[T]) evictLoop() {
+	interval := p.opts.IdleTimeout / 2
+	if interval < minResourcePoolEvictEvery {
+		interval = minResourcePoolEvictEvery
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-ticker.C:
+			p.EvictIdle()
+		}
+	}
+}
+
+// EvictIdle closes idle resources that have expired (see BasePoolOpts.ConnLifetime and BasePoolOpts.IdleTimeout),
+// keeping at least MinPoolSize idle resources. This function is called periodically if IdleTimeout is set.
+func (p *Pool[T]) EvictIdle() {
+	now := time.Now()
+	p.lock.Lock()
+	evicted := make([]*PoolResource[T], 0)
+	kept := p.idle[:0]
+	for i, r := range p.idle {
+		// idle resources are ordered from least to most recently used, the least recently used ones are evicted first
+		if len(p.idle)-i > p.opts.MinPoolSize && p.expired(r, now) {
+			evicted = append(evicted, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	for i := len(kept); i < len(p.idle); i++ {
+		p.idle[i] = nil
+	}
+	p.idle = kept
+	p.lock.Unlock()
+	for _, r := range evicted {
+		p.closeResource(r)
+	}
+}
+
+// Close closes all idle resources and stops the pool. Resources in use are closed when released.
+// Subsequent calls to Acquire return ErrPoolClosed.
+func (p *Pool[T]) Close() error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	close(p.stopCh)
+	p.lock.Unlock()
+	for _, r := range idle {
+		p.closeResource(r)
+	}
+	return nil
+}
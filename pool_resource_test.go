@@ -0,0 +1,222 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testPoolResource struct {
+	id     int64
+	closed int32
+	broken bool
+}
+
+func newTestPoolHooks(counter *int64) PoolHooks[*testPoolResource] {
+	return PoolHooks[*testPoolResource]{
+		Factory: func(context.Context) (*testPoolResource, error) {
+			return &testPoolResource{id: atomic.AddInt64(counter, 1)}, nil
+		},
+		Validate: func(_ context.Context, r *testPoolResource) error {
+			if r.broken {
+				return errors.New("broken")
+			}
+			return nil
+		},
+		Close: func(r *testPoolResource) error {
+			atomic.StoreInt32(&r.closed, 1)
+			return nil
+		},
+	}
+}
+
+func TestNewPool(t *testing.T) {
+	testName := "TestNewPool"
+	if _, err := NewPool[int](nil, PoolHooks[int]{}); err == nil {
+		t.Fatalf("%s failed: expected error when factory is missing", testName)
+	}
+	failing := PoolHooks[int]{Factory: func(context.Context) (int, error) { return 0, errors.New("dummy") }}
+	if _, err := NewPool(nil, failing); err == nil {
+		t.Fatalf("%s failed: expected error when initial resources cannot be created", testName)
+	}
+	var counter int64
+	p, err := NewPool(nil, newTestPoolHooks(&counter))
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer func() { _ = p.Close() }()
+	if opts := p.Opts(); opts.MaxPoolSize != defaultResourcePoolMaxSize || opts.MinPoolSize != 1 {
+		t.Fatalf("%s failed: default options not applied %#v", testName, opts)
+	}
+	if stats := p.Stats(); stats.Size != 1 || stats.Idle != 1 || stats.Created != 1 {
+		t.Fatalf("%s failed: expected initial resource to be created %#v", testName, stats)
+	}
+	if p.MetricsLogger() == nil {
+		t.Fatalf("%s failed: metrics logger not attached", testName)
+	}
+}
+
+func TestPool_AcquireRelease(t *testing.T) {
+	testName := "TestPool_AcquireRelease"
+	var counter int64
+	p, _ := NewPool(&BasePoolOpts{MaxPoolSize: 2, MinPoolSize: 0}, newTestPoolHooks(&counter))
+	defer func() { _ = p.Close() }()
+	r1, err := p.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	r2, _ := p.Acquire(context.Background())
+	if r1.Value().id == r2.Value().id {
+		t.Fatalf("%s failed: expected distinct resources", testName)
+	}
+	if stats := p.Stats(); stats.InUse != 2 || stats.Idle != 0 {
+		t.Fatalf("%s failed: unexpected stats %#v", testName, stats)
+	}
+	r1.Release()
+	r1.Release() // no-op
+	if stats := p.Stats(); stats.InUse != 1 || stats.Idle != 1 {
+		t.Fatalf("%s failed: unexpected stats %#v", testName, stats)
+	}
+	r3, _ := p.Acquire(context.Background())
+	if r3.Value().id != r1.Value().id {
+		t.Fatalf("%s failed: expected idle resource to be reused", testName)
+	}
+
+	// broken resource is destroyed
+	r2.Destroy()
+	if atomic.LoadInt32(&r2.Value().closed) != 1 {
+		t.Fatalf("%s failed: destroyed resource must be closed", testName)
+	}
+	// health check on borrow
+	r3.Value().broken = true
+	r3.Release()
+	r4, _ := p.Acquire(context.Background())
+	if r4.Value().id == r3.Value().id || atomic.LoadInt32(&r3.Value().closed) != 1 {
+		t.Fatalf("%s failed: unhealthy resource must be closed and replaced", testName)
+	}
+	r4.Release()
+	if stats := p.Stats(); stats.Created != 3 || stats.Closed != 2 || stats.Size != 1 {
+		t.Fatalf("%s failed: unexpected stats %#v", testName, stats)
+	}
+	if m, _ := p.Metrics(MetricsCatPool); m.TotalNumCmds != 4 {
+		t.Fatalf("%s failed: expected %#v acquisitions logged but received %#v", testName, 4, m.TotalNumCmds)
+	}
+}
+
+func TestPool_Exhausted(t *testing.T) {
+	testName := "TestPool_Exhausted"
+	var counter int64
+	p, _ := NewPool(&BasePoolOpts{MaxPoolSize: 1, AcquireTimeout: 50 * time.Millisecond}, newTestPoolHooks(&counter))
+	defer func() { _ = p.Close() }()
+	r, _ := p.Acquire(context.Background())
+	if _, err := p.Acquire(context.Background()); !errors.Is(err, ErrPoolAcquireTimeout) {
+		t.Fatalf("%s failed: expected error %s but received %s", testName, ErrPoolAcquireTimeout, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("%s failed: expected error %s but received %s", testName, context.Canceled, err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		r.Release()
+	}()
+	r2, err := p.Acquire(context.Background())
+	if err != nil || r2.Value().id != r.Value().id {
+		t.Fatalf("%s failed: expected released resource but received %#v / %s", testName, r2, err)
+	}
+	r2.Release()
+
+	if stats := p.Stats(); stats.Exhausted != 3 || stats.Timeouts != 2 {
+		t.Fatalf("%s failed: unexpected stats %#v", testName, stats)
+	}
+	m, _ := p.Metrics(MetricsCatPoolExhausted, MetricsOpts{ReturnLatestCommands: 3})
+	if m.TotalNumCmds != 3 || m.LastNCmds[0].Result != CmdResultOk || m.LastNCmds[1].Result != CmdResultError || m.LastNCmds[0].Cost < 5000 {
+		t.Fatalf("%s failed: unexpected metrics %#v", testName, m)
+	}
+}
+
+func TestPool_Lifetime(t *testing.T) {
+	testName := "TestPool_Lifetime"
+	var counter int64
+	p, _ := NewPool(&BasePoolOpts{MaxPoolSize: 2, MinPoolSize: 0, ConnLifetime: 20 * time.Millisecond}, newTestPoolHooks(&counter))
+	defer func() { _ = p.Close() }()
+	r, _ := p.Acquire(context.Background())
+	r.Release()
+	time.Sleep(30 * time.Millisecond)
+	r2, _ := p.Acquire(context.Background())
+	defer r2.Release()
+	if r2.Value().id == r.Value().id || atomic.LoadInt32(&r.Value().closed) != 1 {
+		t.Fatalf("%s failed: expired resource must be closed and replaced", testName)
+	}
+}
+
+func TestPool_IdleTimeout(t *testing.T) {
+	testName := "TestPool_IdleTimeout"
+	var counter int64
+	p, _ := NewPool(&BasePoolOpts{MaxPoolSize: 4, MinPoolSize: 1, IdleTimeout: 50 * time.Millisecond}, newTestPoolHooks(&counter))
+	defer func() { _ = p.Close() }()
+	resources := make([]*PoolResource[*testPoolResource], 0)
+	for i := 0; i < 3; i++ {
+		r, _ := p.Acquire(context.Background())
+		resources = append(resources, r)
+	}
+	for _, r := range resources {
+		r.Release()
+	}
+	if stats := p.Stats(); stats.Idle != 3 {
+		t.Fatalf("%s failed: unexpected stats %#v", testName, stats)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if stats := p.Stats(); stats.Idle != 1 || stats.Closed != 2 {
+		t.Fatalf("%s failed: expected idle resources evicted down to MinPoolSize %#v", testName, stats)
+	}
+}
+
+func TestPool_Close(t *testing.T) {
+	testName := "TestPool_Close"
+	var counter int64
+	p, _ := NewPool(&BasePoolOpts{MaxPoolSize: 1}, newTestPoolHooks(&counter))
+	r, _ := p.Acquire(context.Background())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var waitErr error
+	go func() {
+		defer wg.Done()
+		_, waitErr = p.Acquire(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	wg.Wait()
+	if !errors.Is(waitErr, ErrPoolClosed) {
+		t.Fatalf("%s failed: expected waiting acquisition to fail with %s but received %s", testName, ErrPoolClosed, waitErr)
+	}
+	r.Release()
+	if atomic.LoadInt32(&r.Value().closed) != 1 {
+		t.Fatalf("%s failed: resource released after Close must be closed", testName)
+	}
+	if _, err := p.Acquire(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("%s failed: expected error %s but received %s", testName, ErrPoolClosed, err)
+	}
+}
+
+func BenchmarkPool_AcquireRelease(b *testing.B) {
+	var counter int64
+	p, _ := NewPool(&BasePoolOpts{MaxPoolSize: 16}, newTestPoolHooks(&counter))
+	defer func() { _ = p.Close() }()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r, err := p.Acquire(context.Background())
+			if err == nil {
+				r.Release()
+			}
+		}
+	})
+}
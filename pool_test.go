@@ -1,6 +1,9 @@
 package prom
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestBaseConnection_GetSetPoolOpts(t *testing.T) {
 	testName := "TestBaseConnection_GetSetPoolOpts"
@@ -63,3 +66,30 @@ func TestBaseConnection_Metrics(t *testing.T) {
 		t.Fatalf("%s failed: expected %#v metrics returned, but received %#v", testName+"/Metrics", 1, len(metrics.LastNCmds))
 	}
 }
+
+func TestBaseConnection_RegisterSlowCmdHandler(t *testing.T) {
+	testName := "TestBaseConnection_RegisterSlowCmdHandler"
+	conn := &BaseConnection{}
+	var slowCmds []string
+	handler := func(category string, cmd *CmdExecInfo) {
+		slowCmds = append(slowCmds, category+":"+cmd.Id)
+	}
+	conn.RegisterSlowCmdHandler(MetricsCatAll, 100, handler).RegisterSlowCmdHandler(MetricsCatDQL, 500, handler)
+	conn.RegisterSlowCmdHandler(MetricsCatDQL, 0, nil)
+	for i, cost := range []float64{50, 200, 1000} {
+		cmd := &CmdExecInfo{Id: string(rune('a' + i)), Cost: cost}
+		_ = conn.LogMetrics(MetricsCatAll, cmd)
+		_ = conn.LogMetrics(MetricsCatDQL, cmd)
+	}
+	if v, e := strings.Join(slowCmds, ","), "all:b,all:c,dql:c"; v != e {
+		t.Fatalf("%s failed: expected slow commands %#v but received %#v", testName, e, v)
+	}
+
+	slowCmds = nil
+	conn.UnregisterSlowCmdHandlers(MetricsCatAll).UnregisterSlowCmdHandlers("unknown")
+	_ = conn.LogMetrics(MetricsCatAll, &CmdExecInfo{Id: "d", Cost: 1000})
+	_ = conn.LogMetrics(MetricsCatDQL, &CmdExecInfo{Id: "e", Cost: 1000})
+	if v, e := strings.Join(slowCmds, ","), "dql:e"; v != e {
+		t.Fatalf("%s failed: expected slow commands %#v but received %#v", testName, e, v)
+	}
+}
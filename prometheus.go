@@ -0,0 +1,254 @@
+package prom
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PrometheusContentType is the content type of the Prometheus text exposition format.
+//
+// @Available since <<VERSION>>
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultPrometheusNamespace is the default prefix of metric names generated by PrometheusExporter.
+//
+// @Available since <<VERSION>>
+const DefaultPrometheusNamespace = "prom"
+
+var commonMetricsCategories = []string{MetricsCatAll, MetricsCatDDL, MetricsCatDML, MetricsCatDQL, MetricsCatDCL, MetricsCatTCL, MetricsCatOther}
+
+var prometheusQuantiles = []struct {
+	label string
+	value func(m *Metrics) float64
+}{
+	{"0.5", func(m *Metrics) float64 { return m.P50Cost }},
+	{"0.75", func(m *Metrics) float64 { return m.P75Cost }},
+	{"0.9", func(m *Metrics) float64 { return m.P90Cost }},
+	{"0.95", func(m *Metrics) float64 { return m.P95Cost }},
+	{"0.99", func(m *Metrics) float64 { return m.P99Cost }},
+}
+
+// NewPrometheusExporter creates a new PrometheusExporter instance.
+//   - namespace: prefix of generated metric names. If empty, DefaultPrometheusNamespace is used.
+//
+// @Available since <<VERSION>>
+func NewPrometheusExporter(namespace string) *PrometheusExporter {
+	namespace = reInvalidPrometheusNameChars.ReplaceAllString(strings.TrimSpace(namespace), "_")
+	if namespace == "" {
+		namespace = DefaultPrometheusNamespace
+	}
+	return &PrometheusExporter{namespace: namespace}
+}
+
+// PrometheusExporter walks metrics categories of registered IMetricsLogger instances and encodes their metrics in
+// the Prometheus text exposition format.
+//
+// For each (connection, category) pair, the following metrics are generated:
+//   - <namespace>_cmd_total (counter): total number of executed commands (Metrics.TotalNumCmds).
+//   - <namespace>_cmd_cost (summary): p50/p75/p90/p95/p99 quantiles of command execution cost, with
+//     <namespace>_cmd_cost_sum (Metrics.TotalCost) and <namespace>_cmd_cost_count (Metrics.TotalNumCmds).
+//   - <namespace>_cmd_cost_min, <namespace>_cmd_cost_max and <namespace>_cmd_cost_mean (gauge): min/max/mean of command execution cost.
+//   - <namespace>_cmd_reservoir (gauge): number of latest commands used to calculate the cost statistics (Metrics.ReservoirNumCmds).
+//
+// All metrics are labelled with "conn" (the name the logger was registered with) and "category". If the same
+// (connection, category) pair is registered more than once, only the first one is exported.
+//
+// PrometheusExporter implements http.Handler so that it can be mounted directly as the scrape endpoint.
+//
+// @Available since <<VERSION>>
+type PrometheusExporter struct {
+	metricsSources
+	namespace string
+}
+
+// Namespace returns the prefix of generated metric names.
+func (e *PrometheusExporter) Namespace() string {
+	return e.namespace
+}
+
+// AddLogger registers a metrics logger with the exporter.
+//   - name: value of the "conn" label.
+//   - categories: metrics categories to export. If empty, categories are discovered via IMetricsCategoryLister if the
+//     logger implements it, otherwise the common categories (MetricsCatAll, MetricsCatDDL, etc.) are exported.
+//
+// This function returns the exporter itself for chaining.
+func (e *PrometheusExporter) AddLogger(name string, logger IMetricsLogger, categories ...string) *PrometheusExporter {
+	e.addSource(name, func() IMetricsLogger { return logger }, categories)
+	return e
+}
+
+// AddConnection is similar to AddLogger, but the metrics logger is obtained from the connection at every scrape.
+//
+// This function returns the exporter itself for chaining.
+func (e *PrometheusExporter) AddConnection(name string, conn IBaseConnection, categories ...string) *PrometheusExporter {
+	e.addSource(name, conn.MetricsLogger, categories)
+	return e
+}
+
+// metricsSource is a metrics logger registered with PrometheusExporter or DashboardHandler.
+type metricsSource struct {
+	name       string
+	logger     func() IMetricsLogger
+	categories []string
+}
+
+// metricsSources is the registry of metrics loggers shared by PrometheusExporter and DashboardHandler.
+type metricsSources struct {
+	lock    sync.RWMutex
+	sources []*metricsSource
+}
+
+func (r *metricsSources) addSource(name string, logger func() IMetricsLogger, categories []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.sources = append(r.sources, &metricsSource{name: name, logger: logger, categories: categories})
+}
+
+func (r *metricsSources) getSources() []*metricsSource {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	result := make([]*metricsSource, len(r.sources))
+	copy(result, r.sources)
+	return result
+}
+
+// metricsCategories returns the categories to walk for a logger: the specified ones if any, otherwise categories
+// discovered via IMetricsCategoryLister if the logger implements it, otherwise the common categories.
+func metricsCategories(logger IMetricsLogger, categories []string) []string {
+	if len(categories) > 0 {
+		return categories
+	}
+	if lister, ok := logger.(IMetricsCategoryLister); ok {
+		return lister.Categories()
+	}
+	return commonMetricsCategories
+}
+
+type prometheusSample struct {
+	conn    string
+	metrics *Metrics
+}
+
+func (e *PrometheusExporter) collect() ([]prometheusSample, error) {
+	samples := make([]prometheusSample, 0)
+	seen := make(map[[2]string]bool)
+	for _, src := range e.getSources() {
+		logger := src.logger()
+		if logger == nil {
+			continue
+		}
+		for _, category := range metricsCategories(logger, src.categories) {
+			// a series must not be exported twice
+			key := [2]string{src.name, category}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			m, err := logger.Metrics(category)
+			if err != nil {
+				return nil, err
+			}
+			if m != nil {
+				samples = append(samples, prometheusSample{conn: src.name, metrics: m})
+			}
+		}
+	}
+	return samples, nil
+}
+
+// Encode writes metrics of all registered loggers to w in the Prometheus text exposition format.
+func (e *PrometheusExporter) Encode(w io.Writer) error {
+	samples, err := e.collect()
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	e.writeFamily(buf, "cmd_total", "counter", "Total number of executed commands.", samples, func(m *Metrics) float64 { return float64(m.TotalNumCmds) })
+	e.writeSummary(buf, "cmd_cost", "Command execution cost.", samples)
+	e.writeFamily(buf, "cmd_cost_min", "gauge", "Minimum command execution cost.", samples, func(m *Metrics) float64 { return m.MinCost })
+	e.writeFamily(buf, "cmd_cost_max", "gauge", "Maximum command execution cost.", samples, func(m *Metrics) float64 { return m.MaxCost })
+	e.writeFamily(buf, "cmd_cost_mean", "gauge", "Mean command execution cost.", samples, func(m *Metrics) float64 { return m.MeanCost })
+	e.writeFamily(buf, "cmd_reservoir", "gauge", "Number of latest commands used to calculate cost statistics.", samples, func(m *Metrics) float64 { return float64(m.ReservoirNumCmds) })
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// ServeHTTP implements http.Handler.
+func (e *PrometheusExporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	buf := &bytes.Buffer{}
+	if err := e.Encode(buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", PrometheusContentType)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (e *PrometheusExporter) writeHeader(buf *bytes.Buffer, name, metricType, help string) {
+	buf.WriteString("# HELP " + name + " " + help + "\n")
+	buf.WriteString("# TYPE " + name + " " + metricType + "\n")
+}
+
+func (e *PrometheusExporter) writeFamily(buf *bytes.Buffer, name, metricType, help string, samples []prometheusSample, value func(m *Metrics) float64) {
+	if len(samples) == 0 {
+		return
+	}
+	name = e.namespace + "_" + name
+	e.writeHeader(buf, name, metricType, help)
+	for _, s := range samples {
+		writePrometheusSample(buf, name, s.conn, s.metrics.Category, "", value(s.metrics))
+	}
+}
+
+func (e *PrometheusExporter) writeSummary(buf *bytes.Buffer, name, help string, samples []prometheusSample) {
+	if len(samples) == 0 {
+		return
+	}
+	name = e.namespace + "_" + name
+	e.writeHeader(buf, name, "summary", help)
+	for _, s := range samples {
+		for _, q := range prometheusQuantiles {
+			writePrometheusSample(buf, name, s.conn, s.metrics.Category, q.label, q.value(s.metrics))
+		}
+		writePrometheusSample(buf, name+"_sum", s.conn, s.metrics.Category, "", s.metrics.TotalCost)
+		writePrometheusSample(buf, name+"_count", s.conn, s.metrics.Category, "", float64(s.metrics.TotalNumCmds))
+	}
+}
+
+func writePrometheusSample(buf *bytes.Buffer, name, conn, category, quantile string, value float64) {
+	buf.WriteString(name)
+	buf.WriteString(`{conn="` + escapePrometheusLabelValue(conn) + `",category="` + escapePrometheusLabelValue(category) + `"`)
+	if quantile != "" {
+		buf.WriteString(`,quantile="` + quantile + `"`)
+	}
+	buf.WriteString("} ")
+	buf.WriteString(formatPrometheusValue(value))
+	buf.WriteByte('\n')
+}
+
+var reInvalidPrometheusNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+var prometheusLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapePrometheusLabelValue(v string) string {
+	return prometheusLabelValueReplacer.Replace(v)
+}
+
+func formatPrometheusValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,137 @@
+package prom
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewPrometheusExporter(t *testing.T) {
+	testName := "TestNewPrometheusExporter"
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"", DefaultPrometheusNamespace},
+		{"  ", DefaultPrometheusNamespace},
+		{"myapp", "myapp"},
+		{"my-app.db", "my_app_db"},
+	}
+	for _, tc := range testCases {
+		e := NewPrometheusExporter(tc.input)
+		if e == nil {
+			t.Fatalf("%s failed: nil", testName)
+		}
+		if e.Namespace() != tc.expected {
+			t.Fatalf("%s failed: expected namespace %#v but received %#v", testName, tc.expected, e.Namespace())
+		}
+	}
+}
+
+func TestPrometheusExporter_Encode(t *testing.T) {
+	testName := "TestPrometheusExporter_Encode"
+	logger := NewMemoryStoreMetricsLogger(100)
+	for i := 1; i <= 10; i++ {
+		_ = logger.Put(MetricsCatAll, &CmdExecInfo{Id: NewId(), Cost: float64(i)})
+		if i%2 == 0 {
+			_ = logger.Put(MetricsCatDQL, &CmdExecInfo{Id: NewId(), Cost: float64(i)})
+		}
+	}
+	e := NewPrometheusExporter("").AddLogger("mydb", logger)
+	buf := &bytes.Buffer{}
+	if err := e.Encode(buf); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	output := buf.String()
+	expectedLines := []string{
+		"# TYPE prom_cmd_total counter",
+		`prom_cmd_total{conn="mydb",category="all"} 10`,
+		`prom_cmd_total{conn="mydb",category="dql"} 5`,
+		"# TYPE prom_cmd_cost summary",
+		`prom_cmd_cost{conn="mydb",category="all",quantile="0.5"} 5.5`,
+		`prom_cmd_cost{conn="mydb",category="all",quantile="0.99"} 10`,
+		`prom_cmd_cost_sum{conn="mydb",category="all"} 55`,
+		`prom_cmd_cost_count{conn="mydb",category="all"} 10`,
+		`prom_cmd_cost_sum{conn="mydb",category="dql"} 30`,
+		`prom_cmd_cost_count{conn="mydb",category="dql"} 5`,
+		"# TYPE prom_cmd_cost_min gauge",
+		`prom_cmd_cost_min{conn="mydb",category="all"} 1`,
+		`prom_cmd_cost_max{conn="mydb",category="dql"} 10`,
+		`prom_cmd_cost_mean{conn="mydb",category="dql"} 6`,
+		`prom_cmd_reservoir{conn="mydb",category="all"} 10`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(output, line+"\n") {
+			t.Fatalf("%s failed: expected line %#v in output\n%s", testName, line, output)
+		}
+	}
+	if strings.Contains(output, `category="ddl"`) {
+		t.Fatalf("%s failed: unexpected category [ddl] in output\n%s", testName, output)
+	}
+}
+
+func TestPrometheusExporter_Encode_Duplicates(t *testing.T) {
+	testName := "TestPrometheusExporter_Encode_Duplicates"
+	logger1, logger2 := NewMemoryStoreMetricsLogger(100), NewMemoryStoreMetricsLogger(100)
+	_ = logger1.Put(MetricsCatAll, &CmdExecInfo{Id: NewId(), Cost: 1})
+	_ = logger2.Put(MetricsCatAll, &CmdExecInfo{Id: NewId(), Cost: 2})
+	e := NewPrometheusExporter("").
+		AddLogger("mydb", logger1, MetricsCatAll, MetricsCatAll).
+		AddLogger("mydb", logger2, MetricsCatAll).
+		AddLogger("other", logger2, MetricsCatAll)
+	buf := &bytes.Buffer{}
+	if err := e.Encode(buf); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	output := buf.String()
+	if n := strings.Count(output, `prom_cmd_total{conn="mydb",category="all"}`); n != 1 {
+		t.Fatalf("%s failed: expected series to be exported once but received %d times\n%s", testName, n, output)
+	}
+	for _, line := range []string{`prom_cmd_cost_sum{conn="mydb",category="all"} 1`, `prom_cmd_cost_sum{conn="other",category="all"} 2`} {
+		if !strings.Contains(output, line+"\n") {
+			t.Fatalf("%s failed: expected line %#v in output\n%s", testName, line, output)
+		}
+	}
+}
+
+type testNonListingMetricsLogger struct {
+	IMetricsLogger
+}
+
+func TestPrometheusExporter_Encode_DefaultCategories(t *testing.T) {
+	testName := "TestPrometheusExporter_Encode_DefaultCategories"
+	conn := &BaseConnection{}
+	conn.RegisterMetricsLogger(&testNonListingMetricsLogger{NewMemoryStoreMetricsLogger(100)})
+	e := NewPrometheusExporter("test").AddConnection("conn\"1\"", conn)
+	buf := &bytes.Buffer{}
+	if err := e.Encode(buf); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	for _, cat := range commonMetricsCategories {
+		line := `test_cmd_total{conn="conn\"1\"",category="` + cat + `"} 0`
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Fatalf("%s failed: expected line %#v in output\n%s", testName, line, buf.String())
+		}
+	}
+}
+
+func TestPrometheusExporter_ServeHTTP(t *testing.T) {
+	testName := "TestPrometheusExporter_ServeHTTP"
+	logger := NewMemoryStoreMetricsLogger(100)
+	_ = logger.Put(MetricsCatAll, &CmdExecInfo{Id: NewId(), Cost: 12.34})
+	e := NewPrometheusExporter("").AddLogger("mydb", logger, MetricsCatAll)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s failed: expected status %#v but received %#v", testName, http.StatusOK, rec.Code)
+	}
+	if v := rec.Header().Get("Content-Type"); v != PrometheusContentType {
+		t.Fatalf("%s failed: expected content type %#v but received %#v", testName, PrometheusContentType, v)
+	}
+	if !strings.Contains(rec.Body.String(), `prom_cmd_cost_max{conn="mydb",category="all"} 12`) {
+		t.Fatalf("%s failed: unexpected output\n%s", testName, rec.Body.String())
+	}
+}
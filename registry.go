@@ -0,0 +1,308 @@
+package prom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// ConnectionFactory builds a connection from its configuration.
+//   - name: name the connection is registered with.
+//   - poolOpts: pooling options of the connection, nil if not configured.
+//   - config: connection type specific configuration (the "config" field of RegistryConnectionConfig), nil if not
+//     configured.
+//
+// @Available since <<VERSION>>
+type ConnectionFactory func(name string, poolOpts *BasePoolOpts, config json.RawMessage) (IBaseConnection, error)
+
+var (
+	connFactoriesLock sync.RWMutex
+	connFactories     = make(map[string]ConnectionFactory)
+)
+
+// RegisterConnectionFactory registers a factory to build connections of a type from configuration (see
+// Registry.LoadConfig). Sub-packages register factories for their connection types upon initialization, e.g. package
+// github.com/btnguyen2k/prom/sql registers factory for type "sql".
+//
+// Registering a factory for an existing type replaces the old one. Registering a nil factory removes the type.
+//
+// @Available since <<VERSION>>
+func RegisterConnectionFactory(connType string, factory ConnectionFactory) {
+	connFactoriesLock.Lock()
+	defer connFactoriesLock.Unlock()
+	if factory == nil {
+		delete(connFactories, connType)
+	} else {
+		connFactories[connType] = factory
+	}
+}
+
+// ConnectionTypes returns the connection types that have a registered factory, sorted in ascending order.
+//
+// @Available since <<VERSION>>
+func ConnectionTypes() []string {
+	connFactoriesLock.RLock()
+	defer connFactoriesLock.RUnlock()
+	result := make([]string, 0, len(connFactories))
+	for connType := range connFactories {
+		result = append(result, connType)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func getConnectionFactory(connType string) ConnectionFactory {
+	connFactoriesLock.RLock()
+	defer connFactoriesLock.RUnlock()
+	return connFactories[connType]
+}
+
+// RegistryConfig is the configuration of connections to build and register with a Registry.
+//
+// Sample JSON configuration:
+//
+//	{
+//	  "connections": [
+//	    {
+//	      "name": "main",
+//	      "type": "sql",
+//	      "pool": {"max_size": 8, "min_size": 2, "conn_lifetime": 3600000000000},
+//	      "config": {"driver": "pgx", "dsn": "postgres://...", "flavor": "postgresql"}
+//	    }
+//	  ]
+//	}
+//
+// @Available since <<VERSION>>
+type RegistryConfig struct {
+	Connections []RegistryConnectionConfig `json:"connections"`
+}
+
+// RegistryConnectionConfig is the configuration of a connection.
+//
+// @Available since <<VERSION>>
+type RegistryConnectionConfig struct {
+	// Name to register the connection with.
+	Name string `json:"name"`
+
+	// Type of the connection, which decides the ConnectionFactory used to build the connection.
+	Type string `json:"type"`
+
+	// Pooling options (see BasePoolOpts for the field names). Durations are in nanoseconds.
+	Pool *BasePoolOpts `json:"pool,omitempty"`
+
+	// Connection type specific configuration, passed as-is to the ConnectionFactory.
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// NewRegistry creates a new empty Registry instance.
+//
+// @Available since <<VERSION>>
+func NewRegistry() *Registry {
+	return &Registry{conns: make(map[string]IBaseConnection)}
+}
+
+// Registry holds connections shared within an application, registered by name. Connections are closed in reverse
+// order of registration when the registry is closed.
+//
+// @Available since <<VERSION>>
+type Registry struct {
+	lock  sync.RWMutex
+	names []string
+	conns map[string]IBaseConnection
+}
+
+// Register registers a connection with a name. This function returns error if the name is empty or has been taken.
+func (r *Registry) Register(name string, conn IBaseConnection) error {
+	if name == "" || conn == nil {
+		return errors.New("connection must have a name")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.conns[name]; ok {
+		return fmt.Errorf("connection <%s> has been registered", name)
+	}
+	r.names = append(r.names, name)
+	r.conns[name] = conn
+	return nil
+}
+
+// Unregister removes a connection from the registry (without closing it) and returns it, nil if not found.
+func (r *Registry) Unregister(name string) IBaseConnection {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	conn, ok := r.conns[name]
+	if !ok {
+		return nil
+	}
+	delete(r.conns, name)
+	for i, n := range r.names {
+		if n == name {
+			r.names = append(r.names[:i], r.names[i+1:]...)
+			break
+		}
+	}
+	return conn
+}
+
+// Get returns the connection registered with the name, nil if not found.
+func (r *Registry) Get(name string) IBaseConnection {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.conns[name]
+}
+
+// RegistryGet returns the connection registered with the name as type T.
+// This function returns false if the connection is not found or is not of type T.
+//
+// @Available since <<VERSION>>
+func RegistryGet[T IBaseConnection](r *Registry, name string) (T, bool) {
+	result, ok := r.Get(name).(T)
+	return result, ok
+}
+
+// Names returns the names of registered connections, in order of registration.
+func (r *Registry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	result := make([]string, len(r.names))
+	copy(result, r.names)
+	return result
+}
+
+// LoadConfig builds connections from configuration (see RegistryConfig) and registers them, in order of
+// appearance.
+//   - data: the configuration.
+//   - unmarshal: function to decode the configuration, e.g. json.Unmarshal (used if nil) or yaml.Unmarshal of a YAML
+//     library. The configuration is decoded to a generic value first, then normalized and re-encoded as JSON, so that
+//     the json tags of RegistryConfig and BasePoolOpts apply regardless of the format.
+//
+// If a connection cannot be built or registered, connections built so far by this call are unregistered and closed
+// (in reverse order) and the error is returned.
+func (r *Registry) LoadConfig(data []byte, unmarshal func(data []byte, v interface{}) error) error {
+	conf, err := parseRegistryConfig(data, unmarshal)
+	if err != nil {
+		return err
+	}
+	built := make([]string, 0, len(conf.Connections))
+	rollback := func(err error) error {
+		for i := len(built) - 1; i >= 0; i-- {
+			_ = closeConnection(r.Unregister(built[i]))
+		}
+		return err
+	}
+	for _, c := range conf.Connections {
+		factory := getConnectionFactory(c.Type)
+		if factory == nil {
+			return rollback(fmt.Errorf("no factory registered for connection type <%s> of connection <%s>", c.Type, c.Name))
+		}
+		if r.Get(c.Name) != nil {
+			return rollback(fmt.Errorf("connection <%s> has been registered", c.Name))
+		}
+		conn, err := factory(c.Name, c.Pool, c.Config)
+		if err != nil {
+			return rollback(fmt.Errorf("cannot build connection <%s>: %w", c.Name, err))
+		}
+		if err := r.Register(c.Name, conn); err != nil {
+			_ = closeConnection(conn)
+			return rollback(err)
+		}
+		built = append(built, c.Name)
+	}
+	return nil
+}
+
+func parseRegistryConfig(data []byte, unmarshal func(data []byte, v interface{}) error) (*RegistryConfig, error) {
+	conf := &RegistryConfig{}
+	if unmarshal == nil {
+		return conf, json.Unmarshal(data, conf)
+	}
+	var generic interface{}
+	if err := unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	js, err := json.Marshal(normalizeConfigValue(generic))
+	if err != nil {
+		return nil, err
+	}
+	return conf, json.Unmarshal(js, conf)
+}
+
+// normalizeConfigValue converts maps with non-string keys (e.g. produced by some YAML libraries) to
+// map[string]interface{} so that the value can be encoded as JSON.
+func normalizeConfigValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			result[fmt.Sprint(k)] = normalizeConfigValue(val)
+		}
+		return result
+	case map[string]interface{}:
+		for k, val := range t {
+			t[k] = normalizeConfigValue(val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = normalizeConfigValue(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// Metrics returns metrics of all registered connections, keyed by connection name.
+//   - categories: metrics categories to return. If empty, categories are discovered via IMetricsCategoryLister if the
+//     connection's metrics logger implements it, otherwise the common categories (MetricsCatAll, MetricsCatDDL, etc.)
+//     are returned.
+//
+// Connections without metrics logger are omitted.
+func (r *Registry) Metrics(categories ...string) (map[string][]*Metrics, error) {
+	result := make(map[string][]*Metrics)
+	for _, name := range r.Names() {
+		conn := r.Get(name)
+		if conn == nil || conn.MetricsLogger() == nil {
+			continue
+		}
+		logger := conn.MetricsLogger()
+		list := make([]*Metrics, 0)
+		for _, category := range metricsCategories(logger, categories) {
+			m, err := logger.Metrics(category)
+			if err != nil {
+				return nil, fmt.Errorf("cannot get metrics of connection <%s>: %w", name, err)
+			}
+			if m != nil {
+				list = append(list, m)
+			}
+		}
+		result[name] = list
+	}
+	return result, nil
+}
+
+// Close unregisters and closes all connections (those implementing io.Closer) in reverse order of registration,
+// returning the first error encountered.
+func (r *Registry) Close() error {
+	r.lock.Lock()
+	names, conns := r.names, r.conns
+	r.names, r.conns = nil, make(map[string]IBaseConnection)
+	r.lock.Unlock()
+	var result error
+	for i := len(names) - 1; i >= 0; i-- {
+		if err := closeConnection(conns[names[i]]); err != nil && result == nil {
+			result = fmt.Errorf("cannot close connection <%s>: %w", names[i], err)
+		}
+	}
+	return result
+}
+
+func closeConnection(conn IBaseConnection) error {
+	if closer, ok := conn.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
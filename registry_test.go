@@ -0,0 +1,224 @@
+package prom
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRegistryConn struct {
+	*BaseConnection
+	name   string
+	closed *[]string
+	err    error
+}
+
+func (c *testRegistryConn) Close() error {
+	*c.closed = append(*c.closed, c.name)
+	return c.err
+}
+
+func newTestRegistryConn(name string, closed *[]string) *testRegistryConn {
+	conn := &testRegistryConn{BaseConnection: &BaseConnection{}, name: name, closed: closed}
+	conn.RegisterMetricsLogger(NewMemoryStoreMetricsLogger(10))
+	return conn
+}
+
+func TestRegistry_RegisterGet(t *testing.T) {
+	testName := "TestRegistry_RegisterGet"
+	closed := make([]string, 0)
+	r := NewRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := r.Register(name, newTestRegistryConn(name, &closed)); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+	}
+	if err := r.Register("b", newTestRegistryConn("b", &closed)); err == nil {
+		t.Fatalf("%s failed: expected error registering duplicated name", testName)
+	}
+	if err := r.Register("", newTestRegistryConn("", &closed)); err == nil {
+		t.Fatalf("%s failed: expected error registering empty name", testName)
+	}
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Fatalf("%s failed: expected names %#v but received %#v", testName, []string{"a", "b", "c"}, names)
+	}
+	if conn, ok := RegistryGet[*testRegistryConn](r, "b"); !ok || conn.name != "b" {
+		t.Fatalf("%s failed: cannot get connection <b>", testName)
+	}
+	if _, ok := RegistryGet[*BaseConnection](r, "b"); ok {
+		t.Fatalf("%s failed: expected type mismatch", testName)
+	}
+	if r.Get("x") != nil {
+		t.Fatalf("%s failed: expected nil for unknown name", testName)
+	}
+	if conn := r.Unregister("b"); conn == nil || r.Get("b") != nil {
+		t.Fatalf("%s failed: cannot unregister connection <b>", testName)
+	}
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"a", "c"}) {
+		t.Fatalf("%s failed: expected names %#v but received %#v", testName, []string{"a", "c"}, names)
+	}
+	if len(closed) != 0 {
+		t.Fatalf("%s failed: expected no connection closed but received %#v", testName, closed)
+	}
+}
+
+func TestRegistry_Close(t *testing.T) {
+	testName := "TestRegistry_Close"
+	closed := make([]string, 0)
+	r := NewRegistry()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		conn := newTestRegistryConn(name, &closed)
+		if name == "b" || name == "c" {
+			conn.err = errors.New("error closing " + name)
+		}
+		_ = r.Register(name, conn)
+	}
+	_ = r.Register("base", &BaseConnection{})
+	err := r.Close()
+	if err == nil || !strings.Contains(err.Error(), "error closing c") {
+		t.Fatalf("%s failed: expected first error from <c> but received %v", testName, err)
+	}
+	if expected := []string{"d", "c", "b", "a"}; !reflect.DeepEqual(closed, expected) {
+		t.Fatalf("%s failed: expected closing order %#v but received %#v", testName, expected, closed)
+	}
+	if len(r.Names()) != 0 {
+		t.Fatalf("%s failed: expected empty registry after closing", testName)
+	}
+}
+
+func TestRegistry_Metrics(t *testing.T) {
+	testName := "TestRegistry_Metrics"
+	closed := make([]string, 0)
+	r := NewRegistry()
+	a, b := newTestRegistryConn("a", &closed), newTestRegistryConn("b", &closed)
+	_ = r.Register("a", a)
+	_ = r.Register("b", b)
+	_ = r.Register("none", &BaseConnection{})
+	for i := 0; i < 3; i++ {
+		cmd := a.NewCmdExecInfo()
+		cmd.EndWithCost(1, CmdResultOk, CmdResultError, nil)
+		a.LogMetrics(MetricsCatAll, cmd)
+		a.LogMetrics(MetricsCatDML, cmd)
+	}
+	cmd := b.NewCmdExecInfo()
+	cmd.EndWithCost(1, CmdResultOk, CmdResultError, nil)
+	b.LogMetrics(MetricsCatDDL, cmd)
+
+	metrics, err := r.Metrics()
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if len(metrics) != 2 || len(metrics["a"]) != 2 || len(metrics["b"]) != 1 {
+		t.Fatalf("%s failed: unexpected metrics %#v", testName, metrics)
+	}
+	for _, m := range metrics["a"] {
+		if m.TotalNumCmds != 3 {
+			t.Fatalf("%s failed: expected 3 commands in category <%s> but received %d", testName, m.Category, m.TotalNumCmds)
+		}
+	}
+	metrics, _ = r.Metrics(MetricsCatDDL)
+	if len(metrics["a"]) != 1 || metrics["a"][0].TotalNumCmds != 0 || metrics["b"][0].TotalNumCmds != 1 {
+		t.Fatalf("%s failed: unexpected metrics %#v", testName, metrics)
+	}
+}
+
+// testYamlUnmarshal mimics YAML libraries that decode mappings to map[interface{}]interface{}.
+func testYamlUnmarshal(data []byte, v interface{}) error {
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	var convert func(v interface{}) interface{}
+	convert = func(v interface{}) interface{} {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			result := make(map[interface{}]interface{}, len(t))
+			for k, val := range t {
+				result[k] = convert(val)
+			}
+			return result
+		case []interface{}:
+			for i, val := range t {
+				t[i] = convert(val)
+			}
+		}
+		return v
+	}
+	*(v.(*interface{})) = convert(generic)
+	return nil
+}
+
+func TestRegistry_LoadConfig(t *testing.T) {
+	testName := "TestRegistry_LoadConfig"
+	closed := make([]string, 0)
+	RegisterConnectionFactory("test", func(name string, poolOpts *BasePoolOpts, config json.RawMessage) (IBaseConnection, error) {
+		conf := map[string]interface{}{}
+		_ = json.Unmarshal(config, &conf)
+		if conf["fail"] == true {
+			return nil, errors.New("failed to build")
+		}
+		conn := newTestRegistryConn(name, &closed)
+		if poolOpts != nil {
+			conn.SetPoolOpts(poolOpts)
+		}
+		return conn, nil
+	})
+	defer RegisterConnectionFactory("test", nil)
+	if types := ConnectionTypes(); !reflect.DeepEqual(types, []string{"test"}) {
+		t.Fatalf("%s failed: expected types %#v but received %#v", testName, []string{"test"}, types)
+	}
+
+	config := `{"connections": [
+		{"name": "a", "type": "test", "pool": {"max_size": 4, "min_size": 2, "idle_timeout": 60000000000}},
+		{"name": "b", "type": "test", "config": {"key": "value"}}
+	]}`
+	for _, unmarshal := range []func([]byte, interface{}) error{nil, json.Unmarshal, testYamlUnmarshal} {
+		r := NewRegistry()
+		if err := r.LoadConfig([]byte(config), unmarshal); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+		if names := r.Names(); !reflect.DeepEqual(names, []string{"a", "b"}) {
+			t.Fatalf("%s failed: expected names %#v but received %#v", testName, []string{"a", "b"}, names)
+		}
+		poolOpts := r.Get("a").PoolOpts().(*BasePoolOpts)
+		if poolOpts.MaxPoolSize != 4 || poolOpts.MinPoolSize != 2 || poolOpts.IdleTimeout != time.Minute {
+			t.Fatalf("%s failed: unexpected pool options %#v", testName, poolOpts)
+		}
+		if r.Get("b").PoolOpts() != nil {
+			t.Fatalf("%s failed: expected no pool options for <b>", testName)
+		}
+		_ = r.Close()
+	}
+
+	closed = closed[:0]
+	r := NewRegistry()
+	_ = r.Register("existing", newTestRegistryConn("existing", &closed))
+	config = `{"connections": [
+		{"name": "a", "type": "test"},
+		{"name": "b", "type": "test"},
+		{"name": "c", "type": "test", "config": {"fail": true}}
+	]}`
+	if err := r.LoadConfig([]byte(config), nil); err == nil || !strings.Contains(err.Error(), "failed to build") {
+		t.Fatalf("%s failed: expected build error but received %v", testName, err)
+	}
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"existing"}) {
+		t.Fatalf("%s failed: expected names %#v but received %#v", testName, []string{"existing"}, names)
+	}
+	if expected := []string{"b", "a"}; !reflect.DeepEqual(closed, expected) {
+		t.Fatalf("%s failed: expected closing order %#v but received %#v", testName, expected, closed)
+	}
+
+	for _, config := range []string{
+		`{"connections": [{"name": "x", "type": "unknown"}]}`,
+		`{"connections": [{"name": "existing", "type": "test"}]}`,
+		`{"connections": [{"name": "", "type": "test"}]}`,
+		`not json`,
+	} {
+		if err := r.LoadConfig([]byte(config), nil); err == nil {
+			t.Fatalf("%s failed: expected error loading %s", testName, config)
+		}
+	}
+}
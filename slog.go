@@ -0,0 +1,247 @@
+//go:build go1.21
+
+package prom
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"sort"
+)
+
+// NewSlogSlowCmdHandler creates a SlowCmdHandler that writes slow commands to a log/slog logger.
+//   - logger: the logger to write to. If nil, slog.Default() is used.
+//   - level : level of the log records.
+//
+// Each log record carries attributes of the command, see CmdExecInfoSlogAttrs.
+//
+// @Available since <<VERSION>>
+func NewSlogSlowCmdHandler(logger *slog.Logger, level slog.Level) SlowCmdHandler {
+	return func(category string, cmd *CmdExecInfo) {
+		l := logger
+		if l == nil {
+			l = slog.Default()
+		}
+		attrs := append([]slog.Attr{slog.String("category", category)}, CmdExecInfoSlogAttrs(cmd)...)
+		l.LogAttrs(context.Background(), level, "slow command", attrs...)
+	}
+}
+
+// CmdExecInfoSlogAttrs returns the log/slog attributes describing a command: id, cmd name, cost, result, error (if
+// any), request and response (if any).
+//
+// @Available since <<VERSION>>
+func CmdExecInfoSlogAttrs(cmd *CmdExecInfo) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("id", cmd.Id),
+		slog.String("cmd", cmd.CmdName),
+		slog.Float64("cost", cmd.Cost),
+		slog.Any("result", cmd.Result),
+	}
+	if cmd.Error != nil {
+		attrs = append(attrs, slog.String("error", cmd.Error.Error()))
+	}
+	if cmd.CmdRequest != nil {
+		attrs = append(attrs, slog.Any("request", cmd.CmdRequest))
+	}
+	if cmd.CmdResponse != nil {
+		attrs = append(attrs, slog.Any("response", cmd.CmdResponse))
+	}
+	return attrs
+}
+
+const defaultSlogMetricsLoggerMessage = "command executed"
+
+// SlogMetricsLoggerOpts configures a SlogMetricsLogger.
+//
+// @Available since <<VERSION>>
+type SlogMetricsLoggerOpts struct {
+	// The logger to write to. If nil, slog.Default() is used.
+	Logger *slog.Logger
+
+	// Message of the log records. Default value is "command executed".
+	Message string
+
+	// Level of log records of successful commands. Default value is slog.LevelInfo.
+	Level slog.Level
+
+	// Successful commands whose cost is greater than this value are logged at slog.LevelWarn.
+	// Set to zero or negative value to disable.
+	SlowThreshold float64
+
+	// Optional function deciding the level of a log record, overriding Level and SlowThreshold.
+	Leveler func(category string, cmd *CmdExecInfo) slog.Level
+
+	// Request fields to include in log records, applicable if the command's request is a map with string keys (e.g.
+	// "query" and "params" of SQL commands). If empty, the whole request is included.
+	RequestFields []string
+
+	// Categories whose commands are written to the log. A command is usually put under several categories (e.g.
+	// MetricsCatAll and MetricsCatDQL), hence writing commands of only one of them logs each command once. Default
+	// value is []string{MetricsCatAll}. Commands of all categories are put to the wrapped logger regardless.
+	Categories []string
+}
+
+// NewSlogMetricsLogger creates a SlogMetricsLogger that writes commands to a log/slog logger before putting them to
+// the wrapped logger.
+//   - logger: the wrapped logger, can be nil if commands only need to be written to the log.
+//
+// @Available since <<VERSION>>
+func NewSlogMetricsLogger(logger IMetricsLogger, opts SlogMetricsLoggerOpts) *SlogMetricsLogger {
+	if opts.Message == "" {
+		opts.Message = defaultSlogMetricsLoggerMessage
+	}
+	if len(opts.Categories) == 0 {
+		opts.Categories = []string{MetricsCatAll}
+	}
+	categories := make(map[string]bool, len(opts.Categories))
+	for _, category := range opts.Categories {
+		categories[category] = true
+	}
+	return &SlogMetricsLogger{logger: logger, opts: opts, categories: categories}
+}
+
+// SlogMetricsLogger is an IMetricsLogger decorator that writes commands of the configured categories (see
+// SlogMetricsLoggerOpts.Categories) as structured log/slog records, with attributes category, id, cmd, cost, result,
+// error (if any), request (if any) and response (if any).
+//
+// By default, failed commands are logged at slog.LevelError, slow commands (see SlogMetricsLoggerOpts.SlowThreshold)
+// at slog.LevelWarn and other commands at SlogMetricsLoggerOpts.Level.
+//
+// @Available since <<VERSION>>
+type SlogMetricsLogger struct {
+	logger     IMetricsLogger
+	opts       SlogMetricsLoggerOpts
+	categories map[string]bool
+}
+
+// Logger returns the wrapped logger.
+func (logger *SlogMetricsLogger) Logger() IMetricsLogger {
+	return logger.logger
+}
+
+// Opts returns the options this logger was created with.
+func (logger *SlogMetricsLogger) Opts() SlogMetricsLoggerOpts {
+	return logger.opts
+}
+
+func (logger *SlogMetricsLogger) level(category string, cmd *CmdExecInfo) slog.Level {
+	if logger.opts.Leveler != nil {
+		return logger.opts.Leveler(category, cmd)
+	}
+	if cmd.Result == CmdResultError || cmd.Error != nil {
+		return slog.LevelError
+	}
+	if logger.opts.SlowThreshold > 0 && cmd.Cost > logger.opts.SlowThreshold {
+		return slog.LevelWarn
+	}
+	return logger.opts.Level
+}
+
+// Put implements IMetricsLogger.Put.
+func (logger *SlogMetricsLogger) Put(category string, cmd *CmdExecInfo) error {
+	if cmd != nil && logger.categories[category] {
+		l := logger.opts.Logger
+		if l == nil {
+			l = slog.Default()
+		}
+		ctx, level := context.Background(), logger.level(category, cmd)
+		if l.Enabled(ctx, level) {
+			l.LogAttrs(ctx, level, logger.opts.Message, logger.attrs(category, cmd)...)
+		}
+	}
+	if logger.logger == nil {
+		return nil
+	}
+	return logger.logger.Put(category, cmd)
+}
+
+func (logger *SlogMetricsLogger) attrs(category string, cmd *CmdExecInfo) []slog.Attr {
+	attrs := append([]slog.Attr{slog.String("category", category)}, CmdExecInfoSlogAttrs(cmd)...)
+	if cmd.CmdRequest != nil {
+		if req, ok := slogRequestGroup(cmd.CmdRequest, logger.opts.RequestFields); ok {
+			for i := range attrs {
+				if attrs[i].Key == "request" {
+					attrs[i] = req
+					break
+				}
+			}
+		}
+	}
+	return attrs
+}
+
+// slogRequestGroup converts a map request (with string keys) to a group of attributes, keeping only the specified
+// fields if any.
+func slogRequestGroup(req interface{}, fields []string) (slog.Attr, bool) {
+	rv := reflect.ValueOf(req)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return slog.Attr{}, false
+	}
+	keys := fields
+	if len(keys) == 0 {
+		keys = make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+	}
+	attrs := make([]any, 0, len(keys))
+	for _, k := range keys {
+		if v := rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())); v.IsValid() {
+			attrs = append(attrs, slog.Any(k, v.Interface()))
+		}
+	}
+	return slog.Group("request", attrs...), true
+}
+
+// Metrics implements IMetricsLogger.Metrics.
+// This function returns nil if there is no wrapped logger.
+func (logger *SlogMetricsLogger) Metrics(category string, opts ...MetricsOpts) (*Metrics, error) {
+	if logger.logger == nil {
+		return nil, nil
+	}
+	return logger.logger.Metrics(category, opts...)
+}
+
+// Categories implements IMetricsCategoryLister.Categories.
+// This function returns nil if the wrapped logger does not implement IMetricsCategoryLister.
+func (logger *SlogMetricsLogger) Categories() []string {
+	if lister, ok := logger.logger.(IMetricsCategoryLister); ok {
+		return lister.Categories()
+	}
+	return nil
+}
+
+// Reset implements IMetricsResetter.Reset.
+// This function does nothing if the wrapped logger does not implement IMetricsResetter.
+func (logger *SlogMetricsLogger) Reset(category string) {
+	if resetter, ok := logger.logger.(IMetricsResetter); ok {
+		resetter.Reset(category)
+	}
+}
+
+// ResetAll implements IMetricsResetter.ResetAll.
+// This function does nothing if the wrapped logger does not implement IMetricsResetter.
+func (logger *SlogMetricsLogger) ResetAll() {
+	if resetter, ok := logger.logger.(IMetricsResetter); ok {
+		resetter.ResetAll()
+	}
+}
+
+// Remove implements IMetricsCategoryRemover.Remove.
+// This function does nothing if the wrapped logger does not implement IMetricsCategoryRemover.
+func (logger *SlogMetricsLogger) Remove(category string) {
+	if remover, ok := logger.logger.(IMetricsCategoryRemover); ok {
+		remover.Remove(category)
+	}
+}
+
+// Close closes the wrapped logger if it implements io.Closer.
+func (logger *SlogMetricsLogger) Close() error {
+	if closer, ok := logger.logger.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
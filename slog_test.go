@@ -0,0 +1,138 @@
+//go:build go1.21
+
+package prom
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewSlogSlowCmdHandler(t *testing.T) {
+	testName := "TestNewSlogSlowCmdHandler"
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(buf, nil))
+	conn := &BaseConnection{}
+	conn.RegisterSlowCmdHandler(MetricsCatAll, 100, NewSlogSlowCmdHandler(logger, slog.LevelWarn))
+
+	_ = conn.LogMetrics(MetricsCatAll, &CmdExecInfo{Id: "fast", CmdName: "SELECT", Cost: 10})
+	cmd := &CmdExecInfo{Id: "slow", CmdName: "SELECT", Cost: 1234, Result: CmdResultError, Error: errors.New("timeout"),
+		CmdRequest: map[string]interface{}{"query": "SELECT 1"}}
+	_ = conn.LogMetrics(MetricsCatAll, cmd)
+
+	output := buf.String()
+	if strings.Contains(output, "id=fast") {
+		t.Fatalf("%s failed: fast command must not be logged\n%s", testName, output)
+	}
+	for _, expected := range []string{"level=WARN", `msg="slow command"`, "category=all", "id=slow", "cmd=SELECT", "cost=1234", "result=ERROR", "error=timeout", `request="map[query:SELECT 1]"`} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("%s failed: expected %#v in output\n%s", testName, expected, output)
+		}
+	}
+}
+
+type testSlogRequest map[string]interface{}
+
+func TestSlogMetricsLogger_Put(t *testing.T) {
+	testName := "TestSlogMetricsLogger_Put"
+	buf := &bytes.Buffer{}
+	memLogger := NewMemoryStoreMetricsLogger(10)
+	logger := NewSlogMetricsLogger(memLogger, SlogMetricsLoggerOpts{
+		Logger:        slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Level:         slog.LevelDebug,
+		SlowThreshold: 100,
+		RequestFields: []string{"query"},
+		Categories:    []string{MetricsCatDQL},
+	})
+	if logger.Logger() != memLogger || logger.Opts().Message != defaultSlogMetricsLoggerMessage {
+		t.Fatalf("%s failed: unexpected logger %#v", testName, logger)
+	}
+	req := testSlogRequest{"query": "SELECT * FROM t WHERE id=?", "params": []interface{}{1}}
+	testCases := []struct {
+		name     string
+		cmd      *CmdExecInfo
+		expected []string
+	}{
+		{"ok", &CmdExecInfo{Id: "1", CmdName: "SELECT", Cost: 10, Result: CmdResultOk, CmdRequest: req, CmdResponse: 5},
+			[]string{"level=DEBUG", `msg="command executed"`, "category=dql", "id=1", "cmd=SELECT", "cost=10", "result=OK", `request.query="SELECT * FROM t WHERE id=?"`, "response=5"}},
+		{"slow", &CmdExecInfo{Id: "2", CmdName: "SELECT", Cost: 101, Result: CmdResultOk},
+			[]string{"level=WARN", "id=2", "cost=101"}},
+		{"error", &CmdExecInfo{Id: "3", CmdName: "SELECT", Cost: 1, Result: CmdResultError, Error: errors.New("dummy")},
+			[]string{"level=ERROR", "id=3", "result=ERROR", "error=dummy"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			if err := logger.Put(MetricsCatDQL, tc.cmd); err != nil {
+				t.Fatalf("%s failed: %s", testName, err)
+			}
+			output := buf.String()
+			for _, expected := range tc.expected {
+				if !strings.Contains(output, expected) {
+					t.Fatalf("%s failed: expected %#v in output\n%s", testName, expected, output)
+				}
+			}
+			if strings.Contains(output, "params") {
+				t.Fatalf("%s failed: unselected request fields must not be logged\n%s", testName, output)
+			}
+		})
+	}
+	if m, _ := logger.Metrics(MetricsCatDQL); m.TotalNumCmds != 3 {
+		t.Fatalf("%s failed: expected %#v commands but received %#v", testName, 3, m.TotalNumCmds)
+	}
+	if cats := logger.Categories(); len(cats) != 1 || cats[0] != MetricsCatDQL {
+		t.Fatalf("%s failed: unexpected categories %#v", testName, cats)
+	}
+}
+
+func TestSlogMetricsLogger_Categories(t *testing.T) {
+	testName := "TestSlogMetricsLogger_Categories"
+	buf := &bytes.Buffer{}
+	memLogger := NewMemoryStoreMetricsLogger(10)
+	logger := NewSlogMetricsLogger(memLogger, SlogMetricsLoggerOpts{Logger: slog.New(slog.NewTextHandler(buf, nil))})
+	if cats := logger.Opts().Categories; len(cats) != 1 || cats[0] != MetricsCatAll {
+		t.Fatalf("%s failed: unexpected default categories %#v", testName, cats)
+	}
+	cmd := &CmdExecInfo{Id: "1", CmdName: "SELECT", Result: CmdResultOk}
+	for _, category := range []string{MetricsCatAll, MetricsCatDQL, "fp:1234"} {
+		_ = logger.Put(category, cmd)
+	}
+	if n := strings.Count(buf.String(), "id=1"); n != 1 {
+		t.Fatalf("%s failed: expected command to be logged once but received %d records\n%s", testName, n, buf.String())
+	}
+	if m, _ := memLogger.Metrics(MetricsCatDQL); m.TotalNumCmds != 1 {
+		t.Fatalf("%s failed: commands of all categories must be put to the wrapped logger", testName)
+	}
+}
+
+func TestSlogMetricsLogger_Leveler(t *testing.T) {
+	testName := "TestSlogMetricsLogger_Leveler"
+	buf := &bytes.Buffer{}
+	logger := NewSlogMetricsLogger(nil, SlogMetricsLoggerOpts{
+		Logger:     slog.New(slog.NewTextHandler(buf, nil)),
+		Message:    "sql",
+		Categories: []string{MetricsCatDQL, MetricsCatDDL},
+		Leveler: func(category string, _ *CmdExecInfo) slog.Level {
+			if category == MetricsCatDDL {
+				return slog.LevelWarn
+			}
+			return slog.LevelDebug
+		},
+	})
+	_ = logger.Put(MetricsCatDQL, &CmdExecInfo{Id: "1", Result: CmdResultError})
+	_ = logger.Put(MetricsCatDDL, &CmdExecInfo{Id: "2", CmdRequest: map[string]interface{}{"query": "DROP TABLE t", "params": []interface{}{}}})
+	output := buf.String()
+	if strings.Contains(output, "id=1") {
+		t.Fatalf("%s failed: record below handler's level must not be logged\n%s", testName, output)
+	}
+	for _, expected := range []string{"level=WARN", "msg=sql", "id=2", `request.query="DROP TABLE t"`, "request.params=[]"} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("%s failed: expected %#v in output\n%s", testName, expected, output)
+		}
+	}
+	if m, err := logger.Metrics(MetricsCatDDL); m != nil || err != nil {
+		t.Fatalf("%s failed: expected no metrics without wrapped logger", testName)
+	}
+}
@@ -171,13 +171,20 @@ var defaultPoolOpts = &PoolOpts{prom.BasePoolOpts{ConnLifetime: 1 * time.Hour, M
 // SqlConnect holds a database/sql DB instance (https://golang.org/pkg/database/sql/#DB) that can be shared within the application.
 type SqlConnect struct {
 	*prom.BaseConnection
-	driver, dsn    string         // driver and data source name (DSN)
-	timeoutMs      int            // default timeout for db operations, in milliseconds
-	flavor         DbFlavor       // database flavor
-	db             *sql.DB        // database instance
-	dbProxy        *DBProxy       // (since v0.3.0) wrapper around the real sql.DB instance
-	loc            *time.Location // timezone location to parse date/time data, new since v0.1.2
-	mysqlParseTime bool           // set to 'true' if specifying parseTime=true in MySQL connection string, new since v0.2.12
+	driver, dsn    string          // driver and data source name (DSN)
+	timeoutMs      int             // default timeout for db operations, in milliseconds
+	flavor         DbFlavor        // database flavor
+	db             *sql.DB         // database instance
+	dbProxy        *DBProxy        // (since v0.3.0) wrapper around the real sql.DB instance
+	loc            *time.Location  // timezone location to parse date/time data, new since v0.1.2
+	mysqlParseTime bool            // set to 'true' if specifying parseTime=true in MySQL connection string, new since v0.2.12
+	redactPolicy   *RedactPolicy   // (since <<VERSION>>) policy to redact query parameters before logging commands
+	breaker        *CircuitBreaker // (since <<VERSION>>) circuit breaker guarding DBProxy calls
+	retryPolicy    *RetryPolicy    // (since <<VERSION>>) default policy to retry DBProxy calls failing with transient errors
+
+	categoryRetryPolicies map[string]*RetryPolicy // (since <<VERSION>>) per-category policies to retry DBProxy calls
+	fingerprints          *fingerprintStore       // (since <<VERSION>>) statistics of query fingerprints, nil if not tracked
+	driverInstrumented    bool                    // (since <<VERSION>>) commands are recorded at driver level, see InstrumentDriver
 }
 
 // NewSqlConnectWithFlavor constructs a new SqlConnect instance.
@@ -228,7 +235,13 @@ func (sc *SqlConnect) Init() error {
 		sc.mysqlParseTime = reMysqlParseTime.MatchString(sc.dsn)
 	}
 
-	db, err := sql.Open(sc.driver, sc.dsn)
+	var db *sql.DB
+	var err error
+	if sc.driverInstrumented {
+		db, err = sc.openInstrumentedDB()
+	} else {
+		db, err = sql.Open(sc.driver, sc.dsn)
+	}
 	if err != nil {
 		return err
 	}
@@ -242,6 +255,9 @@ func (sc *SqlConnect) Init() error {
 		if poolOpts.ConnLifetime > 0 {
 			db.SetConnMaxLifetime(poolOpts.ConnLifetime)
 		}
+		if poolOpts.IdleTimeout > 0 {
+			db.SetConnMaxIdleTime(poolOpts.IdleTimeout)
+		}
 	}
 	if sc.MetricsLogger() == nil {
 		sc.RegisterMetricsLogger(prom.NewMemoryStoreMetricsLogger(1028))
@@ -882,7 +898,7 @@ func (sc *SqlConnect) _scanNilValue(result map[string]interface{}, v *sql.Column
 	return nil
 }
 
-func (sc *SqlConnect) fetchOneRow(rows *sql.Rows, colsAndTypes []*sql.ColumnType) (map[string]interface{}, error) {
+func (sc *SqlConnect) fetchOneRow(rows IRows, colsAndTypes []*sql.ColumnType) (map[string]interface{}, error) {
 	numCols := len(colsAndTypes)
 	vals := make([]interface{}, numCols)
 	scanVals := make([]interface{}, numCols)
@@ -1019,7 +1035,9 @@ func (sc *SqlConnect) fetchOneRow(rows *sql.Rows, colsAndTypes []*sql.ColumnType
 // If no row matches the query, FetchRow returns (<empty slice>, nil).
 //
 // Note: FetchRows does NOT call 'rows.close()' when done!
-func (sc *SqlConnect) FetchRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+//
+// (since <<VERSION>>) rows can be a *sql.Rows or a *RowsProxy, see IRows.
+func (sc *SqlConnect) FetchRows(rows IRows) ([]map[string]interface{}, error) {
 	colTypes, err := rows.ColumnTypes()
 	if err != nil {
 		return nil, err
@@ -1039,7 +1057,9 @@ func (sc *SqlConnect) FetchRows(rows *sql.Rows) ([]map[string]interface{}, error
 // FetchRowsCallback stops the loop when there is no more row to load or 'callback' function returns 'false'.
 //
 // Note: FetchRowsCallback does NOT call 'rows.close()' when done!
-func (sc *SqlConnect) FetchRowsCallback(rows *sql.Rows, callback func(row map[string]interface{}, err error) bool) error {
+//
+// (since <<VERSION>>) rows can be a *sql.Rows or a *RowsProxy, see IRows.
+func (sc *SqlConnect) FetchRowsCallback(rows IRows, callback func(row map[string]interface{}, err error) bool) error {
 	colTypes, err := rows.ColumnTypes()
 	if err != nil {
 		return err
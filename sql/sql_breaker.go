@@ -0,0 +1,400 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btnguyen2k/prom"
+)
+
+// MetricsCatCircuitBreaker is the metrics category of circuit breaker state changes. Each change is logged as a
+// command named "circuit_breaker" whose result is the new state.
+//
+// @Available since <<VERSION>>
+const MetricsCatCircuitBreaker = "circuit_breaker"
+
+// BreakerState is the state of a CircuitBreaker.
+//
+// @Available since <<VERSION>>
+type BreakerState int
+
+const (
+	// BreakerClosed lets all calls through, counting failures.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen rejects all calls until CircuitBreakerOpts.OpenTimeout has elapsed.
+	BreakerOpen
+
+	// BreakerHalfOpen lets a limited number of trial calls through to probe the database.
+	BreakerHalfOpen
+)
+
+// String implements fmt.Stringer.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "OPEN"
+	case BreakerHalfOpen:
+		return "HALF_OPEN"
+	default:
+		return "CLOSED"
+	}
+}
+
+// ErrCircuitOpen matches (via errors.Is) errors returned for calls rejected by a CircuitBreaker.
+//
+// @Available since <<VERSION>>
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned for calls rejected by a CircuitBreaker.
+//
+// @Available since <<VERSION>>
+type CircuitOpenError struct {
+	// State of the breaker when the call was rejected (BreakerOpen, or BreakerHalfOpen if all trial calls are taken).
+	State BreakerState
+
+	// Remaining time before the breaker lets trial calls through, zero if the breaker is half-open.
+	RetryAfter time.Duration
+}
+
+// Error implements error.Error.
+func (e *CircuitOpenError) Error() string {
+	if e.State == BreakerHalfOpen {
+		return "circuit breaker is half-open, trial calls in progress"
+	}
+	return fmt.Sprintf("circuit breaker is open, retry after %s", e.RetryAfter)
+}
+
+// Is makes errors.Is(err, ErrCircuitOpen) return true.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+const (
+	defaultBreakerConsecutiveFailures = 5
+	defaultBreakerMinRequests         = 20
+	defaultBreakerWindow              = 10 * time.Second
+	defaultBreakerOpenTimeout         = 30 * time.Second
+	breakerWindowBuckets              = 10
+)
+
+// CircuitBreakerOpts configures a CircuitBreaker. If both ConsecutiveFailures and FailureRate are not set,
+// ConsecutiveFailures defaults to 5.
+//
+// @Available since <<VERSION>>
+type CircuitBreakerOpts struct {
+	// The breaker trips after this number of consecutive failed calls. Set to zero to disable.
+	ConsecutiveFailures int
+
+	// The breaker trips when the ratio of failed calls (0.0-1.0) within Window reaches this value, once at least
+	// MinRequests calls have been made within Window. Set to zero to disable.
+	FailureRate float64
+
+	// Minimum number of calls within Window before FailureRate applies. Default value is 20.
+	MinRequests int
+
+	// Rolling window to calculate the failure rate. Default value is 10 seconds.
+	Window time.Duration
+
+	// Time the breaker stays open before letting trial calls through. Default value is 30 seconds.
+	OpenTimeout time.Duration
+
+	// Number of trial calls let through while half-open; the breaker closes once all of them succeed and opens again
+	// as soon as one of them fails. Default value is 1.
+	HalfOpenMaxCalls int
+
+	// Decides if a call's error counts as a failure. Default: any error except context.Canceled and sql.ErrNoRows.
+	// Errors not counting as failures are ignored, i.e. they neither count as successes.
+	IsFailure func(err error) bool
+
+	// Optional callback invoked upon state changes.
+	OnStateChange func(from, to BreakerState)
+}
+
+// NewCircuitBreaker creates a new CircuitBreaker instance, attach it to a SqlConnect with
+// SqlConnect.SetCircuitBreaker.
+//
+// @Available since <<VERSION>>
+func NewCircuitBreaker(opts CircuitBreakerOpts) *CircuitBreaker {
+	if opts.ConsecutiveFailures <= 0 && opts.FailureRate <= 0 {
+		opts.ConsecutiveFailures = defaultBreakerConsecutiveFailures
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = defaultBreakerMinRequests
+	}
+	if opts.Window <= 0 {
+		opts.Window = defaultBreakerWindow
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if opts.HalfOpenMaxCalls <= 0 {
+		opts.HalfOpenMaxCalls = 1
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = defaultBreakerIsFailure
+	}
+	return &CircuitBreaker{opts: opts}
+}
+
+func defaultBreakerIsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, sql.ErrNoRows)
+}
+
+// CircuitBreaker stops calls to a database that keeps failing, so that callers fail fast with a CircuitOpenError
+// instead of waiting for timeouts and piling up on the connection pool.
+//
+// The breaker starts closed and trips open after CircuitBreakerOpts.ConsecutiveFailures consecutive failures or when
+// the failure rate reaches CircuitBreakerOpts.FailureRate. After CircuitBreakerOpts.OpenTimeout, it turns half-open
+// and lets trial calls through: the breaker closes if they succeed, or opens again otherwise.
+//
+// A CircuitBreaker should not be shared between SqlConnect instances.
+//
+// @Available since <<VERSION>>
+type CircuitBreaker struct {
+	opts        CircuitBreakerOpts
+	lock        sync.Mutex
+	state       BreakerState
+	generation  int64 // incremented upon every state change, to ignore outcomes of calls started in a previous state
+	openedAt    time.Time
+	consecutive int // consecutive failures while closed
+	trials      int // trial calls let through while half-open
+	trialsOk    int // successful trial calls while half-open
+	buckets     [breakerWindowBuckets]breakerBucket
+	rejected    int64
+	listener    func(from, to BreakerState)
+}
+
+type breakerBucket struct {
+	slot            int64
+	total, failures int
+}
+
+// BreakerStats is a snapshot of a CircuitBreaker's state and counters.
+//
+// @Available since <<VERSION>>
+type BreakerStats struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"` // consecutive failures while closed
+	WindowCalls         int          `json:"window_calls"`         // number of calls within the rolling window
+	WindowFailures      int          `json:"window_failures"`      // number of failed calls within the rolling window
+	Rejected            int64        `json:"rejected"`             // total number of rejected calls
+}
+
+// Opts returns the options of this breaker (with default values applied).
+func (cb *CircuitBreaker) Opts() CircuitBreakerOpts {
+	return cb.opts
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() BreakerState {
+	return cb.Stats().State
+}
+
+// Stats returns the current state and counters of the breaker.
+func (cb *CircuitBreaker) Stats() BreakerStats {
+	now := time.Now()
+	cb.lock.Lock()
+	notify := cb.checkOpenTimeout(now)
+	total, failures := cb.windowCounts(now)
+	stats := BreakerStats{State: cb.state, ConsecutiveFailures: cb.consecutive, WindowCalls: total, WindowFailures: failures, Rejected: cb.rejected}
+	cb.lock.Unlock()
+	notify()
+	return stats
+}
+
+// Reset closes the breaker and clears its counters.
+func (cb *CircuitBreaker) Reset() {
+	cb.lock.Lock()
+	notify := cb.transition(BreakerClosed, time.Now())
+	cb.consecutive, cb.buckets = 0, [breakerWindowBuckets]breakerBucket{}
+	cb.lock.Unlock()
+	notify()
+}
+
+// Allow asks the breaker for permission to make a call. If the call is allowed, the returned function must be called
+// with the call's error (nil if succeeded) once the call has finished. Otherwise, a CircuitOpenError is returned.
+func (cb *CircuitBreaker) Allow() (done func(err error), err error) {
+	now := time.Now()
+	cb.lock.Lock()
+	notify := cb.checkOpenTimeout(now)
+	switch cb.state {
+	case BreakerOpen:
+		cb.rejected++
+		err = &CircuitOpenError{State: BreakerOpen, RetryAfter: cb.opts.OpenTimeout - now.Sub(cb.openedAt)}
+	case BreakerHalfOpen:
+		if cb.trials >= cb.opts.HalfOpenMaxCalls {
+			cb.rejected++
+			err = &CircuitOpenError{State: BreakerHalfOpen}
+		} else {
+			cb.trials++
+		}
+	}
+	generation := cb.generation
+	cb.lock.Unlock()
+	notify()
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) { cb.record(generation, err) }, nil
+}
+
+func (cb *CircuitBreaker) record(generation int64, err error) {
+	now := time.Now()
+	failed := cb.opts.IsFailure(err)
+	cb.lock.Lock()
+	notify := func() {}
+	if generation == cb.generation && err != nil && !failed {
+		// errors not counting as failures (e.g. cancellation by the caller) tell nothing about the database's health
+		if cb.state == BreakerHalfOpen {
+			cb.trials--
+		}
+	} else if generation == cb.generation {
+		switch cb.state {
+		case BreakerClosed:
+			bucket := cb.bucket(now)
+			bucket.total++
+			if failed {
+				bucket.failures++
+				cb.consecutive++
+			} else {
+				cb.consecutive = 0
+			}
+			if cb.shouldTrip(now) {
+				notify = cb.transition(BreakerOpen, now)
+			}
+		case BreakerHalfOpen:
+			if failed {
+				notify = cb.transition(BreakerOpen, now)
+			} else if cb.trialsOk++; cb.trialsOk >= cb.opts.HalfOpenMaxCalls {
+				notify = cb.transition(BreakerClosed, now)
+			}
+		}
+	}
+	cb.lock.Unlock()
+	notify()
+}
+
+func (cb *CircuitBreaker) shouldTrip(now time.Time) bool {
+	if cb.opts.ConsecutiveFailures > 0 && cb.consecutive >= cb.opts.ConsecutiveFailures {
+		return true
+	}
+	if cb.opts.FailureRate > 0 {
+		total, failures := cb.windowCounts(now)
+		return total >= cb.opts.MinRequests && float64(failures)/float64(total) >= cb.opts.FailureRate
+	}
+	return false
+}
+
+func (cb *CircuitBreaker) slot(now time.Time) int64 {
+	return now.UnixNano() / int64(cb.opts.Window/breakerWindowBuckets)
+}
+
+func (cb *CircuitBreaker) bucket(now time.Time) *breakerBucket {
+	slot := cb.slot(now)
+	bucket := &cb.buckets[slot%breakerWindowBuckets]
+	if bucket.slot != slot {
+		*bucket = breakerBucket{slot: slot}
+	}
+	return bucket
+}
+
+func (cb *CircuitBreaker) windowCounts(now time.Time) (total, failures int) {
+	slot := cb.slot(now)
+	for _, bucket := range cb.buckets {
+		if slot-bucket.slot < breakerWindowBuckets {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return
+}
+
+// checkOpenTimeout turns an open breaker half-open once OpenTimeout has elapsed, must be called with the lock held.
+func (cb *CircuitBreaker) checkOpenTimeout(now time.Time) (notify func()) {
+	if cb.state == BreakerOpen && now.Sub(cb.openedAt) >= cb.opts.OpenTimeout {
+		return cb.transition(BreakerHalfOpen, now)
+	}
+	return func() {}
+}
+
+// transition changes the breaker's state, must be called with the lock held. The returned function notifies
+// listeners and must be called after the lock is released.
+func (cb *CircuitBreaker) transition(to BreakerState, now time.Time) (notify func()) {
+	from := cb.state
+	if from == to {
+		return func() {}
+	}
+	cb.state = to
+	cb.generation++
+	cb.trials, cb.trialsOk = 0, 0
+	switch to {
+	case BreakerOpen:
+		cb.openedAt = now
+	case BreakerClosed:
+		cb.consecutive, cb.buckets = 0, [breakerWindowBuckets]breakerBucket{}
+	}
+	listener, onStateChange := cb.listener, cb.opts.OnStateChange
+	return func() {
+		if listener != nil {
+			listener(from, to)
+		}
+		if onStateChange != nil {
+			onStateChange(from, to)
+		}
+	}
+}
+
+// GetCircuitBreaker returns the circuit breaker guarding DBProxy calls, nil if none.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) GetCircuitBreaker() *CircuitBreaker {
+	return sc.breaker
+}
+
+// SetCircuitBreaker attaches a circuit breaker guarding DBProxy's ExecContext and QueryContext calls (and their
+// context-less variants). Set to nil to remove the breaker.
+//
+// Rejected calls are logged with result prom.CmdResultRejected, and the breaker's state changes are logged to
+// category MetricsCatCircuitBreaker.
+//
+// Note: QueryRow/QueryRowContext are not guarded since an *sql.Row carrying an error cannot be constructed outside
+// package database/sql.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) SetCircuitBreaker(breaker *CircuitBreaker) *SqlConnect {
+	if breaker != nil {
+		breaker.lock.Lock()
+		breaker.listener = sc.logBreakerStateChange
+		breaker.lock.Unlock()
+	}
+	sc.breaker = breaker
+	return sc
+}
+
+func (sc *SqlConnect) logBreakerStateChange(from, to BreakerState) {
+	cmd := sc.NewCmdExecInfo()
+	cmd.CmdName, cmd.CmdRequest = "circuit_breaker", m{"from": from.String(), "to": to.String()}
+	cmd.EndWithCost(0, to.String(), to.String(), nil)
+	_ = sc.LogMetrics(MetricsCatCircuitBreaker, cmd)
+}
+
+// breakerAllow asks the circuit breaker (if any) for permission to make a call.
+func (sc *SqlConnect) breakerAllow() (done func(err error), err error) {
+	if sc.breaker == nil {
+		return func(error) {}, nil
+	}
+	return sc.breaker.Allow()
+}
+
+// endCmd ends a command executed via execWithRetry, marking it as rejected if the circuit breaker rejected the call.
+func endCmd(cmd *prom.CmdExecInfo, err error) {
+	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
+	if errors.Is(err, ErrCircuitOpen) {
+		cmd.Result = prom.CmdResultRejected
+	}
+}
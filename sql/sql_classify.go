@@ -0,0 +1,248 @@
+package sql
+
+import (
+	"strings"
+
+	"github.com/btnguyen2k/prom"
+)
+
+// statementCategories maps a statement's main keyword to its metrics category.
+var statementCategories = map[string]string{
+	"SELECT": prom.MetricsCatDQL, "VALUES": prom.MetricsCatDQL, "TABLE": prom.MetricsCatDQL, "SHOW": prom.MetricsCatDQL,
+	"DESCRIBE": prom.MetricsCatDQL, "DESC": prom.MetricsCatDQL, "EXPLAIN": prom.MetricsCatDQL,
+
+	"INSERT": prom.MetricsCatDML, "UPDATE": prom.MetricsCatDML, "DELETE": prom.MetricsCatDML, "UPSERT": prom.MetricsCatDML,
+	"MERGE": prom.MetricsCatDML, "REPLACE": prom.MetricsCatDML, "CALL": prom.MetricsCatDML,
+
+	"CREATE": prom.MetricsCatDDL, "ALTER": prom.MetricsCatDDL, "DROP": prom.MetricsCatDDL, "TRUNCATE": prom.MetricsCatDDL,
+	"RENAME": prom.MetricsCatDDL, "COMMENT": prom.MetricsCatDDL,
+
+	"GRANT": prom.MetricsCatDCL, "REVOKE": prom.MetricsCatDCL, "DENY": prom.MetricsCatDCL,
+
+	"BEGIN": prom.MetricsCatTCL, "START": prom.MetricsCatTCL, "COMMIT": prom.MetricsCatTCL, "ROLLBACK": prom.MetricsCatTCL,
+	"SAVEPOINT": prom.MetricsCatTCL, "RELEASE": prom.MetricsCatTCL, "END": prom.MetricsCatTCL, "ABORT": prom.MetricsCatTCL,
+}
+
+// beginTransactionWords are the words that may follow BEGIN in a statement starting a transaction. BEGIN followed by
+// anything else (e.g. a PL/SQL block) does not start a transaction.
+var beginTransactionWords = map[string]bool{
+	"TRAN": true, "TRANSACTION": true, "WORK": true, "DEFERRED": true, "IMMEDIATE": true, "EXCLUSIVE": true,
+}
+
+// ClassifyStatement finds the main keyword of a SQL statement (upper-cased) and its metrics category:
+//   - prom.MetricsCatDQL: SELECT, VALUES, TABLE, SHOW, DESCRIBE/DESC, EXPLAIN.
+//   - prom.MetricsCatDML: INSERT, UPDATE, DELETE, UPSERT, MERGE, REPLACE, CALL.
+//   - prom.MetricsCatDDL: CREATE, ALTER, DROP, TRUNCATE, RENAME, COMMENT.
+//   - prom.MetricsCatDCL: GRANT, REVOKE, DENY.
+//   - prom.MetricsCatTCL: BEGIN, START (TRANSACTION), COMMIT, END, ROLLBACK, ABORT, SAVEPOINT, RELEASE (SAVEPOINT).
+//   - prom.MetricsCatOther: everything else.
+//
+// BEGIN is categorized as prom.MetricsCatTCL only if it is followed by TRAN, TRANSACTION, WORK, a SQLite transaction
+// mode (DEFERRED, IMMEDIATE or EXCLUSIVE), ";" or the end of the statement. Otherwise (e.g. BEGIN ... END blocks)
+// the statement is categorized as prom.MetricsCatOther.
+//
+// Leading comments (-- ... and /* ... */, as well as # ... if flavor is FlavorMySql) and opening parentheses are
+// skipped, and common table expressions are resolved, e.g. the main keyword of "WITH t AS (SELECT ...) UPDATE ..." is
+// UPDATE.
+//
+// @Available since <<VERSION>>
+func ClassifyStatement(query string, flavor DbFlavor) (keyword, category string) {
+	s := &sqlScanner{s: query, hashComments: flavor == FlavorMySql}
+	s.skipSpacesAndParens()
+	keyword = strings.ToUpper(s.word())
+	if keyword == "WITH" {
+		if main := s.skipCtes(); main != "" {
+			keyword = main
+		}
+	}
+	if category = statementCategories[keyword]; category == "" || (keyword == "BEGIN" && !s.beginsTransaction()) {
+		category = prom.MetricsCatOther
+	}
+	return keyword, category
+}
+
+// beginsTransaction checks if the words following BEGIN make the statement start a transaction.
+func (s *sqlScanner) beginsTransaction() bool {
+	if s.skipSpaces(); s.eof() || s.s[s.i] == ';' {
+		return true
+	}
+	return beginTransactionWords[strings.ToUpper(s.word())]
+}
+
+// classifyExec classifies a statement executed via Exec: statements returning rows are expected to be run via Query,
+// hence DQL statements executed via Exec are categorized as prom.MetricsCatOther.
+func classifyExec(query string, flavor DbFlavor) (keyword, category string) {
+	keyword, category = ClassifyStatement(query, flavor)
+	if category == prom.MetricsCatDQL {
+		category = prom.MetricsCatOther
+	}
+	return keyword, category
+}
+
+// sqlScanner is a minimal tokenizer, just enough to find the main keyword of a statement.
+type sqlScanner struct {
+	s            string
+	i            int
+	hashComments bool // if true, # starts a line comment (MySQL)
+}
+
+func (s *sqlScanner) eof() bool {
+	return s.i >= len(s.s)
+}
+
+// skipSpaces skips whitespaces and comments.
+func (s *sqlScanner) skipSpaces() {
+	for !s.eof() {
+		switch c := s.s[s.i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			s.i++
+		case (c == '#' && s.hashComments) || (c == '-' && strings.HasPrefix(s.s[s.i:], "--")):
+			if n := strings.IndexByte(s.s[s.i:], '\n'); n >= 0 {
+				s.i += n + 1
+			} else {
+				s.i = len(s.s)
+			}
+		case c == '/' && strings.HasPrefix(s.s[s.i:], "/*"):
+			if n := strings.Index(s.s[s.i+2:], "*/"); n >= 0 {
+				s.i += n + 4
+			} else {
+				s.i = len(s.s)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *sqlScanner) skipSpacesAndParens() {
+	for s.skipSpaces(); !s.eof() && s.s[s.i] == '('; s.skipSpaces() {
+		s.i++
+	}
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// word reads a bare word, returning empty string if the next token is not a word.
+func (s *sqlScanner) word() string {
+	start := s.i
+	for !s.eof() && isWordChar(s.s[s.i]) {
+		s.i++
+	}
+	return s.s[start:s.i]
+}
+
+// identifier reads a bare or quoted ("x", `x` or [x]) identifier, returning false if there is none.
+func (s *sqlScanner) identifier() bool {
+	if s.eof() {
+		return false
+	}
+	switch c := s.s[s.i]; c {
+	case '"', '`', '[':
+		closing := c
+		if c == '[' {
+			closing = ']'
+		}
+		if n := strings.IndexByte(s.s[s.i+1:], closing); n >= 0 {
+			s.i += n + 2
+			return true
+		}
+		return false
+	default:
+		return s.word() != ""
+	}
+}
+
+// skipParens skips a balanced parenthesized block starting at the current position, taking string literals, quoted
+// identifiers and comments into account.
+func (s *sqlScanner) skipParens() bool {
+	depth := 0
+	for !s.eof() {
+		switch c := s.s[s.i]; c {
+		case '(':
+			depth++
+			s.i++
+		case ')':
+			depth--
+			s.i++
+			if depth == 0 {
+				return true
+			}
+		case '\'', '"', '`':
+			s.skipQuoted(c)
+		case '-', '/', '#':
+			start := s.i
+			if s.skipSpaces(); s.i == start {
+				s.i++
+			}
+		default:
+			s.i++
+		}
+	}
+	return false
+}
+
+// skipQuoted skips a string literal or quoted identifier starting at the current position. Backslash escapes are
+// taken into account in string literals (e.g. 'it\'s'), doubled quotes are handled as adjacent literals.
+func (s *sqlScanner) skipQuoted(quote byte) {
+	for s.i++; !s.eof(); s.i++ {
+		switch s.s[s.i] {
+		case '\\':
+			if quote != '`' {
+				s.i++
+			}
+		case quote:
+			s.i++
+			return
+		}
+	}
+	s.i = len(s.s)
+}
+
+// skipCtes skips the common table expressions following WITH, returning the main keyword of the statement (upper-cased),
+// or empty string if the statement cannot be parsed.
+func (s *sqlScanner) skipCtes() string {
+	s.skipSpaces()
+	if w := s.peekWord(); strings.EqualFold(w, "RECURSIVE") {
+		s.word()
+	}
+	for {
+		s.skipSpaces()
+		if !s.identifier() {
+			return ""
+		}
+		s.skipSpaces()
+		if !s.eof() && s.s[s.i] == '(' && !s.skipParens() { // column list
+			return ""
+		}
+		s.skipSpaces()
+		if !strings.EqualFold(s.word(), "AS") {
+			return ""
+		}
+		for s.skipSpaces(); ; s.skipSpaces() {
+			if w := s.peekWord(); strings.EqualFold(w, "NOT") || strings.EqualFold(w, "MATERIALIZED") {
+				s.word()
+				continue
+			}
+			break
+		}
+		if s.eof() || s.s[s.i] != '(' || !s.skipParens() {
+			return ""
+		}
+		s.skipSpaces()
+		if !s.eof() && s.s[s.i] == ',' {
+			s.i++
+			continue
+		}
+		s.skipSpacesAndParens()
+		return strings.ToUpper(s.word())
+	}
+}
+
+func (s *sqlScanner) peekWord() string {
+	start := s.i
+	w := s.word()
+	s.i = start
+	return w
+}
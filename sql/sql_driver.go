@@ -0,0 +1,564 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/btnguyen2k/prom"
+)
+
+// IsDriverInstrumented returns true if commands are recorded at driver level, see InstrumentDriver.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) IsDriverInstrumented() bool {
+	return sc.driverInstrumented
+}
+
+// InstrumentDriver enables (or disables) driver-level instrumentation: the underlying sql.DB is opened via a
+// driver.Connector wrapping the registered driver, so that every command flowing through it is recorded to the
+// metrics logger, in the same categories as commands executed via the proxies. Hence, code using GetDB (e.g. ORMs or
+// query builders requiring a raw *sql.DB) is measured too.
+//
+// Once enabled, the proxies become thin conveniences: they no longer log commands the driver records, except calls
+// rejected by the circuit breaker (which never reach the driver). Each attempt of a retried command is recorded as a
+// separate command.
+//
+// If the SqlConnect is already initialized (e.g. created by NewSqlConnectWithFlavor), the underlying sql.DB is
+// re-opened and the previous one is closed, hence this function should be called before the SqlConnect is used.
+//
+// Note: driver connections are wrapped, hence sql.Conn.Raw passes the wrapper to its callback rather than the
+// driver's connection. The wrapper implements interface{ Unwrap() driver.Conn }, which returns the driver's
+// connection, e.g.:
+//
+//	conn.Raw(func(driverConn any) error {
+//		if w, ok := driverConn.(interface{ Unwrap() driver.Conn }); ok {
+//			driverConn = w.Unwrap()
+//		}
+//		...
+//	})
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) InstrumentDriver(enabled bool) error {
+	if sc.driverInstrumented == enabled {
+		return nil
+	}
+	sc.driverInstrumented = enabled
+	if sc.db == nil {
+		return nil
+	}
+	oldDb, oldDbProxy := sc.db, sc.dbProxy
+	sc.db, sc.dbProxy = nil, nil
+	if err := sc.Init(); err != nil {
+		sc.db, sc.dbProxy, sc.driverInstrumented = oldDb, oldDbProxy, !enabled
+		return err
+	}
+	return oldDb.Close()
+}
+
+// openInstrumentedDB opens a sql.DB via a connector wrapping the registered driver.
+func (sc *SqlConnect) openInstrumentedDB() (*sql.DB, error) {
+	// sql.Open is the only way to look up a registered driver by name
+	db, err := sql.Open(sc.driver, sc.dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	_ = db.Close()
+	var connector driver.Connector
+	if dc, ok := drv.(driver.DriverContext); ok {
+		if connector, err = dc.OpenConnector(sc.dsn); err != nil {
+			return nil, err
+		}
+	} else {
+		connector = &dsnConnector{dsn: sc.dsn, driver: drv}
+	}
+	return sql.OpenDB(&instrumentedConnector{connector: connector, sc: sc}), nil
+}
+
+// dsnConnector is a driver.Connector for drivers not implementing driver.DriverContext.
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c *dsnConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type instrumentedConnector struct {
+	connector driver.Connector
+	sc        *SqlConnect
+}
+
+func (c *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn: conn, sc: c.sc}, nil
+}
+
+func (c *instrumentedConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+// Close is called by sql.DB.Close, closing the wrapped connector if it implements io.Closer.
+func (c *instrumentedConnector) Close() error {
+	if closer, ok := c.connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+/*----------------------------------------------------------------------*/
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sql: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+func valuesToNamedValues(values []driver.Value) []driver.NamedValue {
+	args := make([]driver.NamedValue, len(values))
+	for i, v := range values {
+		args[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return args
+}
+
+// namedValuesToArgs converts driver arguments back to query parameters as passed to database/sql, to be logged.
+func namedValuesToArgs(args []driver.NamedValue) []interface{} {
+	result := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			result[i] = sql.Named(arg.Name, arg.Value)
+		} else {
+			result[i] = arg.Value
+		}
+	}
+	return result
+}
+
+// driverExec executes a command via fn and logs it, unless the driver returns driver.ErrSkip (database/sql then
+// falls back to a prepared statement, which is logged instead).
+func (sc *SqlConnect) driverExec(ctx context.Context, query string, args []driver.NamedValue, fn func() (driver.Result, error)) (driver.Result, error) {
+	cmd := sc.newCmdExecInfo(ctx)
+	result, err := fn()
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	cmdName, category := classifyExec(query, sc.flavor)
+	cmd.CmdName, cmd.CmdRequest = cmdName, sc.cmdRequest(query, namedValuesToArgs(args))
+	if err == nil {
+		lastInsertId, _ := result.LastInsertId()
+		rowsAffected, _ := result.RowsAffected()
+		cmd.CmdResponse = m{"lastInsertId": lastInsertId, "rowsAffected": rowsAffected}
+	}
+	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
+	sc.putCmdMetrics(category, query, cmd)
+	return result, err
+}
+
+// driverQuery executes a query via fn, the command is logged when the returned rows are closed. See driverExec.
+func (sc *SqlConnect) driverQuery(ctx context.Context, query string, args []driver.NamedValue, fn func() (driver.Rows, error)) (driver.Rows, error) {
+	cmd := sc.newCmdExecInfo(ctx)
+	rows, err := fn()
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	cmdName, category := ClassifyStatement(query, sc.flavor)
+	cmd.CmdName, cmd.CmdRequest = cmdName, sc.cmdRequest(query, namedValuesToArgs(args))
+	if err != nil {
+		cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
+		sc.putCmdMetrics(category, query, cmd)
+		return nil, err
+	}
+	return &instrumentedRows{rows: rows, sc: sc, cmd: cmd, category: category, query: query, queryTime: time.Now()}, nil
+}
+
+// driverOther executes a command not related to a query (e.g. ping or commit) via fn and logs it to the specified
+// category, see putOtherCmdMetrics.
+func (sc *SqlConnect) driverOther(ctx context.Context, category, cmdName string, request interface{}, fn func() error) error {
+	cmd := sc.newCmdExecInfo(ctx)
+	cmd.CmdName, cmd.CmdRequest = cmdName, request
+	err := fn()
+	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
+	sc.putOtherCmdMetrics(category, cmd)
+	return err
+}
+
+/*----------------------------------------------------------------------*/
+
+// instrumentedConn wraps a driver.Conn. It implements all optional interfaces database/sql looks for, falling back
+// to the behavior of database/sql if the wrapped connection does not implement them.
+type instrumentedConn struct {
+	conn driver.Conn
+	sc   *SqlConnect
+}
+
+var (
+	_ driver.ConnBeginTx        = (*instrumentedConn)(nil)
+	_ driver.ConnPrepareContext = (*instrumentedConn)(nil)
+	_ driver.ExecerContext      = (*instrumentedConn)(nil)
+	_ driver.QueryerContext     = (*instrumentedConn)(nil)
+	_ driver.Pinger             = (*instrumentedConn)(nil)
+	_ driver.SessionResetter    = (*instrumentedConn)(nil)
+	_ driver.Validator          = (*instrumentedConn)(nil)
+	_ driver.NamedValueChecker  = (*instrumentedConn)(nil)
+)
+
+// Unwrap returns the wrapped driver connection, see SqlConnect.InstrumentDriver.
+func (c *instrumentedConn) Unwrap() driver.Conn {
+	return c.conn
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	err := c.sc.driverOther(ctx, prom.MetricsCatOther, "prepare", m{"query": query}, func() (err error) {
+		if p, ok := c.conn.(driver.ConnPrepareContext); ok {
+			stmt, err = p.PrepareContext(ctx, query)
+		} else if err = ctx.Err(); err == nil {
+			stmt, err = c.conn.Prepare(query)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &instrumentedStmt{stmt: stmt, conn: c.conn, sc: c.sc, query: query}
+	if _, ok := stmt.(driver.ColumnConverter); ok {
+		return instrumentedStmtWithConverter{s}, nil
+	}
+	return s, nil
+}
+
+func (c *instrumentedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *instrumentedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	var err error
+	if b, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else {
+		if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+			return nil, errors.New("sql: driver does not support non-default isolation level")
+		}
+		if opts.ReadOnly {
+			return nil, errors.New("sql: driver does not support read-only transactions")
+		}
+		if err = ctx.Err(); err == nil {
+			tx, err = c.conn.Begin() //nolint:staticcheck // fallback for drivers not implementing driver.ConnBeginTx
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{tx: tx, sc: c.sc, ctx: ctx}, nil
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.conn.(driver.ExecerContext); ok {
+		return c.sc.driverExec(ctx, query, args, func() (driver.Result, error) {
+			return e.ExecContext(ctx, query, args)
+		})
+	}
+	if e, ok := c.conn.(driver.Execer); ok { //nolint:staticcheck // fallback for drivers not implementing driver.ExecerContext
+		return c.sc.driverExec(ctx, query, args, func() (driver.Result, error) {
+			values, err := namedValuesToValues(args)
+			if err != nil {
+				return nil, err
+			}
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			return e.Exec(query, values)
+		})
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.conn.(driver.QueryerContext); ok {
+		return c.sc.driverQuery(ctx, query, args, func() (driver.Rows, error) {
+			return q.QueryContext(ctx, query, args)
+		})
+	}
+	if q, ok := c.conn.(driver.Queryer); ok { //nolint:staticcheck // fallback for drivers not implementing driver.QueryerContext
+		return c.sc.driverQuery(ctx, query, args, func() (driver.Rows, error) {
+			values, err := namedValuesToValues(args)
+			if err != nil {
+				return nil, err
+			}
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			return q.Query(query, values)
+		})
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	return c.sc.driverOther(ctx, prom.MetricsCatOther, "ping", nil, func() error {
+		if p, ok := c.conn.(driver.Pinger); ok {
+			return p.Ping(ctx)
+		}
+		return nil
+	})
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if v, ok := c.conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *instrumentedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+/*----------------------------------------------------------------------*/
+
+type instrumentedTx struct {
+	tx  driver.Tx
+	sc  *SqlConnect
+	ctx context.Context // context the transaction was started with, its labels are attached to commit/rollback
+}
+
+func (t *instrumentedTx) Commit() error {
+	return t.sc.driverOther(t.ctx, prom.MetricsCatTCL, "commit", nil, t.tx.Commit)
+}
+
+func (t *instrumentedTx) Rollback() error {
+	return t.sc.driverOther(t.ctx, prom.MetricsCatTCL, "rollback", nil, t.tx.Rollback)
+}
+
+/*----------------------------------------------------------------------*/
+
+type instrumentedStmt struct {
+	stmt  driver.Stmt
+	conn  driver.Conn // the connection the statement was prepared on
+	sc    *SqlConnect
+	query string
+}
+
+var (
+	_ driver.StmtExecContext   = (*instrumentedStmt)(nil)
+	_ driver.StmtQueryContext  = (*instrumentedStmt)(nil)
+	_ driver.NamedValueChecker = (*instrumentedStmt)(nil)
+)
+
+func (s *instrumentedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *instrumentedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *instrumentedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (s *instrumentedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.sc.driverExec(ctx, s.query, args, func() (driver.Result, error) {
+		if e, ok := s.stmt.(driver.StmtExecContext); ok {
+			return e.ExecContext(ctx, args)
+		}
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		return s.stmt.Exec(values) //nolint:staticcheck // fallback for drivers not implementing driver.StmtExecContext
+	})
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.sc.driverQuery(ctx, s.query, args, func() (driver.Rows, error) {
+		if q, ok := s.stmt.(driver.StmtQueryContext); ok {
+			return q.QueryContext(ctx, args)
+		}
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		return s.stmt.Query(values) //nolint:staticcheck // fallback for drivers not implementing driver.StmtQueryContext
+	})
+}
+
+// CheckNamedValue implements driver.NamedValueChecker: database/sql looks for a checker on the statement first, then
+// on the connection, hence both are consulted.
+func (s *instrumentedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	if checker, ok := s.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// instrumentedStmtWithConverter wraps statements implementing driver.ColumnConverter, which changes how database/sql
+// converts arguments, hence is implemented only if the wrapped statement does.
+type instrumentedStmtWithConverter struct {
+	*instrumentedStmt
+}
+
+func (s instrumentedStmtWithConverter) ColumnConverter(idx int) driver.ValueConverter {
+	return s.stmt.(driver.ColumnConverter).ColumnConverter(idx) //nolint:staticcheck // passed through to the wrapped statement
+}
+
+/*----------------------------------------------------------------------*/
+
+// instrumentedRows wraps a driver.Rows, finalizing the query's command when closed (database/sql closes rows once
+// they are exhausted). Column type information is passed through from the wrapped rows.
+type instrumentedRows struct {
+	rows                    driver.Rows
+	sc                      *SqlConnect
+	cmd                     *prom.CmdExecInfo
+	category, query         string
+	queryTime, firstRowTime time.Time
+	numRows                 int64
+	err                     error // first error returned by Next, other than io.EOF
+	closed                  bool
+}
+
+var (
+	_ driver.RowsNextResultSet              = (*instrumentedRows)(nil)
+	_ driver.RowsColumnTypeScanType         = (*instrumentedRows)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*instrumentedRows)(nil)
+	_ driver.RowsColumnTypeLength           = (*instrumentedRows)(nil)
+	_ driver.RowsColumnTypeNullable         = (*instrumentedRows)(nil)
+	_ driver.RowsColumnTypePrecisionScale   = (*instrumentedRows)(nil)
+)
+
+func (r *instrumentedRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	err := r.rows.Next(dest)
+	if err == nil {
+		if r.numRows++; r.numRows == 1 {
+			r.firstRowTime = time.Now()
+		}
+	} else if err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.rows.Close()
+	if !r.closed {
+		r.closed = true
+		timeToFirstRow := time.Duration(0)
+		if !r.firstRowTime.IsZero() {
+			timeToFirstRow = r.firstRowTime.Sub(r.cmd.BeginTime)
+		}
+		r.cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, r.err)
+		r.cmd.CmdResponse = m{
+			"rowsScanned":    r.numRows,
+			"timeToFirstRow": float64(timeToFirstRow.Microseconds()),
+			"fetchTime":      float64(r.cmd.EndTime.Sub(r.queryTime).Microseconds()),
+		}
+		r.sc.putCmdMetrics(r.category, r.query, r.cmd)
+	}
+	return err
+}
+
+func (r *instrumentedRows) HasNextResultSet() bool {
+	if rs, ok := r.rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *instrumentedRows) NextResultSet() error {
+	if rs, ok := r.rows.(driver.RowsNextResultSet); ok {
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
+
+var scanTypeAny = reflect.TypeOf(new(interface{})).Elem()
+
+func (r *instrumentedRows) ColumnTypeScanType(index int) reflect.Type {
+	if ct, ok := r.rows.(driver.RowsColumnTypeScanType); ok {
+		return ct.ColumnTypeScanType(index)
+	}
+	return scanTypeAny
+}
+
+func (r *instrumentedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if ct, ok := r.rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return ct.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *instrumentedRows) ColumnTypeLength(index int) (length int64, ok bool) {
+	if ct, ok := r.rows.(driver.RowsColumnTypeLength); ok {
+		return ct.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *instrumentedRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if ct, ok := r.rows.(driver.RowsColumnTypeNullable); ok {
+		return ct.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *instrumentedRows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	if ct, ok := r.rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return ct.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,554 @@
+package sql
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btnguyen2k/prom"
+	"github.com/rcrowley/go-metrics"
+)
+
+// MetricsCatFingerprintPrefix prefixes the metrics category commands of a query fingerprint are logged under (the
+// category is MetricsCatFingerprintPrefix + FingerprintStats.Id), see SqlConnect.SetFingerprintOpts.
+//
+// @Available since <<VERSION>>
+const MetricsCatFingerprintPrefix = "fp:"
+
+const (
+	defaultMaxFingerprints = 1000
+	fingerprintSampleSize  = 256
+)
+
+// Fingerprint normalizes a SQL query so that executions of the same query with different values share the same
+// fingerprint:
+//   - comments (-- ... and /* ... */, as well as # ... if flavor is FlavorMySql) are removed, whitespaces are
+//     collapsed and unquoted words are lower-cased.
+//   - string and numeric literals, as well as placeholders of all styles (?, $1, :name, @p1), are replaced by "?".
+//   - IN-lists are collapsed to "in (?+)", and identical rows of VALUES lists are collapsed to one.
+//
+// Quoted identifiers ("x" and `x`) are kept as-is.
+//
+// @Available since <<VERSION>>
+func Fingerprint(query string, flavor DbFlavor) string {
+	tokens := collapseValuesRows(collapseInLists(tokenTexts(fingerprintTokens(query, flavor))))
+	var sb strings.Builder
+	for i, token := range tokens {
+		if i > 0 && fingerprintSpaced(tokens[i-1], token) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(token)
+	}
+	return sb.String()
+}
+
+// FingerprintId returns a short identifier (hex-encoded 64-bit FNV-1a hash) of a fingerprint built by Fingerprint.
+//
+// @Available since <<VERSION>>
+func FingerprintId(fingerprint string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(fingerprint))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// multi-char operators, longest first
+var fingerprintOperators = []string{"->>", "<=>", "#>>", "<>", "<=", ">=", "!=", "||", "::", "->", "=>", "#>", "#-"}
+
+func isSpaceChar(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// skipQuoted returns the position following the quoted string starting at query[i], quotes being escaped by doubling
+// them (and by backslashes for single quotes).
+func skipQuoted(query string, i int, quote byte) int {
+	for i++; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote == '\'' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+func skipWord(query string, i int) int {
+	for i < len(query) && isWordChar(query[i]) {
+		i++
+	}
+	return i
+}
+
+// fingerprintToken is a normalized token of a query, spanning query[start:end].
+type fingerprintToken struct {
+	text       string
+	start, end int
+	literal    bool // string or numeric literal (placeholders are not literals)
+}
+
+// fingerprintTokens splits a query into normalized tokens, see Fingerprint.
+func fingerprintTokens(query string, flavor DbFlavor) []fingerprintToken {
+	tokens := make([]fingerprintToken, 0, 16)
+	add := func(text string, start, end int, literal bool) {
+		tokens = append(tokens, fingerprintToken{text: text, start: start, end: end, literal: literal})
+	}
+	for i, n := 0, len(query); i < n; {
+		c := query[i]
+		switch {
+		case isSpaceChar(c):
+			i++
+		case (c == '#' && flavor == FlavorMySql) || (c == '-' && strings.HasPrefix(query[i:], "--")):
+			if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = n
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = n
+			}
+		case c == '\'':
+			j := skipQuoted(query, i, c)
+			add("?", i, j, true)
+			i = j
+		case c == '"' || c == '`':
+			j := skipQuoted(query, i, c)
+			add(query[i:j], i, j, false)
+			i = j
+		case c == '?':
+			add("?", i, i+1, false)
+			i++
+		case c == '$' && i+1 < n && isDigit(query[i+1]): // $1
+			j := i + 1
+			for j < n && isDigit(query[j]) {
+				j++
+			}
+			add("?", i, j, false)
+			i = j
+		case c == '$': // dollar-quoted string $$...$$ or $tag$...$tag$
+			j := i + 1
+			for j < n && query[j] != '$' && isWordChar(query[j]) {
+				j++
+			}
+			if j < n && query[j] == '$' {
+				tag := query[i : j+1]
+				k := n
+				if m := strings.Index(query[j+1:], tag); m >= 0 {
+					k = j + 1 + m + len(tag)
+				}
+				add("?", i, k, true)
+				i = k
+			} else {
+				add(strings.ToLower(query[i:j]), i, j, false)
+				i = j
+			}
+		case (c == ':' || c == '@') && i+1 < n && isWordChar(query[i+1]): // :name, :1, @p1
+			j := skipWord(query, i+1)
+			add("?", i, j, false)
+			i = j
+		case c == '#' && i+1 < n && (isWordChar(query[i+1]) || query[i+1] == '#'): // temp table #name or ##name (MSSQL)
+			j := i + 1
+			if query[j] == '#' {
+				j++
+			}
+			j = skipWord(query, j)
+			add(strings.ToLower(query[i:j]), i, j, false)
+			i = j
+		case c == '@' && strings.HasPrefix(query[i:], "@@"): // system variable
+			j := skipWord(query, i+2)
+			add(strings.ToLower(query[i:j]), i, j, false)
+			i = j
+		case isDigit(c) || (c == '.' && i+1 < n && isDigit(query[i+1])):
+			j := skipNumber(query, i)
+			add("?", i, j, true)
+			i = j
+		case isWordChar(c):
+			j := skipWord(query, i)
+			if j == i+1 && j < n && query[j] == '\'' && strings.IndexByte("NnEeXxBb", c) >= 0 { // N'...', X'...'
+				j = skipQuoted(query, j, '\'')
+				add("?", i, j, true)
+			} else {
+				add(strings.ToLower(query[i:j]), i, j, false)
+			}
+			i = j
+		default:
+			token := query[i : i+1]
+			for _, op := range fingerprintOperators {
+				if strings.HasPrefix(query[i:], op) {
+					token = op
+					break
+				}
+			}
+			add(token, i, i+len(token), false)
+			i += len(token)
+		}
+	}
+	for len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+// tokenTexts returns the normalized texts of tokens.
+func tokenTexts(tokens []fingerprintToken) []string {
+	result := make([]string, len(tokens))
+	for i, token := range tokens {
+		result[i] = token.text
+	}
+	return result
+}
+
+// redactLiterals replaces string and numeric literals of a query with "?" and removes comments, keeping the rest of
+// the query as-is.
+func redactLiterals(query string, flavor DbFlavor) string {
+	var sb strings.Builder
+	prev := 0
+	for _, token := range fingerprintTokens(query, flavor) {
+		if gap := query[prev:token.start]; strings.TrimSpace(gap) != "" {
+			sb.WriteByte(' ') // comments
+		} else {
+			sb.WriteString(gap)
+		}
+		if token.literal {
+			sb.WriteByte('?')
+		} else {
+			sb.WriteString(query[token.start:token.end])
+		}
+		prev = token.end
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// skipNumber returns the position following the numeric literal starting at query[i], e.g. 12, 1.5, .5, 1e-3 or 0xFF.
+func skipNumber(query string, i int) int {
+	n := len(query)
+	if strings.HasPrefix(query[i:], "0x") || strings.HasPrefix(query[i:], "0X") {
+		return skipWord(query, i+2)
+	}
+	for i < n && (isDigit(query[i]) || query[i] == '.') {
+		i++
+	}
+	if i < n && (query[i] == 'e' || query[i] == 'E') {
+		j := i + 1
+		if j < n && (query[j] == '+' || query[j] == '-') {
+			j++
+		}
+		if j < n && isDigit(query[j]) {
+			for i = j; i < n && isDigit(query[i]); i++ {
+			}
+		}
+	}
+	return i
+}
+
+// collapseInLists replaces lists of values following IN with a single "?+".
+func collapseInLists(tokens []string) []string {
+	result := make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		result = append(result, tokens[i])
+		if tokens[i] != "in" || i+2 >= len(tokens) || tokens[i+1] != "(" {
+			continue
+		}
+		j := i + 2
+		for j+1 < len(tokens) && tokens[j] == "?" && tokens[j+1] == "," {
+			j += 2
+		}
+		if j+1 < len(tokens) && tokens[j] == "?" && tokens[j+1] == ")" {
+			result = append(result, "(", "?+", ")")
+			i = j + 1
+		}
+	}
+	return result
+}
+
+// closingParen returns the position of the parenthesis closing the one at tokens[i], -1 if not found.
+func closingParen(tokens []string, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "(":
+			depth++
+		case ")":
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// collapseValuesRows removes rows of VALUES lists that are identical to the first row.
+func collapseValuesRows(tokens []string) []string {
+	result := make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		result = append(result, tokens[i])
+		if tokens[i] != "values" || i+1 >= len(tokens) || tokens[i+1] != "(" {
+			continue
+		}
+		end := closingParen(tokens, i+1)
+		if end < 0 {
+			continue
+		}
+		row := tokens[i+1 : end+1]
+		result = append(result, row...)
+		i = end
+		for i+1 < len(tokens) && tokens[i+1] == "," && equalTokens(tokens[i+2:], row) {
+			i += 1 + len(row)
+		}
+	}
+	return result
+}
+
+func equalTokens(tokens, prefix []string) bool {
+	if len(tokens) < len(prefix) {
+		return false
+	}
+	for i, token := range prefix {
+		if tokens[i] != token {
+			return false
+		}
+	}
+	return true
+}
+
+// fingerprintSpaced checks if two consecutive tokens are separated by a space in fingerprints.
+func fingerprintSpaced(prev, token string) bool {
+	switch {
+	case prev == "(" || prev == "." || prev == "::":
+		return false
+	case token == ")" || token == "," || token == "." || token == ";" || token == "::":
+		return false
+	}
+	return true
+}
+
+/*----------------------------------------------------------------------*/
+
+// FingerprintOpts configures tracking of query fingerprints, see SqlConnect.SetFingerprintOpts.
+//
+// @Available since <<VERSION>>
+type FingerprintOpts struct {
+	// Maximum number of tracked fingerprints, commands of further fingerprints are not tracked. Default value is 1000.
+	MaxFingerprints int
+}
+
+// FingerprintOrder specifies how SqlConnect.TopFingerprints sorts fingerprints.
+//
+// @Available since <<VERSION>>
+type FingerprintOrder int
+
+const (
+	// FingerprintByTotalCost sorts fingerprints by total execution cost, highest first.
+	FingerprintByTotalCost FingerprintOrder = iota
+
+	// FingerprintByP99Cost sorts fingerprints by p99 execution cost, highest first.
+	FingerprintByP99Cost
+
+	// FingerprintByErrors sorts fingerprints by number of failed (or rejected) commands, highest first.
+	FingerprintByErrors
+)
+
+// FingerprintStats is the snapshot of execution statistics of a query fingerprint.
+//
+// @Available since <<VERSION>>
+type FingerprintStats struct {
+	// Identifier of the fingerprint (see FingerprintId), its commands are logged under metrics category
+	// MetricsCatFingerprintPrefix + Id.
+	Id string `json:"id"`
+
+	// The normalized query, see Fingerprint.
+	Fingerprint string `json:"fingerprint"`
+
+	// Metrics category of the statement (e.g. prom.MetricsCatDQL).
+	Category string `json:"cat"`
+
+	// The first query seen with this fingerprint, with string and numeric literals replaced by "?" and comments
+	// removed so that inline values are not exposed (parameters are not included).
+	Example string `json:"example"`
+
+	// Total number of executed commands.
+	NumCmds int64 `json:"total"`
+
+	// Number of failed (or rejected) commands.
+	NumErrors int64 `json:"errors"`
+
+	// Total execution cost of all commands, in microseconds.
+	TotalCost float64 `json:"cost"`
+
+	// Mean execution cost, in microseconds.
+	MeanCost float64 `json:"avg"`
+
+	// p99 execution cost, in microseconds.
+	P99Cost float64 `json:"p99"`
+
+	// Timestamp of the latest command.
+	LastSeen time.Time `json:"tlast"`
+}
+
+type fingerprintEntry struct {
+	stats     FingerprintStats
+	histogram metrics.Histogram
+}
+
+// fingerprintStore aggregates command statistics per query fingerprint.
+type fingerprintStore struct {
+	maxFingerprints int
+	lock            sync.Mutex
+	entries         map[string]*fingerprintEntry // fingerprint id -> entry
+	queries         map[string]*fingerprintEntry // cache of fingerprinted queries
+}
+
+func newFingerprintStore(opts FingerprintOpts) *fingerprintStore {
+	if opts.MaxFingerprints <= 0 {
+		opts.MaxFingerprints = defaultMaxFingerprints
+	}
+	return &fingerprintStore{
+		maxFingerprints: opts.MaxFingerprints,
+		entries:         make(map[string]*fingerprintEntry),
+		queries:         make(map[string]*fingerprintEntry),
+	}
+}
+
+// put records a command, returning the id of the query's fingerprint, or empty string if the fingerprint is not tracked.
+func (s *fingerprintStore) put(flavor DbFlavor, category, query string, cmd *prom.CmdExecInfo) string {
+	s.lock.Lock()
+	e := s.queries[query]
+	s.lock.Unlock()
+	if e == nil {
+		fingerprint := Fingerprint(query, flavor)
+		id := FingerprintId(fingerprint)
+		s.lock.Lock()
+		if e = s.entries[id]; e == nil {
+			if len(s.entries) >= s.maxFingerprints {
+				s.lock.Unlock()
+				return ""
+			}
+			e = &fingerprintEntry{
+				stats:     FingerprintStats{Id: id, Fingerprint: fingerprint, Category: category, Example: redactLiterals(query, flavor)},
+				histogram: metrics.NewHistogram(metrics.NewExpDecaySample(fingerprintSampleSize, 0.015)),
+			}
+			s.entries[id] = e
+		}
+		if len(s.queries) >= 2*s.maxFingerprints {
+			s.queries = make(map[string]*fingerprintEntry)
+		}
+		s.queries[query] = e
+		s.lock.Unlock()
+	}
+
+	e.histogram.Update(int64(cmd.Cost))
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e.stats.NumCmds++
+	e.stats.TotalCost += cmd.Cost
+	if cmd.Result == prom.CmdResultError || cmd.Result == prom.CmdResultRejected {
+		e.stats.NumErrors++
+	}
+	if e.stats.LastSeen = cmd.EndTime; e.stats.LastSeen.IsZero() {
+		e.stats.LastSeen = time.Now()
+	}
+	return e.stats.Id
+}
+
+func (s *fingerprintStore) snapshot() []FingerprintStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	result := make([]FingerprintStats, 0, len(s.entries))
+	for _, e := range s.entries {
+		stats := e.stats
+		if stats.NumCmds > 0 {
+			stats.MeanCost = stats.TotalCost / float64(stats.NumCmds)
+		}
+		stats.P99Cost = e.histogram.Snapshot().Percentile(0.99)
+		result = append(result, stats)
+	}
+	return result
+}
+
+func (s *fingerprintStore) reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries = make(map[string]*fingerprintEntry)
+	s.queries = make(map[string]*fingerprintEntry)
+}
+
+// GetFingerprintOpts returns the options of query fingerprint tracking, nil if disabled.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) GetFingerprintOpts() *FingerprintOpts {
+	if sc.fingerprints == nil {
+		return nil
+	}
+	return &FingerprintOpts{MaxFingerprints: sc.fingerprints.maxFingerprints}
+}
+
+// SetFingerprintOpts enables tracking of query fingerprints (see Fingerprint) for exec/query calls via DBProxy,
+// ConnProxy and TxProxy: commands are also logged under metrics category MetricsCatFingerprintPrefix + fingerprint id,
+// and aggregated per fingerprint (see TopFingerprints). Set to nil to disable tracking and discard statistics.
+//
+// Note: fingerprint tracking should be enabled before the SqlConnect is shared between goroutines.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) SetFingerprintOpts(opts *FingerprintOpts) *SqlConnect {
+	if opts == nil {
+		sc.fingerprints = nil
+	} else {
+		sc.fingerprints = newFingerprintStore(*opts)
+	}
+	return sc
+}
+
+// TopFingerprints returns statistics of the top n query fingerprints sorted by the specified order (n <= 0 means
+// all fingerprints), or nil if fingerprint tracking is disabled.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) TopFingerprints(order FingerprintOrder, n int) []FingerprintStats {
+	if sc.fingerprints == nil {
+		return nil
+	}
+	result := sc.fingerprints.snapshot()
+	var key func(stats *FingerprintStats) float64
+	switch order {
+	case FingerprintByP99Cost:
+		key = func(stats *FingerprintStats) float64 { return stats.P99Cost }
+	case FingerprintByErrors:
+		key = func(stats *FingerprintStats) float64 { return float64(stats.NumErrors) }
+	default:
+		key = func(stats *FingerprintStats) float64 { return stats.TotalCost }
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if ki, kj := key(&result[i]), key(&result[j]); ki != kj {
+			return ki > kj
+		}
+		return result[i].Id < result[j].Id
+	})
+	if n > 0 && n < len(result) {
+		result = result[:n]
+	}
+	return result
+}
+
+// ResetFingerprints discards statistics of all query fingerprints. Metrics logged under fingerprint categories are
+// not affected.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) ResetFingerprints() {
+	if sc.fingerprints != nil {
+		sc.fingerprints.reset()
+	}
+}
@@ -3,18 +3,16 @@ package sql
 import (
 	"context"
 	"database/sql"
-	"regexp"
-	"strings"
 
 	"github.com/btnguyen2k/prom"
 )
 
 type m map[string]interface{}
 
-var firstWordRegEx = regexp.MustCompile(`^\s*(\w+)`)
-var sqlDMLCmds = m{"INSERT": true, "DELETE": true, "UPDATE": true, "UPSERT": true}
-var sqlDQLCmds = m{"SELECT": true}
-var sqlDDLCmds = m{"ALTER": true, "CREATE": true, "DROP": true}
+// newCmdExecInfo creates a new CmdExecInfo with labels carried by ctx (see prom.WithLabels) attached.
+func (sc *SqlConnect) newCmdExecInfo(ctx context.Context) *prom.CmdExecInfo {
+	return sc.NewCmdExecInfo().AttachLabels(ctx)
+}
 
 // DBProxy is a proxy that can be used as replacement for sql.DB.
 //
@@ -57,11 +55,8 @@ func (dbp *DBProxy) Ping() error {
 
 // PingContext overrides sql.DB/PingContext to log execution metrics.
 func (dbp *DBProxy) PingContext(ctx context.Context) error {
-	cmd := dbp.sqlc.NewCmdExecInfo()
-	defer func() {
-		_ = dbp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		_ = dbp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-	}()
+	cmd := dbp.sqlc.newCmdExecInfo(ctx)
+	defer dbp.sqlc.logOtherCmdMetrics(prom.MetricsCatOther, cmd)
 	cmd.CmdName = "ping"
 	err := dbp.DB.PingContext(ctx)
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
@@ -71,10 +66,7 @@ func (dbp *DBProxy) PingContext(ctx context.Context) error {
 // Close overrides sql.DB/Close to log execution metrics.
 func (dbp *DBProxy) Close() error {
 	cmd := dbp.sqlc.NewCmdExecInfo()
-	defer func() {
-		_ = dbp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		_ = dbp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-	}()
+	defer dbp.sqlc.putOtherCmdMetrics(prom.MetricsCatOther, cmd)
 	cmd.CmdName = "close"
 	err := dbp.DB.Close()
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
@@ -88,17 +80,37 @@ func (dbp *DBProxy) Prepare(query string) (*sql.Stmt, error) {
 
 // PrepareContext overrides sql.DB/PrepareContext to log execution metrics.
 func (dbp *DBProxy) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
-	cmd := dbp.sqlc.NewCmdExecInfo()
-	defer func() {
-		_ = dbp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		_ = dbp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-	}()
+	cmd := dbp.sqlc.newCmdExecInfo(ctx)
+	defer dbp.sqlc.logOtherCmdMetrics(prom.MetricsCatOther, cmd)
 	cmd.CmdName, cmd.CmdRequest = "prepare", m{"query": query}
 	result, err := dbp.DB.PrepareContext(ctx, query)
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
 	return result, err
 }
 
+// PrepareProxy is similar to sql.DB/Prepare, but returns a proxy that can be used as a replacement.
+//
+// See StmtProxy.
+//
+// @Available since <<VERSION>>
+func (dbp *DBProxy) PrepareProxy(query string) (*StmtProxy, error) {
+	return dbp.PrepareContextProxy(context.Background(), query)
+}
+
+// PrepareContextProxy is similar to sql.DB/PrepareContext, but returns a proxy that can be used as a replacement.
+//
+// Executions of the returned statement are guarded by the circuit breaker and retried the same way as DBProxy's
+// exec/query calls. See StmtProxy.
+//
+// @Available since <<VERSION>>
+func (dbp *DBProxy) PrepareContextProxy(ctx context.Context, query string) (*StmtProxy, error) {
+	stmt, err := dbp.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &StmtProxy{Stmt: stmt, sqlc: dbp.sqlc, query: query, retry: true}, nil
+}
+
 // Exec overrides sql.DB/Exec to log execution metrics.
 func (dbp *DBProxy) Exec(query string, args ...interface{}) (sql.Result, error) {
 	return dbp.ExecContext(context.Background(), query, args...)
@@ -106,28 +118,21 @@ func (dbp *DBProxy) Exec(query string, args ...interface{}) (sql.Result, error)
 
 // ExecContext overrides sql.DB.ExecContext to log execution metrics.
 func (dbp *DBProxy) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	cmd := dbp.sqlc.NewCmdExecInfo()
-	firstWord := strings.ToUpper(firstWordRegEx.FindString(query))
-	defer func() {
-		_ = dbp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		if v, ok := sqlDMLCmds[firstWord]; ok && v.(bool) {
-			_ = dbp.sqlc.LogMetrics(prom.MetricsCatDML, cmd)
-		} else if v, ok := sqlDMLCmds[firstWord]; ok && v.(bool) {
-			_ = dbp.sqlc.LogMetrics(prom.MetricsCatDDL, cmd)
-		} else if v, ok := sqlDDLCmds[firstWord]; ok && v.(bool) {
-			_ = dbp.sqlc.LogMetrics(prom.MetricsCatDDL, cmd)
-		} else {
-			_ = dbp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-		}
-	}()
-	cmd.CmdName, cmd.CmdRequest = firstWord, m{"query": query, "params": args}
-	result, err := dbp.DB.ExecContext(ctx, query, args...)
+	cmd := dbp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := classifyExec(query, dbp.sqlc.flavor)
+	defer dbp.sqlc.logCmdMetrics(category, query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, dbp.sqlc.cmdRequest(query, args)
+	var result sql.Result
+	err := dbp.sqlc.execWithRetry(ctx, category, cmd, func() (err error) {
+		result, err = dbp.DB.ExecContext(ctx, query, args...)
+		return err
+	})
 	if err == nil {
 		lastInsertId, _ := result.LastInsertId()
 		rowsAffected, _ := result.RowsAffected()
 		cmd.CmdResponse = m{"lastInsertId": lastInsertId, "rowsAffected": rowsAffected}
 	}
-	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
+	endCmd(cmd, err)
 	return result, err
 }
 
@@ -138,22 +143,45 @@ func (dbp *DBProxy) Query(query string, args ...interface{}) (*sql.Rows, error)
 
 // QueryContext overrides sql.DB/QueryContext to log execution metrics.
 func (dbp *DBProxy) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	cmd := dbp.sqlc.NewCmdExecInfo()
-	firstWord := strings.ToUpper(firstWordRegEx.FindString(query))
-	defer func() {
-		_ = dbp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		if v, ok := sqlDQLCmds[firstWord]; ok && v.(bool) {
-			_ = dbp.sqlc.LogMetrics(prom.MetricsCatDQL, cmd)
-		} else {
-			_ = dbp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-		}
-	}()
-	cmd.CmdName, cmd.CmdRequest = firstWord, m{"query": query, "params": args}
-	result, err := dbp.DB.QueryContext(ctx, query, args...)
-	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
+	cmd := dbp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(query, dbp.sqlc.flavor)
+	defer dbp.sqlc.logCmdMetrics(category, query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, dbp.sqlc.cmdRequest(query, args)
+	var result *sql.Rows
+	err := dbp.sqlc.execWithRetry(ctx, category, cmd, func() (err error) {
+		result, err = dbp.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	endCmd(cmd, err)
 	return result, err
 }
 
+// QueryProxy is similar to sql.DB/Query, but returns a proxy that can be used as a replacement.
+//
+// See RowsProxy.
+//
+// @Available since <<VERSION>>
+func (dbp *DBProxy) QueryProxy(query string, args ...interface{}) (*RowsProxy, error) {
+	return dbp.QueryContextProxy(context.Background(), query, args...)
+}
+
+// QueryContextProxy is similar to sql.DB/QueryContext, but returns a proxy that can be used as a replacement.
+//
+// See RowsProxy.
+//
+// @Available since <<VERSION>>
+func (dbp *DBProxy) QueryContextProxy(ctx context.Context, query string, args ...interface{}) (*RowsProxy, error) {
+	cmd := dbp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(query, dbp.sqlc.flavor)
+	cmd.CmdName, cmd.CmdRequest = cmdName, dbp.sqlc.cmdRequest(query, args)
+	var rows *sql.Rows
+	err := dbp.sqlc.execWithRetry(ctx, category, cmd, func() (err error) {
+		rows, err = dbp.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	return dbp.sqlc.queryProxy(category, query, cmd, rows, err)
+}
+
 // QueryRow overrides sql.DB/QueryRow to log execution metrics.
 func (dbp *DBProxy) QueryRow(query string, args ...interface{}) *sql.Row {
 	return dbp.QueryRowContext(context.Background(), query, args...)
@@ -161,17 +189,10 @@ func (dbp *DBProxy) QueryRow(query string, args ...interface{}) *sql.Row {
 
 // QueryRowContext overrides sql.DB/QueryRowContext to log execution metrics.
 func (dbp *DBProxy) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	cmd := dbp.sqlc.NewCmdExecInfo()
-	firstWord := strings.ToUpper(firstWordRegEx.FindString(query))
-	defer func() {
-		_ = dbp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		if v, ok := sqlDQLCmds[firstWord]; ok && v.(bool) {
-			_ = dbp.sqlc.LogMetrics(prom.MetricsCatDQL, cmd)
-		} else {
-			_ = dbp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-		}
-	}()
-	cmd.CmdName, cmd.CmdRequest = firstWord, m{"query": query, "params": args}
+	cmd := dbp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(query, dbp.sqlc.flavor)
+	defer dbp.sqlc.logCmdMetrics(category, query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, dbp.sqlc.cmdRequest(query, args)
 	result := dbp.DB.QueryRowContext(ctx, query, args...)
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, result.Err())
 	return result
@@ -199,11 +220,8 @@ func (cp *ConnProxy) BeginTxProxy(ctx context.Context, opts *sql.TxOptions) (*Tx
 
 // PingContext overrides sql.Conn/PingContext to log execution metrics.
 func (cp *ConnProxy) PingContext(ctx context.Context) error {
-	cmd := cp.sqlc.NewCmdExecInfo()
-	defer func() {
-		_ = cp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		_ = cp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-	}()
+	cmd := cp.sqlc.newCmdExecInfo(ctx)
+	defer cp.sqlc.logOtherCmdMetrics(prom.MetricsCatOther, cmd)
 	cmd.CmdName = "ping"
 	err := cp.Conn.PingContext(ctx)
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
@@ -213,10 +231,7 @@ func (cp *ConnProxy) PingContext(ctx context.Context) error {
 // Close overrides sql.Conn/Close to log execution metrics.
 func (cp *ConnProxy) Close() error {
 	cmd := cp.sqlc.NewCmdExecInfo()
-	defer func() {
-		_ = cp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		_ = cp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-	}()
+	defer cp.sqlc.putOtherCmdMetrics(prom.MetricsCatOther, cmd)
 	cmd.CmdName = "close"
 	err := cp.Conn.Close()
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
@@ -225,32 +240,40 @@ func (cp *ConnProxy) Close() error {
 
 // PrepareContext overrides sql.Conn/PrepareContext to log execution metrics.
 func (cp *ConnProxy) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
-	cmd := cp.sqlc.NewCmdExecInfo()
-	defer func() {
-		_ = cp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		_ = cp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-	}()
+	cmd := cp.sqlc.newCmdExecInfo(ctx)
+	defer cp.sqlc.logOtherCmdMetrics(prom.MetricsCatOther, cmd)
 	cmd.CmdName, cmd.CmdRequest = "prepare", m{"query": query}
 	result, err := cp.Conn.PrepareContext(ctx, query)
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
 	return result, err
 }
 
+// PrepareProxy is similar to PrepareContextProxy, using context.Background().
+//
+// @Available since <<VERSION>>
+func (cp *ConnProxy) PrepareProxy(query string) (*StmtProxy, error) {
+	return cp.PrepareContextProxy(context.Background(), query)
+}
+
+// PrepareContextProxy is similar to sql.Conn/PrepareContext, but returns a proxy that can be used as a replacement.
+//
+// See StmtProxy.
+//
+// @Available since <<VERSION>>
+func (cp *ConnProxy) PrepareContextProxy(ctx context.Context, query string) (*StmtProxy, error) {
+	stmt, err := cp.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &StmtProxy{Stmt: stmt, sqlc: cp.sqlc, query: query}, nil
+}
+
 // ExecContext overrides sql.Conn/ExecContext to log execution metrics.
 func (cp *ConnProxy) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	cmd := cp.sqlc.NewCmdExecInfo()
-	firstWord := strings.ToUpper(firstWordRegEx.FindString(query))
-	defer func() {
-		_ = cp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		if v, ok := sqlDMLCmds[firstWord]; ok && v.(bool) {
-			_ = cp.sqlc.LogMetrics(prom.MetricsCatDML, cmd)
-		} else if v, ok := sqlDDLCmds[firstWord]; ok && v.(bool) {
-			_ = cp.sqlc.LogMetrics(prom.MetricsCatDDL, cmd)
-		} else {
-			_ = cp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-		}
-	}()
-	cmd.CmdName, cmd.CmdRequest = firstWord, m{"query": query, "params": args}
+	cmd := cp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := classifyExec(query, cp.sqlc.flavor)
+	defer cp.sqlc.logCmdMetrics(category, query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, cp.sqlc.cmdRequest(query, args)
 	result, err := cp.Conn.ExecContext(ctx, query, args...)
 	if err == nil {
 		lastInsertId, _ := result.LastInsertId()
@@ -263,35 +286,34 @@ func (cp *ConnProxy) ExecContext(ctx context.Context, query string, args ...inte
 
 // QueryContext overrides sql.Conn/QueryContext to log execution metrics.
 func (cp *ConnProxy) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	cmd := cp.sqlc.NewCmdExecInfo()
-	firstWord := strings.ToUpper(firstWordRegEx.FindString(query))
-	defer func() {
-		_ = cp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		if v, ok := sqlDQLCmds[firstWord]; ok && v.(bool) {
-			_ = cp.sqlc.LogMetrics(prom.MetricsCatDQL, cmd)
-		} else {
-			_ = cp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-		}
-	}()
-	cmd.CmdName, cmd.CmdRequest = firstWord, m{"query": query, "params": args}
+	cmd := cp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(query, cp.sqlc.flavor)
+	defer cp.sqlc.logCmdMetrics(category, query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, cp.sqlc.cmdRequest(query, args)
 	result, err := cp.Conn.QueryContext(ctx, query, args...)
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
 	return result, err
 }
 
+// QueryContextProxy is similar to sql.Conn/QueryContext, but returns a proxy that can be used as a replacement.
+//
+// See RowsProxy.
+//
+// @Available since <<VERSION>>
+func (cp *ConnProxy) QueryContextProxy(ctx context.Context, query string, args ...interface{}) (*RowsProxy, error) {
+	cmd := cp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(query, cp.sqlc.flavor)
+	cmd.CmdName, cmd.CmdRequest = cmdName, cp.sqlc.cmdRequest(query, args)
+	rows, err := cp.Conn.QueryContext(ctx, query, args...)
+	return cp.sqlc.queryProxy(category, query, cmd, rows, err)
+}
+
 // QueryRowContext overrides sql.Conn/QueryRowContext to log execution metrics.
 func (cp *ConnProxy) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	cmd := cp.sqlc.NewCmdExecInfo()
-	firstWord := strings.ToUpper(firstWordRegEx.FindString(query))
-	defer func() {
-		_ = cp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		if v, ok := sqlDQLCmds[firstWord]; ok && v.(bool) {
-			_ = cp.sqlc.LogMetrics(prom.MetricsCatDQL, cmd)
-		} else {
-			_ = cp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-		}
-	}()
-	cmd.CmdName, cmd.CmdRequest = firstWord, m{"query": query, "params": args}
+	cmd := cp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(query, cp.sqlc.flavor)
+	defer cp.sqlc.logCmdMetrics(category, query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, cp.sqlc.cmdRequest(query, args)
 	result := cp.Conn.QueryRowContext(ctx, query, args...)
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, result.Err())
 	return result
@@ -312,10 +334,7 @@ type TxProxy struct {
 // Commit overrides sql.Tx/Commit to log execution metrics.
 func (tp *TxProxy) Commit() error {
 	cmd := tp.sqlc.NewCmdExecInfo()
-	defer func() {
-		_ = tp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		_ = tp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-	}()
+	defer tp.sqlc.logOtherCmdMetrics(prom.MetricsCatTCL, cmd)
 	cmd.CmdName = "commit"
 	err := tp.Tx.Commit()
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
@@ -325,10 +344,7 @@ func (tp *TxProxy) Commit() error {
 // Rollback overrides sql.Tx/Rollback to log execution metrics.
 func (tp *TxProxy) Rollback() error {
 	cmd := tp.sqlc.NewCmdExecInfo()
-	defer func() {
-		_ = tp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		_ = tp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-	}()
+	defer tp.sqlc.logOtherCmdMetrics(prom.MetricsCatTCL, cmd)
 	cmd.CmdName = "rollback"
 	err := tp.Tx.Rollback()
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
@@ -342,17 +358,51 @@ func (tp *TxProxy) Prepare(query string) (*sql.Stmt, error) {
 
 // PrepareContext overrides sql.Tx/PrepareContext to log execution metrics.
 func (tp *TxProxy) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
-	cmd := tp.sqlc.NewCmdExecInfo()
-	defer func() {
-		_ = tp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		_ = tp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-	}()
+	cmd := tp.sqlc.newCmdExecInfo(ctx)
+	defer tp.sqlc.logOtherCmdMetrics(prom.MetricsCatOther, cmd)
 	cmd.CmdName, cmd.CmdRequest = "prepare", m{"query": query}
 	result, err := tp.Tx.PrepareContext(ctx, query)
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
 	return result, err
 }
 
+// PrepareProxy is similar to sql.Tx/Prepare, but returns a proxy that can be used as a replacement.
+//
+// See StmtProxy.
+//
+// @Available since <<VERSION>>
+func (tp *TxProxy) PrepareProxy(query string) (*StmtProxy, error) {
+	return tp.PrepareContextProxy(context.Background(), query)
+}
+
+// PrepareContextProxy is similar to sql.Tx/PrepareContext, but returns a proxy that can be used as a replacement.
+//
+// See StmtProxy.
+//
+// @Available since <<VERSION>>
+func (tp *TxProxy) PrepareContextProxy(ctx context.Context, query string) (*StmtProxy, error) {
+	stmt, err := tp.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &StmtProxy{Stmt: stmt, sqlc: tp.sqlc, query: query}, nil
+}
+
+// StmtProxy is similar to sql.Tx/Stmt, but takes and returns proxies: the returned statement is a
+// transaction-specific statement of an existing one (e.g. prepared via DBProxy.PrepareProxy).
+//
+// @Available since <<VERSION>>
+func (tp *TxProxy) StmtProxy(stmt *StmtProxy) *StmtProxy {
+	return tp.StmtContextProxy(context.Background(), stmt)
+}
+
+// StmtContextProxy is similar to sql.Tx/StmtContext, but takes and returns proxies, see StmtProxy.
+//
+// @Available since <<VERSION>>
+func (tp *TxProxy) StmtContextProxy(ctx context.Context, stmt *StmtProxy) *StmtProxy {
+	return &StmtProxy{Stmt: tp.Tx.StmtContext(ctx, stmt.Stmt), sqlc: tp.sqlc, query: stmt.query}
+}
+
 // Exec overrides sql.Tx/Exec to log execution metrics.
 func (tp *TxProxy) Exec(query string, args ...interface{}) (sql.Result, error) {
 	return tp.ExecContext(context.Background(), query, args...)
@@ -360,19 +410,10 @@ func (tp *TxProxy) Exec(query string, args ...interface{}) (sql.Result, error) {
 
 // ExecContext overrides sql.Tx/ExecContext to log execution metrics.
 func (tp *TxProxy) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	cmd := tp.sqlc.NewCmdExecInfo()
-	firstWord := strings.ToUpper(firstWordRegEx.FindString(query))
-	defer func() {
-		_ = tp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		if v, ok := sqlDMLCmds[firstWord]; ok && v.(bool) {
-			_ = tp.sqlc.LogMetrics(prom.MetricsCatDML, cmd)
-		} else if v, ok := sqlDDLCmds[firstWord]; ok && v.(bool) {
-			_ = tp.sqlc.LogMetrics(prom.MetricsCatDDL, cmd)
-		} else {
-			_ = tp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-		}
-	}()
-	cmd.CmdName, cmd.CmdRequest = firstWord, m{"query": query, "params": args}
+	cmd := tp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := classifyExec(query, tp.sqlc.flavor)
+	defer tp.sqlc.logCmdMetrics(category, query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, tp.sqlc.cmdRequest(query, args)
 	result, err := tp.Tx.ExecContext(ctx, query, args...)
 	if err == nil {
 		lastInsertId, _ := result.LastInsertId()
@@ -390,22 +431,37 @@ func (tp *TxProxy) Query(query string, args ...interface{}) (*sql.Rows, error) {
 
 // QueryContext overrides sql.Tx/QueryContext to log execution metrics.
 func (tp *TxProxy) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	cmd := tp.sqlc.NewCmdExecInfo()
-	firstWord := strings.ToUpper(firstWordRegEx.FindString(query))
-	defer func() {
-		_ = tp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		if v, ok := sqlDQLCmds[firstWord]; ok && v.(bool) {
-			_ = tp.sqlc.LogMetrics(prom.MetricsCatDQL, cmd)
-		} else {
-			_ = tp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-		}
-	}()
-	cmd.CmdName, cmd.CmdRequest = firstWord, m{"query": query, "params": args}
+	cmd := tp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(query, tp.sqlc.flavor)
+	defer tp.sqlc.logCmdMetrics(category, query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, tp.sqlc.cmdRequest(query, args)
 	result, err := tp.Tx.QueryContext(ctx, query, args...)
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
 	return result, err
 }
 
+// QueryProxy is similar to sql.Tx/Query, but returns a proxy that can be used as a replacement.
+//
+// See RowsProxy.
+//
+// @Available since <<VERSION>>
+func (tp *TxProxy) QueryProxy(query string, args ...interface{}) (*RowsProxy, error) {
+	return tp.QueryContextProxy(context.Background(), query, args...)
+}
+
+// QueryContextProxy is similar to sql.Tx/QueryContext, but returns a proxy that can be used as a replacement.
+//
+// See RowsProxy.
+//
+// @Available since <<VERSION>>
+func (tp *TxProxy) QueryContextProxy(ctx context.Context, query string, args ...interface{}) (*RowsProxy, error) {
+	cmd := tp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(query, tp.sqlc.flavor)
+	cmd.CmdName, cmd.CmdRequest = cmdName, tp.sqlc.cmdRequest(query, args)
+	rows, err := tp.Tx.QueryContext(ctx, query, args...)
+	return tp.sqlc.queryProxy(category, query, cmd, rows, err)
+}
+
 // QueryRow overrides sql.Tx/QueryRow to log execution metrics.
 func (tp *TxProxy) QueryRow(query string, args ...interface{}) *sql.Row {
 	return tp.QueryRowContext(context.Background(), query, args...)
@@ -413,18 +469,153 @@ func (tp *TxProxy) QueryRow(query string, args ...interface{}) *sql.Row {
 
 // QueryRowContext overrides sql.Tx/QueryRowContext to log execution metrics.
 func (tp *TxProxy) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	cmd := tp.sqlc.NewCmdExecInfo()
-	firstWord := strings.ToUpper(firstWordRegEx.FindString(query))
-	defer func() {
-		_ = tp.sqlc.LogMetrics(prom.MetricsCatAll, cmd)
-		if v, ok := sqlDQLCmds[firstWord]; ok && v.(bool) {
-			_ = tp.sqlc.LogMetrics(prom.MetricsCatDQL, cmd)
-		} else {
-			_ = tp.sqlc.LogMetrics(prom.MetricsCatOther, cmd)
-		}
-	}()
-	cmd.CmdName, cmd.CmdRequest = firstWord, m{"query": query, "params": args}
+	cmd := tp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(query, tp.sqlc.flavor)
+	defer tp.sqlc.logCmdMetrics(category, query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, tp.sqlc.cmdRequest(query, args)
 	result := tp.Tx.QueryRowContext(ctx, query, args...)
 	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, result.Err())
 	return result
 }
+
+/*----------------------------------------------------------------------*/
+
+// StmtProxy is a proxy that can be used as replacement for sql.Stmt.
+//
+// This proxy overrides some functions from sql.Stmt and automatically logs the execution metrics: each execution is
+// logged with the statement's query, its parameters and category, the same way as DBProxy's exec/query calls.
+//
+// @Available since <<VERSION>>
+type StmtProxy struct {
+	*sql.Stmt
+	sqlc  *SqlConnect
+	query string
+	retry bool // true if executions are guarded by the circuit breaker and retried (statements prepared via DBProxy)
+}
+
+// execute runs a command of the statement, via SqlConnect.execWithRetry if the statement was prepared via DBProxy.
+func (sp *StmtProxy) execute(ctx context.Context, category string, cmd *prom.CmdExecInfo, fn func() error) error {
+	if sp.retry {
+		return sp.sqlc.execWithRetry(ctx, category, cmd, fn)
+	}
+	return fn()
+}
+
+// Exec overrides sql.Stmt/Exec to log execution metrics.
+func (sp *StmtProxy) Exec(args ...interface{}) (sql.Result, error) {
+	return sp.ExecContext(context.Background(), args...)
+}
+
+// ExecContext overrides sql.Stmt/ExecContext to log execution metrics.
+func (sp *StmtProxy) ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
+	cmd := sp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := classifyExec(sp.query, sp.sqlc.flavor)
+	defer sp.sqlc.logCmdMetrics(category, sp.query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, sp.sqlc.cmdRequest(sp.query, args)
+	var result sql.Result
+	err := sp.execute(ctx, category, cmd, func() (err error) {
+		result, err = sp.Stmt.ExecContext(ctx, args...)
+		return err
+	})
+	if err == nil {
+		lastInsertId, _ := result.LastInsertId()
+		rowsAffected, _ := result.RowsAffected()
+		cmd.CmdResponse = m{"lastInsertId": lastInsertId, "rowsAffected": rowsAffected}
+	}
+	endCmd(cmd, err)
+	return result, err
+}
+
+// Query overrides sql.Stmt/Query to log execution metrics.
+func (sp *StmtProxy) Query(args ...interface{}) (*sql.Rows, error) {
+	return sp.QueryContext(context.Background(), args...)
+}
+
+// QueryContext overrides sql.Stmt/QueryContext to log execution metrics.
+func (sp *StmtProxy) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
+	cmd := sp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(sp.query, sp.sqlc.flavor)
+	defer sp.sqlc.logCmdMetrics(category, sp.query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, sp.sqlc.cmdRequest(sp.query, args)
+	var result *sql.Rows
+	err := sp.execute(ctx, category, cmd, func() (err error) {
+		result, err = sp.Stmt.QueryContext(ctx, args...)
+		return err
+	})
+	endCmd(cmd, err)
+	return result, err
+}
+
+// QueryProxy is similar to sql.Stmt/Query, but returns a proxy that can be used as a replacement.
+//
+// See RowsProxy.
+func (sp *StmtProxy) QueryProxy(args ...interface{}) (*RowsProxy, error) {
+	return sp.QueryContextProxy(context.Background(), args...)
+}
+
+// QueryContextProxy is similar to sql.Stmt/QueryContext, but returns a proxy that can be used as a replacement.
+//
+// See RowsProxy.
+func (sp *StmtProxy) QueryContextProxy(ctx context.Context, args ...interface{}) (*RowsProxy, error) {
+	cmd := sp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(sp.query, sp.sqlc.flavor)
+	cmd.CmdName, cmd.CmdRequest = cmdName, sp.sqlc.cmdRequest(sp.query, args)
+	var rows *sql.Rows
+	err := sp.execute(ctx, category, cmd, func() (err error) {
+		rows, err = sp.Stmt.QueryContext(ctx, args...)
+		return err
+	})
+	return sp.sqlc.queryProxy(category, sp.query, cmd, rows, err)
+}
+
+// QueryRow overrides sql.Stmt/QueryRow to log execution metrics.
+func (sp *StmtProxy) QueryRow(args ...interface{}) *sql.Row {
+	return sp.QueryRowContext(context.Background(), args...)
+}
+
+// QueryRowContext overrides sql.Stmt/QueryRowContext to log execution metrics.
+func (sp *StmtProxy) QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row {
+	cmd := sp.sqlc.newCmdExecInfo(ctx)
+	cmdName, category := ClassifyStatement(sp.query, sp.sqlc.flavor)
+	defer sp.sqlc.logCmdMetrics(category, sp.query, cmd)
+	cmd.CmdName, cmd.CmdRequest = cmdName, sp.sqlc.cmdRequest(sp.query, args)
+	result := sp.Stmt.QueryRowContext(ctx, args...)
+	cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, result.Err())
+	return result
+}
+
+/*----------------------------------------------------------------------*/
+
+// logCmdMetrics logs a command executed via a proxy, see putCmdMetrics. Commands are not logged if the driver is
+// instrumented (the driver records them), except commands rejected by the circuit breaker, which never reach the driver.
+func (sc *SqlConnect) logCmdMetrics(category, query string, cmd *prom.CmdExecInfo) {
+	if !sc.driverInstrumented || cmd.Result == prom.CmdResultRejected {
+		sc.putCmdMetrics(category, query, cmd)
+	}
+}
+
+// logOtherCmdMetrics logs a command (e.g. ping or commit) executed via a proxy, see logCmdMetrics and putOtherCmdMetrics.
+func (sc *SqlConnect) logOtherCmdMetrics(category string, cmd *prom.CmdExecInfo) {
+	if !sc.driverInstrumented || cmd.Result == prom.CmdResultRejected {
+		sc.putOtherCmdMetrics(category, cmd)
+	}
+}
+
+// putOtherCmdMetrics logs a command not executing a query (e.g. ping or commit) to category prom.MetricsCatAll and
+// the specified category (e.g. prom.MetricsCatTCL for commit and rollback, prom.MetricsCatOther for ping).
+func (sc *SqlConnect) putOtherCmdMetrics(category string, cmd *prom.CmdExecInfo) {
+	_ = sc.LogMetrics(prom.MetricsCatAll, cmd)
+	_ = sc.LogMetrics(category, cmd)
+}
+
+// putCmdMetrics logs a command executing a query to category prom.MetricsCatAll, the specified category and the
+// category of the query's fingerprint (if tracked).
+func (sc *SqlConnect) putCmdMetrics(category, query string, cmd *prom.CmdExecInfo) {
+	_ = sc.LogMetrics(prom.MetricsCatAll, cmd)
+	_ = sc.LogMetrics(category, cmd)
+	if sc.fingerprints != nil {
+		if id := sc.fingerprints.put(sc.flavor, category, query, cmd); id != "" {
+			_ = sc.LogMetrics(MetricsCatFingerprintPrefix+id, cmd)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package sql
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+// RedactAction specifies how a query parameter is redacted.
+//
+// @Available since <<VERSION>>
+type RedactAction int
+
+const (
+	// RedactMask replaces the parameter's value with RedactPolicy.Mask.
+	RedactMask RedactAction = iota
+
+	// RedactHash replaces the parameter's value with a hash of the value, so that equal values can still be
+	// correlated without being revealed.
+	RedactHash
+)
+
+// DefaultRedactMask is the default replacement of masked parameter values.
+//
+// @Available since <<VERSION>>
+const DefaultRedactMask = "***"
+
+// RedactRule selects query parameters to redact.
+//
+// @Available since <<VERSION>>
+type RedactRule struct {
+	// The rule applies only to queries matching this pattern. If nil, the rule applies to all queries.
+	QueryPattern *regexp.Regexp
+
+	// Positions (0-based) of parameters to redact. If both Positions and Names are empty, all parameters are redacted.
+	Positions []int
+
+	// Names of named parameters (sql.NamedArg) to redact.
+	Names []string
+
+	// How selected parameters are redacted. Default value is RedactMask.
+	Action RedactAction
+}
+
+// RedactPolicy specifies how query parameters are redacted before commands are logged to the metrics logger, so that
+// sensitive data (e.g. passwords, tokens or personal data) does not end up in memory or in exporters.
+//
+// Rules are evaluated in order, the first rule selecting a parameter decides how it is redacted. Values of remaining
+// parameters are truncated if longer than MaxValueLength.
+//
+// Redaction applies to CmdExecInfo.CmdRequest only, parameters passed to the database are not modified.
+//
+// @Available since <<VERSION>>
+type RedactPolicy struct {
+	// If true, all parameters of all queries are masked, other settings are ignored.
+	MaskAll bool
+
+	// Rules selecting parameters to redact.
+	Rules []RedactRule
+
+	// String and []byte values longer than this value are truncated. Set to zero or negative value to disable.
+	// Truncated values are suffixed with their original length, e.g. "abc...(16 chars)"; truncated []byte values are
+	// hex-encoded, e.g. "616263...(16 bytes)".
+	MaxValueLength int
+
+	// Replacement of masked values. Default value is DefaultRedactMask.
+	Mask string
+
+	// Salt prepended to values before hashing, to make hashes harder to reverse with dictionaries.
+	HashSalt string
+}
+
+func (p *RedactPolicy) mask() string {
+	if p.Mask == "" {
+		return DefaultRedactMask
+	}
+	return p.Mask
+}
+
+// Redact returns a redacted copy of the parameters of a query. The input slice is not modified.
+func (p *RedactPolicy) Redact(query string, params []interface{}) []interface{} {
+	if p == nil || len(params) == 0 {
+		return params
+	}
+	result := make([]interface{}, len(params))
+	matched := make([]*RedactRule, 0, len(p.Rules))
+	if !p.MaskAll {
+		for i := range p.Rules {
+			if p.Rules[i].QueryPattern == nil || p.Rules[i].QueryPattern.MatchString(query) {
+				matched = append(matched, &p.Rules[i])
+			}
+		}
+	}
+	for i, param := range params {
+		named, isNamed := param.(sql.NamedArg)
+		value := param
+		if isNamed {
+			value = named.Value
+		}
+		if p.MaskAll {
+			value = p.mask()
+		} else if rule := selectRedactRule(matched, i, named.Name); rule != nil {
+			value = p.redactValue(rule.Action, value)
+		} else {
+			value = p.truncateValue(value)
+		}
+		if isNamed {
+			named.Value = value
+			result[i] = named
+		} else {
+			result[i] = value
+		}
+	}
+	return result
+}
+
+func selectRedactRule(rules []*RedactRule, pos int, name string) *RedactRule {
+	for _, rule := range rules {
+		if len(rule.Positions) == 0 && len(rule.Names) == 0 {
+			return rule
+		}
+		for _, p := range rule.Positions {
+			if p == pos {
+				return rule
+			}
+		}
+		if name != "" {
+			for _, n := range rule.Names {
+				if n == name {
+					return rule
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *RedactPolicy) redactValue(action RedactAction, value interface{}) interface{} {
+	if action == RedactHash {
+		return p.hashValue(value)
+	}
+	return p.mask()
+}
+
+// hashValue returns "sha256:" followed by the first 16 hex digits of the SHA-256 hash of the salted value.
+func (p *RedactPolicy) hashValue(value interface{}) string {
+	h := sha256.New()
+	h.Write([]byte(p.HashSalt))
+	switch v := value.(type) {
+	case nil:
+		h.Write([]byte("<nil>"))
+	case []byte:
+		h.Write(v)
+	default:
+		_, _ = fmt.Fprint(h, v)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func (p *RedactPolicy) truncateValue(value interface{}) interface{} {
+	n := p.MaxValueLength
+	if n <= 0 {
+		return value
+	}
+	switch v := value.(type) {
+	case string:
+		if utf8.RuneCountInString(v) > n {
+			runes := []rune(v)
+			return string(runes[:n]) + "...(" + strconv.Itoa(len(runes)) + " chars)"
+		}
+	case []byte:
+		if len(v) > n {
+			return hex.EncodeToString(v[:n]) + "...(" + strconv.Itoa(len(v)) + " bytes)"
+		}
+	}
+	return value
+}
+
+// GetRedactPolicy returns the policy used to redact query parameters before commands are logged, nil if none.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) GetRedactPolicy() *RedactPolicy {
+	return sc.redactPolicy
+}
+
+// SetRedactPolicy sets the policy used to redact query parameters before commands are logged. Set to nil to log
+// parameters as-is.
+//
+// Note: the policy should not be modified after being set.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) SetRedactPolicy(policy *RedactPolicy) *SqlConnect {
+	sc.redactPolicy = policy
+	return sc
+}
+
+// cmdRequest builds the CmdExecInfo.CmdRequest of a query, redacting its parameters according to the redact policy.
+func (sc *SqlConnect) cmdRequest(query string, args []interface{}) m {
+	return m{"query": query, "params": sc.redactPolicy.Redact(query, args)}
+}
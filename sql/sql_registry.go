@@ -0,0 +1,118 @@
+package sql
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/btnguyen2k/prom"
+)
+
+// RegistryConnType is the connection type SqlConnect is built from in prom.Registry configuration.
+//
+// @Available since <<VERSION>>
+const RegistryConnType = "sql"
+
+func init() {
+	prom.RegisterConnectionFactory(RegistryConnType, newRegistryConnection)
+}
+
+// RegistryConfig is the connection type specific configuration (the "config" field of
+// prom.RegistryConnectionConfig) to build SqlConnect, e.g.
+//
+//	{"driver": "pgx", "dsn": "postgres://...", "timeout_ms": 10000, "flavor": "postgresql", "timezone": "Asia/Ho_Chi_Minh"}
+//
+// @Available since <<VERSION>>
+type RegistryConfig struct {
+	// Database driver name, required.
+	Driver string `json:"driver"`
+
+	// Data source name, required.
+	Dsn string `json:"dsn"`
+
+	// Default timeout for db operations, in milliseconds.
+	TimeoutMs int `json:"timeout_ms"`
+
+	// Database flavor, see DbFlavorFromString for accepted values.
+	Flavor string `json:"flavor"`
+
+	// Timezone location to parse date/time data, e.g. "UTC" or "Asia/Ho_Chi_Minh". Default value is UTC.
+	Timezone string `json:"timezone"`
+
+	// If true, commands are recorded at driver level, see SqlConnect.InstrumentDriver (since <<VERSION>>).
+	InstrumentDriver bool `json:"instrument_driver"`
+}
+
+// RegistryConnection adapts SqlConnect to prom.IBaseConnection so that it can be registered with prom.Registry.
+//
+// @Available since <<VERSION>>
+type RegistryConnection struct {
+	*SqlConnect
+}
+
+// PoolOpts implements prom.IBaseConnection.PoolOpts.
+func (c RegistryConnection) PoolOpts() prom.IBasePoolOpts {
+	return c.BaseConnection.PoolOpts()
+}
+
+// RegisterMetricsLogger implements prom.IBaseConnection.RegisterMetricsLogger.
+func (c RegistryConnection) RegisterMetricsLogger(logger prom.IMetricsLogger) prom.IBaseConnection {
+	c.BaseConnection.RegisterMetricsLogger(logger)
+	return c
+}
+
+// RegisterWithRegistry registers a SqlConnect with a prom.Registry under a name.
+//
+// @Available since <<VERSION>>
+func RegisterWithRegistry(r *prom.Registry, name string, sc *SqlConnect) error {
+	if sc == nil {
+		return errors.New("nil SqlConnect")
+	}
+	return r.Register(name, RegistryConnection{SqlConnect: sc})
+}
+
+// GetFromRegistry returns the SqlConnect registered with a prom.Registry under a name, nil if not found or if the
+// connection is not a SqlConnect.
+//
+// @Available since <<VERSION>>
+func GetFromRegistry(r *prom.Registry, name string) *SqlConnect {
+	if c, ok := prom.RegistryGet[RegistryConnection](r, name); ok {
+		return c.SqlConnect
+	}
+	return nil
+}
+
+func newRegistryConnection(_ string, poolOpts *prom.BasePoolOpts, config json.RawMessage) (prom.IBaseConnection, error) {
+	conf := RegistryConfig{}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &conf); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Driver == "" || conf.Dsn == "" {
+		return nil, errors.New("driver and dsn are required")
+	}
+	var sqlPoolOpts *PoolOpts
+	if poolOpts != nil {
+		sqlPoolOpts = &PoolOpts{BasePoolOpts: *poolOpts}
+	}
+	sc, err := NewSqlConnectWithFlavor(conf.Driver, conf.Dsn, conf.TimeoutMs, sqlPoolOpts, DbFlavorFromString(conf.Flavor))
+	if err != nil {
+		return nil, err
+	}
+	if conf.Timezone != "" {
+		loc, err := time.LoadLocation(conf.Timezone)
+		if err != nil {
+			_ = sc.Close()
+			return nil, err
+		}
+		sc.SetLocation(loc)
+	}
+	if conf.InstrumentDriver {
+		if err := sc.InstrumentDriver(true); err != nil {
+			_ = sc.Close()
+			return nil, err
+		}
+	}
+	return RegistryConnection{SqlConnect: sc}, nil
+}
@@ -0,0 +1,299 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/btnguyen2k/prom"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 50 * time.Millisecond
+	defaultRetryMaxBackoff     = 2 * time.Second
+	defaultRetryMultiplier     = 2.0
+	defaultRetryJitter         = 0.2
+)
+
+// RetryPolicy specifies how DBProxy's exec/query calls failing with transient errors (e.g. deadlocks, serialization
+// failures or busy databases) are retried, with exponential backoff and jitter.
+//
+// Zero-value fields take default values, see each field for details.
+//
+// @Available since <<VERSION>>
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one. Default value is 3.
+	MaxAttempts int
+
+	// Delay before the second attempt. Default value is 50ms.
+	InitialBackoff time.Duration
+
+	// Maximum delay between two attempts. Default value is 2s.
+	MaxBackoff time.Duration
+
+	// Factor the delay is multiplied by after each attempt. Default value is 2.0.
+	Multiplier float64
+
+	// Randomization factor (0.0-1.0) of delays: a delay d becomes a random value in [d*(1-Jitter), d*(1+Jitter)].
+	// Default value is 0.2, set to a negative value to disable.
+	Jitter float64
+
+	// Decides if an error is retryable. Default value is IsRetryableError.
+	IsRetryable func(flavor DbFlavor, err error) bool
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return defaultRetryMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) isRetryable(flavor DbFlavor, err error) bool {
+	if p.IsRetryable != nil {
+		return p.IsRetryable(flavor, err)
+	}
+	return IsRetryableError(flavor, err)
+}
+
+// Backoff returns the delay before the attempt following the specified one (1-based), jitter applied.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	initial, max, multiplier, jitter := p.InitialBackoff, p.MaxBackoff, p.Multiplier, p.Jitter
+	if initial <= 0 {
+		initial = defaultRetryInitialBackoff
+	}
+	if max <= 0 {
+		max = defaultRetryMaxBackoff
+	}
+	if multiplier < 1 {
+		multiplier = defaultRetryMultiplier
+	}
+	if jitter == 0 {
+		jitter = defaultRetryJitter
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	d := float64(initial)
+	for i := 1; i < attempt && d < float64(max); i++ {
+		d *= multiplier
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	if jitter > 0 {
+		d *= 1 - jitter + 2*jitter*rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// RetryAttempt records an attempt of a retried command, see SqlConnect.SetRetryPolicy.
+//
+// @Available since <<VERSION>>
+type RetryAttempt struct {
+	Attempt int     `json:"attempt"`           // attempt number, starting from 1
+	Cost    float64 `json:"cost"`              // execution time of the attempt, in microseconds
+	Error   string  `json:"error,omitempty"`   // error of the attempt
+	Backoff float64 `json:"backoff,omitempty"` // delay before the next attempt, in microseconds
+}
+
+var (
+	// deadlock, lock wait timeout, server has gone away, lost connection
+	retryableMySqlCodes = map[string]bool{"1213": true, "1205": true, "2006": true, "2013": true}
+	// mysql.ErrInvalidConn
+	retryableMySqlMsgs = []string{"invalid connection"}
+	// serialization failure, deadlock
+	retryablePgSqlCodes = map[string]bool{"40001": true, "40P01": true}
+	// deadlock victim
+	retryableMsSqlCodes = map[string]bool{"1205": true}
+	// see retryableOracleMsgs
+	retryableOracleCodes = map[string]bool{"60": true, "8177": true, "3113": true, "3114": true, "3135": true}
+	// drivers reporting codes in messages only
+	retryableOracleMsgs = []string{"ORA-00060", "ORA-08177", "ORA-03113", "ORA-03114", "ORA-03135"}
+	// drivers without error codes
+	retryableSqliteMsgs = []string{"SQLITE_BUSY", "database is locked", "database is busy"}
+)
+
+// pgSqlConnExceptionClass is the class of PostgreSQL SQLSTATE codes reporting connection exceptions (e.g. 08006).
+const pgSqlConnExceptionClass = "08"
+
+// sqliteBusy is the primary result code SQLITE_BUSY, extended codes (e.g. SQLITE_BUSY_SNAPSHOT) share its lower 8 bits.
+const sqliteBusy = 5
+
+// IsRetryableError checks if an error is transient for a database flavor, i.e. the failed command can be retried:
+//   - MySQL: 1213 (deadlock), 1205 (lock wait timeout), 2006 (server has gone away), 2013 (lost connection) and
+//     "invalid connection" (mysql.ErrInvalidConn).
+//   - PostgreSQL: 40001 (serialization failure), 40P01 (deadlock detected) and class 08 (connection exception).
+//   - MSSQL: 1205 (deadlock victim).
+//   - Oracle: ORA-00060 (deadlock), ORA-08177 (cannot serialize access), ORA-03113 (end-of-file on communication
+//     channel), ORA-03114 (not connected) and ORA-03135 (connection lost contact).
+//   - SQLite: SQLITE_BUSY (including its extended codes).
+//   - all flavors: dropped connections, i.e. driver.ErrBadConn, io.ErrUnexpectedEOF, syscall.ECONNRESET and
+//     syscall.EPIPE.
+//
+// Error codes are extracted with prom.ErrorCode. If the flavor is FlavorUnknown, error codes are checked against
+// MySQL, PostgreSQL and MSSQL ones only (numeric codes of SQLite and Oracle overlap with codes of other databases),
+// SQLite and Oracle errors are recognized by their messages.
+//
+// Note: a command failing because of a dropped connection may have been executed by the server before the
+// connection was lost, hence retrying non-idempotent commands (e.g. INSERT) may apply them twice. Use
+// SqlConnect.SetCategoryRetryPolicy to disable retrying such commands if this is a concern.
+//
+// @Available since <<VERSION>>
+func IsRetryableError(flavor DbFlavor, err error) bool {
+	if err == nil {
+		return false
+	}
+	if isDroppedConnError(err) {
+		return true
+	}
+	code := prom.ErrorCode(err)
+	switch flavor {
+	case FlavorMySql:
+		return retryableMySqlCodes[code] || containsAny(err.Error(), retryableMySqlMsgs)
+	case FlavorPgSql:
+		return isRetryablePgSqlCode(code)
+	case FlavorMsSql:
+		return retryableMsSqlCodes[code]
+	case FlavorOracle:
+		return isRetryableOracleError(code, err)
+	case FlavorSqlite:
+		return isRetryableSqliteError(code, err)
+	case FlavorUnknown:
+		return retryableMySqlCodes[code] || isRetryablePgSqlCode(code) || retryableMsSqlCodes[code] ||
+			containsAny(err.Error(), retryableMySqlMsgs) || containsAny(err.Error(), retryableOracleMsgs) ||
+			containsAny(err.Error(), retryableSqliteMsgs)
+	}
+	return false
+}
+
+func isDroppedConnError(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+func isRetryablePgSqlCode(code string) bool {
+	return retryablePgSqlCodes[code] || (len(code) == 5 && strings.HasPrefix(code, pgSqlConnExceptionClass))
+}
+
+func isRetryableOracleError(code string, err error) bool {
+	if retryableOracleCodes[strings.TrimLeft(strings.TrimPrefix(code, "ORA-"), "0")] {
+		return true
+	}
+	return containsAny(err.Error(), retryableOracleMsgs)
+}
+
+func isRetryableSqliteError(code string, err error) bool {
+	if n, e := strconv.Atoi(code); e == nil {
+		return n&0xff == sqliteBusy
+	}
+	return containsAny(err.Error(), retryableSqliteMsgs)
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRetryPolicy returns the default policy to retry DBProxy's exec/query calls, nil if none.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) GetRetryPolicy() *RetryPolicy {
+	return sc.retryPolicy
+}
+
+// SetRetryPolicy sets the default policy to retry DBProxy's exec/query calls (and their context-less variants) failing
+// with transient errors, applied to categories without their own policy (see SetCategoryRetryPolicy). Set to nil to
+// disable retrying by default.
+//
+// All attempts of a retried command are recorded in its CmdMeta, under key "attempts" ([]RetryAttempt).
+//
+// Note: calls via ConnProxy and TxProxy are not retried, since a failed command usually aborts the whole transaction.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) SetRetryPolicy(policy *RetryPolicy) *SqlConnect {
+	sc.retryPolicy = policy
+	return sc
+}
+
+// GetCategoryRetryPolicy returns the policy to retry commands of a metrics category (e.g. prom.MetricsCatDML), which
+// is the default policy if the category has no policy of its own.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) GetCategoryRetryPolicy(category string) *RetryPolicy {
+	if policy, ok := sc.categoryRetryPolicies[category]; ok {
+		return policy
+	}
+	return sc.retryPolicy
+}
+
+// SetCategoryRetryPolicy sets the policy to retry commands of a metrics category (e.g. prom.MetricsCatDDL), overriding
+// the default policy. Set to nil to disable retrying commands of the category.
+//
+// Note: policies should be set before the SqlConnect is shared between goroutines.
+//
+// @Available since <<VERSION>>
+func (sc *SqlConnect) SetCategoryRetryPolicy(category string, policy *RetryPolicy) *SqlConnect {
+	if sc.categoryRetryPolicies == nil {
+		sc.categoryRetryPolicies = make(map[string]*RetryPolicy)
+	}
+	sc.categoryRetryPolicies[category] = policy
+	return sc
+}
+
+// execWithRetry executes a command of a metrics category, retrying it according to the category's retry policy and
+// guarding each attempt with the circuit breaker (if any).
+func (sc *SqlConnect) execWithRetry(ctx context.Context, category string, cmd *prom.CmdExecInfo, fn func() error) error {
+	policy := sc.GetCategoryRetryPolicy(category)
+	var attempts []RetryAttempt
+	for attempt := 1; ; attempt++ {
+		done, err := sc.breakerAllow()
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		err = fn()
+		done(err)
+		a := RetryAttempt{Attempt: attempt, Cost: float64(time.Since(start).Microseconds())}
+		if err != nil {
+			a.Error = err.Error()
+		}
+		if err == nil || policy == nil || attempt >= policy.maxAttempts() || !policy.isRetryable(sc.flavor, err) {
+			if attempts != nil {
+				cmdMeta(cmd)["attempts"] = append(attempts, a)
+			}
+			return err
+		}
+		backoff := policy.Backoff(attempt)
+		a.Backoff = float64(backoff.Microseconds())
+		attempts = append(attempts, a)
+		cmdMeta(cmd)["attempts"] = attempts
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// cmdMeta returns the command's CmdMeta as a map[string]interface{}, initializing it if needed.
+func cmdMeta(cmd *prom.CmdExecInfo) map[string]interface{} {
+	meta, ok := cmd.CmdMeta.(map[string]interface{})
+	if !ok {
+		meta = make(map[string]interface{})
+		cmd.CmdMeta = meta
+	}
+	return meta
+}
@@ -0,0 +1,107 @@
+package sql
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/btnguyen2k/prom"
+)
+
+// IRows abstracts the result set of a query: both *sql.Rows and *RowsProxy implement it, and can be passed to
+// SqlConnect.FetchRows and SqlConnect.FetchRowsCallback.
+//
+// @Available since <<VERSION>>
+type IRows interface {
+	ColumnTypes() ([]*sql.ColumnType, error)
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}
+
+// RowsProxy is a proxy that can be used as replacement for sql.Rows, returned by the QueryProxy functions of DBProxy,
+// ConnProxy, TxProxy and StmtProxy.
+//
+// Unlike the Query functions, which stop measuring as soon as the driver returns the result set, the query's command
+// is finalized and logged when the result set is consumed: when Next returns false or when Close is called, whichever
+// comes first. Its cost covers the query execution and fetching all rows, and its CmdResponse records:
+//   - "rowsScanned": number of rows scanned.
+//   - "timeToFirstRow": time from the query start until the first row is available, in microseconds.
+//   - "fetchTime": time from the query returning until the result set is consumed, in microseconds.
+//
+// Note: for queries returning multiple result sets, the command is finalized when the first result set is exhausted.
+//
+// @Available since <<VERSION>>
+type RowsProxy struct {
+	*sql.Rows
+	sqlc            *SqlConnect
+	cmd             *prom.CmdExecInfo
+	category, query string
+	queryTime       time.Time // when the query returned
+	firstRowTime    time.Time
+	numRows         int64
+	once            sync.Once
+}
+
+// queryProxy wraps the result of a query command into a RowsProxy, or finalizes and logs the command if the query failed.
+func (sc *SqlConnect) queryProxy(category, query string, cmd *prom.CmdExecInfo, rows *sql.Rows, err error) (*RowsProxy, error) {
+	if err != nil {
+		endCmd(cmd, err)
+		sc.logCmdMetrics(category, query, cmd)
+		return nil, err
+	}
+	return &RowsProxy{Rows: rows, sqlc: sc, cmd: cmd, category: category, query: query, queryTime: time.Now()}, nil
+}
+
+// Next overrides sql.Rows/Next to count scanned rows, finalizing the command when there is no more row.
+func (rp *RowsProxy) Next() bool {
+	if !rp.Rows.Next() {
+		rp.finish(rp.Rows.Err())
+		return false
+	}
+	if rp.numRows++; rp.numRows == 1 {
+		rp.firstRowTime = time.Now()
+	}
+	return true
+}
+
+// Close overrides sql.Rows/Close to finalize the command (if not done yet).
+func (rp *RowsProxy) Close() error {
+	err := rp.Rows.Close()
+	rp.finish(rp.Rows.Err())
+	return err
+}
+
+// NumRows returns the number of rows scanned so far.
+func (rp *RowsProxy) NumRows() int64 {
+	return rp.numRows
+}
+
+// TimeToFirstRow returns the time from the query start until the first row was available, zero if no row was scanned.
+func (rp *RowsProxy) TimeToFirstRow() time.Duration {
+	if rp.firstRowTime.IsZero() {
+		return 0
+	}
+	return rp.firstRowTime.Sub(rp.cmd.BeginTime)
+}
+
+// FetchTime returns the time from the query returning until the result set was consumed (or until now, if the result
+// set is being consumed).
+func (rp *RowsProxy) FetchTime() time.Duration {
+	if rp.cmd.EndTime.IsZero() {
+		return time.Since(rp.queryTime)
+	}
+	return rp.cmd.EndTime.Sub(rp.queryTime)
+}
+
+func (rp *RowsProxy) finish(err error) {
+	rp.once.Do(func() {
+		rp.cmd.EndWithCostAsExecutionTime(prom.CmdResultOk, prom.CmdResultError, err)
+		rp.cmd.CmdResponse = m{
+			"rowsScanned":    rp.numRows,
+			"timeToFirstRow": float64(rp.TimeToFirstRow().Microseconds()),
+			"fetchTime":      float64(rp.FetchTime().Microseconds()),
+		}
+		rp.sqlc.logCmdMetrics(rp.category, rp.query, rp.cmd)
+	})
+}
@@ -0,0 +1,354 @@
+package sql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FetchRowsInto loads rows from database and maps each row to a value of type T, which must be a struct or a pointer
+// to struct. If no row matches the query, FetchRowsInto returns (<empty slice>, nil).
+//
+// Rows are loaded with the same per-flavor conversions as FetchRows, then each column is mapped to a struct field:
+//   - a field tagged `db:"column_name"` (a field tagged `db:"-"` is ignored), or else the field with the column's name.
+//   - if no field matches the column's name exactly, the match is case-insensitive (e.g. Oracle's upper-cased column
+//     names); columns matching no field are ignored.
+//   - fields of embedded structs (and pointers to structs of exported types, allocated as needed) are mapped too, fields
+//     of the outer struct take precedence.
+//   - NULL values can be mapped to pointer fields (nil), fields implementing sql.Scanner (e.g. sql.NullString) and
+//     interface, map or slice fields, mapping a NULL value to other fields is an error.
+//   - values are converted to the field's type if needed (e.g. int64 to int32, or string to float64), values that
+//     cannot be converted (e.g. overflows) are errors naming the column.
+//
+// Note: FetchRowsInto does NOT call 'rows.close()' when done!
+//
+// @Available since <<VERSION>>
+func FetchRowsInto[T any](sc *SqlConnect, rows IRows) ([]T, error) {
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	mapper, err := newStructMapper[T](colTypes)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]T, 0)
+	for rows.Next() {
+		row, err := fetchOneRowInto[T](sc, rows, colTypes, mapper)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// FetchRowsIntoCallback loads rows from database. For each row, FetchRowsIntoCallback maps it to a value of type T
+// (see FetchRowsInto) and passes the value to the callback function.
+// FetchRowsIntoCallback stops the loop when there is no more row to load or 'callback' function returns 'false'.
+//
+// Note: FetchRowsIntoCallback does NOT call 'rows.close()' when done!
+//
+// @Available since <<VERSION>>
+func FetchRowsIntoCallback[T any](sc *SqlConnect, rows IRows, callback func(row T, err error) bool) error {
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	mapper, err := newStructMapper[T](colTypes)
+	if err != nil {
+		return err
+	}
+	var next = true
+	var row T
+	for next && rows.Next() {
+		if row, err = fetchOneRowInto[T](sc, rows, colTypes, mapper); err != nil {
+			var zero T
+			next = callback(zero, err)
+		} else {
+			next = callback(row, nil)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+func fetchOneRowInto[T any](sc *SqlConnect, rows IRows, colTypes []*sql.ColumnType, mapper *structMapper) (T, error) {
+	var result T
+	rowData, err := sc.fetchOneRow(rows, colTypes)
+	if err != nil {
+		return result, err
+	}
+	v, err := mapper.newValue(rowData)
+	if err != nil {
+		return result, err
+	}
+	return v.Interface().(T), nil
+}
+
+/*----------------------------------------------------------------------*/
+
+// structField is a field a column is mapped to.
+type structField struct {
+	name   string // name of the field, used in error messages
+	column string // name of the column mapped to the field: the field's tag or name
+	index  []int  // index sequence of the field, for embedded structs
+}
+
+// structMapper maps rows (as loaded by fetchOneRow) to structs.
+type structMapper struct {
+	typ     reflect.Type // the struct type
+	ptr     bool         // true if rows are mapped to pointers to struct
+	columns []string
+	fields  []*structField // field of each column, nil if the column is not mapped
+}
+
+func newStructMapper[T any](colTypes []*sql.ColumnType) (*structMapper, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	mapper := &structMapper{typ: typ}
+	if typ.Kind() == reflect.Ptr {
+		mapper.typ, mapper.ptr = typ.Elem(), true
+	}
+	if mapper.typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot map rows to type %s, expecting a struct or a pointer to struct", typ)
+	}
+	fields := make([]*structField, 0)
+	collectStructFields(mapper.typ, nil, map[reflect.Type]bool{}, &fields)
+	mapper.columns = make([]string, len(colTypes))
+	mapper.fields = make([]*structField, len(colTypes))
+	for i, colType := range colTypes {
+		mapper.columns[i] = colType.Name()
+		mapper.fields[i] = findStructField(fields, colType.Name())
+	}
+	return mapper, nil
+}
+
+// collectStructFields collects the exported fields of a struct, including fields of embedded structs. Fields are
+// collected in order of precedence: fields of the struct itself, then fields of embedded structs.
+func collectStructFields(typ reflect.Type, index []int, visited map[reflect.Type]bool, result *[]*structField) {
+	visited[typ] = true
+	embedded := make([]int, 0)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("db"), ",")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType {
+				// a pointer to an unexported struct type cannot be allocated
+				if f.Type.Kind() != reflect.Ptr || f.IsExported() {
+					embedded = append(embedded, i)
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		*result = append(*result, &structField{name: f.Name, column: tag, index: append(append([]int{}, index...), i)})
+	}
+	for _, i := range embedded {
+		f := typ.Field(i)
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if !visited[ft] {
+			collectStructFields(ft, append(append([]int{}, index...), i), visited, result)
+		}
+	}
+}
+
+// findStructField finds the field a column is mapped to: the first field matching the column's name exactly, or else
+// the first field matching it case-insensitively.
+func findStructField(fields []*structField, column string) *structField {
+	for _, f := range fields {
+		if f.column == column {
+			return f
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.column, column) {
+			return f
+		}
+	}
+	return nil
+}
+
+// newValue creates a new struct (or pointer to struct) populated from a row loaded by fetchOneRow.
+func (sm *structMapper) newValue(row map[string]interface{}) (reflect.Value, error) {
+	p := reflect.New(sm.typ)
+	for i, f := range sm.fields {
+		if f == nil {
+			continue
+		}
+		if err := assignValue(fieldByIndexAlloc(p.Elem(), f.index), row[sm.columns[i]]); err != nil {
+			return reflect.Value{}, fmt.Errorf("column %s (field %s): %w", sm.columns[i], f.name, err)
+		}
+	}
+	if sm.ptr {
+		return p, nil
+	}
+	return p.Elem(), nil
+}
+
+// fieldByIndexAlloc is similar to reflect.Value.FieldByIndex, but allocates nil pointers to embedded structs.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// assignValue assigns a value loaded by fetchOneRow to an addressable destination, converting it if needed.
+func assignValue(dst reflect.Value, val interface{}) error {
+	src := reflect.ValueOf(val)
+	if val != nil && src.Kind() == reflect.Ptr {
+		// NULL values are loaded as typed nil pointers
+		if src.IsNil() {
+			val, src = nil, reflect.Value{}
+		} else {
+			src = src.Elem()
+			val = src.Interface()
+		}
+	}
+	if dst.Addr().Type().Implements(scannerType) {
+		return dst.Addr().Interface().(sql.Scanner).Scan(val)
+	}
+	if val == nil {
+		switch dst.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		return fmt.Errorf("cannot assign NULL to type %s", dst.Type())
+	}
+	if dst.Kind() == reflect.Ptr {
+		elem := reflect.New(dst.Type().Elem())
+		if err := assignValue(elem.Elem(), val); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	}
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+	if src.Kind() == dst.Kind() && src.Type().ConvertibleTo(dst.Type()) {
+		// e.g. named types
+		dst.Set(src.Convert(dst.Type()))
+		return nil
+	}
+	errConvert := fmt.Errorf("cannot convert %T to %s", val, dst.Type())
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt64(src)
+		if err != nil || dst.OverflowInt(n) {
+			return errConvert
+		}
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := toInt64(src)
+		if err != nil || n < 0 || dst.OverflowUint(uint64(n)) {
+			return errConvert
+		}
+		dst.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat64(src)
+		if err != nil || dst.OverflowFloat(f) {
+			return errConvert
+		}
+		dst.SetFloat(f)
+	case reflect.Bool:
+		b, err := toBool(src)
+		if err != nil {
+			return errConvert
+		}
+		dst.SetBool(b)
+	case reflect.String:
+		b, ok := val.([]byte)
+		if !ok {
+			return errConvert
+		}
+		dst.SetString(string(b))
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() != reflect.Uint8 || src.Kind() != reflect.String {
+			return errConvert
+		}
+		dst.SetBytes([]byte(src.String()))
+	default:
+		return errConvert
+	}
+	return nil
+}
+
+var errNotNumber = errors.New("not a number")
+
+func toInt64(v reflect.Value) (int64, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n := v.Uint(); n <= math.MaxInt64 {
+			return int64(n), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f), nil
+		}
+	case reflect.String:
+		return strconv.ParseInt(strings.TrimSpace(v.String()), 10, 64)
+	}
+	return 0, errNotNumber
+}
+
+func toFloat64(v reflect.Value) (float64, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return strconv.ParseFloat(strings.TrimSpace(v.String()), 64)
+	}
+	return 0, errNotNumber
+}
+
+// toBool converts numbers (e.g. databases without boolean type) and strings such as "true" or "0" to bool.
+func toBool(v reflect.Value) (bool, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		f, err := toFloat64(v)
+		return f != 0, err
+	case reflect.String:
+		return strconv.ParseBool(strings.TrimSpace(v.String()))
+	}
+	return false, errors.New("not a boolean")
+}
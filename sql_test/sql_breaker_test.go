@@ -0,0 +1,183 @@
+package sql_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btnguyen2k/prom"
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+var errTestBreaker = errors.New("failed")
+
+func TestCircuitBreaker_ConsecutiveFailures(t *testing.T) {
+	testName := "TestCircuitBreaker_ConsecutiveFailures"
+	changes := make([]string, 0)
+	cb := promsql.NewCircuitBreaker(promsql.CircuitBreakerOpts{
+		ConsecutiveFailures: 3,
+		OpenTimeout:         50 * time.Millisecond,
+		OnStateChange:       func(from, to promsql.BreakerState) { changes = append(changes, from.String()+">"+to.String()) },
+	})
+	call := func(err error) error {
+		done, rejected := cb.Allow()
+		if rejected != nil {
+			return rejected
+		}
+		done(err)
+		return nil
+	}
+	for _, err := range []error{errTestBreaker, errTestBreaker, nil, errTestBreaker, errTestBreaker} {
+		_ = call(err)
+	}
+	if cb.State() != promsql.BreakerClosed {
+		t.Fatalf("%s failed: expected state %s but received %s", testName, promsql.BreakerClosed, cb.State())
+	}
+	_ = call(context.Canceled)
+	if cb.State() != promsql.BreakerClosed {
+		t.Fatalf("%s failed: context.Canceled should be ignored", testName)
+	}
+	if stats := cb.Stats(); stats.ConsecutiveFailures != 2 || stats.WindowCalls != 5 {
+		t.Fatalf("%s failed: unexpected stats %#v", testName, stats)
+	}
+	_ = call(errTestBreaker)
+	if cb.State() != promsql.BreakerOpen {
+		t.Fatalf("%s failed: expected state %s but received %s", testName, promsql.BreakerOpen, cb.State())
+	}
+	err := call(nil)
+	var openErr *promsql.CircuitOpenError
+	if !errors.Is(err, promsql.ErrCircuitOpen) || !errors.As(err, &openErr) || openErr.State != promsql.BreakerOpen || openErr.RetryAfter <= 0 {
+		t.Fatalf("%s failed: expected CircuitOpenError but received %#v", testName, err)
+	}
+	if stats := cb.Stats(); stats.Rejected != 1 {
+		t.Fatalf("%s failed: expected 1 rejected call but received %d", testName, stats.Rejected)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if cb.State() != promsql.BreakerHalfOpen {
+		t.Fatalf("%s failed: expected state %s but received %s", testName, promsql.BreakerHalfOpen, cb.State())
+	}
+	done, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("%s failed: expected trial call allowed but received %s", testName, err)
+	}
+	if _, err := cb.Allow(); !errors.As(err, &openErr) || openErr.State != promsql.BreakerHalfOpen {
+		t.Fatalf("%s failed: expected second trial call rejected but received %v", testName, err)
+	}
+	done(errTestBreaker)
+	if cb.State() != promsql.BreakerOpen {
+		t.Fatalf("%s failed: expected state %s but received %s", testName, promsql.BreakerOpen, cb.State())
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := call(nil); err != nil {
+		t.Fatalf("%s failed: expected trial call allowed but received %s", testName, err)
+	}
+	if cb.State() != promsql.BreakerClosed {
+		t.Fatalf("%s failed: expected state %s but received %s", testName, promsql.BreakerClosed, cb.State())
+	}
+	expected := []string{"CLOSED>OPEN", "OPEN>HALF_OPEN", "HALF_OPEN>OPEN", "OPEN>HALF_OPEN", "HALF_OPEN>CLOSED"}
+	if len(changes) != len(expected) {
+		t.Fatalf("%s failed: expected state changes %v but received %v", testName, expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatalf("%s failed: expected state changes %v but received %v", testName, expected, changes)
+		}
+	}
+}
+
+func TestCircuitBreaker_FailureRate(t *testing.T) {
+	testName := "TestCircuitBreaker_FailureRate"
+	cb := promsql.NewCircuitBreaker(promsql.CircuitBreakerOpts{FailureRate: 0.5, MinRequests: 10, Window: time.Minute})
+	for i := 0; i < 9; i++ {
+		done, _ := cb.Allow()
+		if i%2 == 0 {
+			done(errTestBreaker)
+		} else {
+			done(nil)
+		}
+	}
+	if stats := cb.Stats(); stats.State != promsql.BreakerClosed || stats.WindowCalls != 9 || stats.WindowFailures != 5 {
+		t.Fatalf("%s failed: unexpected stats %#v", testName, stats)
+	}
+	done, _ := cb.Allow()
+	done(nil)
+	if cb.State() != promsql.BreakerOpen {
+		t.Fatalf("%s failed: expected state %s but received %s", testName, promsql.BreakerOpen, cb.State())
+	}
+	cb.Reset()
+	if stats := cb.Stats(); stats.State != promsql.BreakerClosed || stats.WindowCalls != 0 {
+		t.Fatalf("%s failed: unexpected stats after reset %#v", testName, stats)
+	}
+}
+
+func TestCircuitBreaker_Concurrent(t *testing.T) {
+	cb := promsql.NewCircuitBreaker(promsql.CircuitBreakerOpts{ConsecutiveFailures: 5, OpenTimeout: time.Millisecond})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if done, err := cb.Allow(); err == nil {
+					if (i+j)%3 == 0 {
+						done(errTestBreaker)
+					} else {
+						done(nil)
+					}
+				}
+				_ = cb.Stats()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSqlConnect_CircuitBreaker(t *testing.T) {
+	testName := "TestSqlConnect_CircuitBreaker"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "breaker.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer sqlc.Close()
+	if sqlc.GetCircuitBreaker() != nil {
+		t.Fatalf("%s failed: expected no circuit breaker by default", testName)
+	}
+	cb := promsql.NewCircuitBreaker(promsql.CircuitBreakerOpts{ConsecutiveFailures: 2, OpenTimeout: time.Hour})
+	sqlc.SetCircuitBreaker(cb)
+	dbp := sqlc.GetDBProxy()
+	for i := 0; i < 2; i++ {
+		if _, err := dbp.Exec("INSERT INTO tbl_not_found (id) VALUES (?)", i); err == nil || errors.Is(err, promsql.ErrCircuitOpen) {
+			t.Fatalf("%s failed: expected database error but received %v", testName, err)
+		}
+	}
+	if _, err := dbp.Exec("CREATE TABLE tbl_breaker (id INT)"); !errors.Is(err, promsql.ErrCircuitOpen) {
+		t.Fatalf("%s failed: expected ErrCircuitOpen but received %v", testName, err)
+	}
+	if _, err := dbp.Query("SELECT 1"); !errors.Is(err, promsql.ErrCircuitOpen) {
+		t.Fatalf("%s failed: expected ErrCircuitOpen but received %v", testName, err)
+	}
+
+	m, _ := sqlc.Metrics(prom.MetricsCatAll, prom.MetricsOpts{ReturnLatestCommands: 2})
+	for _, cmd := range m.LastNCmds {
+		if cmd.Result != prom.CmdResultRejected || !errors.Is(cmd.Error, promsql.ErrCircuitOpen) {
+			t.Fatalf("%s failed: expected rejected command but received %#v", testName, cmd)
+		}
+	}
+	m, _ = sqlc.Metrics(promsql.MetricsCatCircuitBreaker, prom.MetricsOpts{ReturnLatestCommands: 10})
+	if m.TotalNumCmds != 1 || m.LastNCmds[0].CmdName != "circuit_breaker" || m.LastNCmds[0].Result != promsql.BreakerOpen.String() {
+		t.Fatalf("%s failed: expected state change logged but received %#v", testName, m)
+	}
+
+	cb.Reset()
+	if _, err := dbp.Exec("CREATE TABLE tbl_breaker (id INT)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	sqlc.SetCircuitBreaker(nil)
+	if sqlc.GetCircuitBreaker() != nil {
+		t.Fatalf("%s failed: expected circuit breaker removed", testName)
+	}
+}
@@ -0,0 +1,277 @@
+package sql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btnguyen2k/prom"
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+func _newSqlConnectInstrumented(t *testing.T, testName string) *promsql.SqlConnect {
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "driver.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if sqlc.IsDriverInstrumented() {
+		t.Fatalf("%s failed: driver should not be instrumented by default", testName)
+	}
+	if err := sqlc.InstrumentDriver(true); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if !sqlc.IsDriverInstrumented() {
+		t.Fatalf("%s failed: expected driver instrumented", testName)
+	}
+	return sqlc
+}
+
+func _sqlcVerifyNumCmds(t *testing.T, testName string, sqlc *promsql.SqlConnect, expected map[string]int64) {
+	for category, numCmds := range expected {
+		m, err := sqlc.Metrics(category)
+		if err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+		if m.TotalNumCmds != numCmds {
+			t.Fatalf("%s failed: expected %d commands under category %s but received %d", testName, numCmds, category, m.TotalNumCmds)
+		}
+	}
+}
+
+func TestSqlConnect_InstrumentDriver(t *testing.T) {
+	testName := "TestSqlConnect_InstrumentDriver"
+	sqlc := _newSqlConnectInstrumented(t, testName)
+	defer sqlc.Close()
+	db := sqlc.GetDB()
+
+	if err := db.Ping(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if cmd := _sqlcLastCommand(sqlc, prom.MetricsCatOther); cmd == nil || cmd.CmdName != "ping" {
+		t.Fatalf("%s failed: expected ping command but received %#v", testName, cmd)
+	}
+	if _, err := db.Exec("CREATE TABLE tbl_driver (id INT, name VARCHAR(32))"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if _, err := db.Exec("INSERT INTO tbl_driver (id, name) VALUES (?, ?)", 1, "one"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	cmd := _sqlcLastCommand(sqlc, prom.MetricsCatDML)
+	if cmd == nil || cmd.CmdName != "INSERT" || cmd.Result != prom.CmdResultOk {
+		t.Fatalf("%s failed: unexpected command %#v", testName, cmd)
+	}
+	js, _ := json.Marshal(cmd)
+	if !strings.Contains(string(js), `"rowsAffected":1`) || !strings.Contains(string(js), `"one"`) {
+		t.Fatalf("%s failed: expected request params and response recorded but received %s", testName, js)
+	}
+
+	stmt, err := db.Prepare("INSERT INTO tbl_driver (id, name) VALUES (?, ?)")
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if cmd := _sqlcLastCommand(sqlc, prom.MetricsCatOther); cmd == nil || cmd.CmdName != "prepare" {
+		t.Fatalf("%s failed: expected prepare command but received %#v", testName, cmd)
+	}
+	for i := 2; i <= 3; i++ {
+		if _, err := stmt.Exec(i, "name"); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+	}
+	_ = stmt.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if _, err := tx.Exec("DELETE FROM tbl_driver WHERE id=?", 3); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if cmd := _sqlcLastCommand(sqlc, prom.MetricsCatTCL); cmd == nil || cmd.CmdName != "commit" {
+		t.Fatalf("%s failed: expected commit command but received %#v", testName, cmd)
+	}
+
+	rows, err := db.Query("SELECT * FROM tbl_driver WHERE id>=? ORDER BY id", 1)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	result, err := sqlc.FetchRows(rows)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if len(result) != 2 || result[1]["name"] != "name" {
+		t.Fatalf("%s failed: unexpected result %#v", testName, result)
+	}
+	cmd = _sqlcLastCommand(sqlc, prom.MetricsCatDQL)
+	js, _ = json.Marshal(cmd)
+	if cmd == nil || cmd.CmdName != "SELECT" || !strings.Contains(string(js), `"rowsScanned":2`) {
+		t.Fatalf("%s failed: unexpected command %s", testName, js)
+	}
+
+	if _, err := db.Exec("INSERT INTO tbl_not_found (id) VALUES (1)"); err == nil {
+		t.Fatalf("%s failed: expected error", testName)
+	}
+	if cmd := _sqlcLastCommand(sqlc, prom.MetricsCatDML); cmd == nil || cmd.Result != prom.CmdResultError {
+		t.Fatalf("%s failed: expected failed command but received %#v", testName, cmd)
+	}
+	_sqlcVerifyNumCmds(t, testName, sqlc, map[string]int64{
+		prom.MetricsCatAll: 10, prom.MetricsCatDDL: 1, prom.MetricsCatDML: 5, prom.MetricsCatDQL: 1, prom.MetricsCatTCL: 1, prom.MetricsCatOther: 2,
+	})
+}
+
+func TestSqlConnect_InstrumentDriverProxies(t *testing.T) {
+	testName := "TestSqlConnect_InstrumentDriverProxies"
+	sqlc := _newSqlConnectInstrumented(t, testName)
+	defer sqlc.Close()
+	dbp := sqlc.GetDBProxy()
+
+	if err := dbp.Ping(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if _, err := dbp.Exec("CREATE TABLE tbl_driver (id INT)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	tx, err := dbp.BeginTxProxy(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if _, err := tx.Exec("INSERT INTO tbl_driver (id) VALUES (1)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	rows, err := dbp.QueryProxy("SELECT * FROM tbl_driver")
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if _, err := sqlc.FetchRows(rows); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	_ = sqlc.GetDBProxy().QueryRow("SELECT COUNT(*) FROM tbl_driver").Scan(new(int))
+	_sqlcVerifyNumCmds(t, testName, sqlc, map[string]int64{
+		prom.MetricsCatAll: 6, prom.MetricsCatDDL: 1, prom.MetricsCatDML: 1, prom.MetricsCatDQL: 2, prom.MetricsCatTCL: 1, prom.MetricsCatOther: 1,
+	})
+
+	// calls rejected by the circuit breaker never reach the driver, hence are logged by the proxy
+	sqlc.SetCircuitBreaker(promsql.NewCircuitBreaker(promsql.CircuitBreakerOpts{ConsecutiveFailures: 1, OpenTimeout: time.Minute}))
+	if _, err := dbp.Exec("INSERT INTO tbl_not_found (id) VALUES (1)"); err == nil {
+		t.Fatalf("%s failed: expected error", testName)
+	}
+	if _, err := dbp.Exec("CREATE TABLE tbl_rejected (id INT)"); !errors.Is(err, promsql.ErrCircuitOpen) {
+		t.Fatalf("%s failed: expected ErrCircuitOpen but received %v", testName, err)
+	}
+	if cmd := _sqlcLastCommand(sqlc, prom.MetricsCatDDL); cmd == nil || cmd.Result != prom.CmdResultRejected {
+		t.Fatalf("%s failed: expected rejected command but received %#v", testName, cmd)
+	}
+	_sqlcVerifyNumCmds(t, testName, sqlc, map[string]int64{prom.MetricsCatAll: 8, prom.MetricsCatDDL: 2, prom.MetricsCatDML: 2})
+}
+
+func TestSqlConnect_InstrumentDriverLabels(t *testing.T) {
+	testName := "TestSqlConnect_InstrumentDriverLabels"
+	sqlc := _newSqlConnectInstrumented(t, testName)
+	defer sqlc.Close()
+	db := sqlc.GetDB()
+	ctx := prom.WithLabels(context.Background(), map[string]string{"tenant": "acme"})
+
+	if _, err := db.ExecContext(ctx, "CREATE TABLE tbl_driver (id INT)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if cmd := _sqlcLastCommand(sqlc, prom.MetricsCatDDL); cmd == nil || cmd.Labels()["tenant"] != "acme" {
+		t.Fatalf("%s failed: expected labels attached to command %#v", testName, cmd)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if cmd := _sqlcLastCommand(sqlc, prom.MetricsCatTCL); cmd == nil || cmd.CmdName != "rollback" || cmd.Labels()["tenant"] != "acme" {
+		t.Fatalf("%s failed: expected labels attached to command %#v", testName, cmd)
+	}
+}
+
+func TestSqlConnect_InstrumentDriverToggle(t *testing.T) {
+	testName := "TestSqlConnect_InstrumentDriverToggle"
+	sqlc := _newSqlConnectInstrumented(t, testName)
+	defer sqlc.Close()
+	if _, err := sqlc.GetDB().Exec("CREATE TABLE tbl_driver (id INT)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if err := sqlc.InstrumentDriver(false); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if sqlc.IsDriverInstrumented() {
+		t.Fatalf("%s failed: expected driver not instrumented", testName)
+	}
+	if _, err := sqlc.GetDB().Exec("INSERT INTO tbl_driver (id) VALUES (1)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if _, err := sqlc.GetDBProxy().Exec("INSERT INTO tbl_driver (id) VALUES (2)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	_sqlcVerifyNumCmds(t, testName, sqlc, map[string]int64{prom.MetricsCatDDL: 1, prom.MetricsCatDML: 1})
+}
+
+func TestSqlConnect_InstrumentDriverRaw(t *testing.T) {
+	testName := "TestSqlConnect_InstrumentDriverRaw"
+	sqlc := _newSqlConnectInstrumented(t, testName)
+	defer sqlc.Close()
+	rawType := func() (string, string) {
+		conn, err := sqlc.GetDB().Conn(context.Background())
+		if err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+		defer conn.Close()
+		var rawType, unwrappedType string
+		if err := conn.Raw(func(driverConn any) error {
+			rawType, unwrappedType = fmt.Sprintf("%T", driverConn), ""
+			if w, ok := driverConn.(interface{ Unwrap() driver.Conn }); ok {
+				unwrappedType = fmt.Sprintf("%T", w.Unwrap())
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+		return rawType, unwrappedType
+	}
+	instrumentedType, unwrappedType := rawType()
+	if err := sqlc.InstrumentDriver(false); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	driverType, _ := rawType()
+	if unwrappedType != driverType || instrumentedType == driverType {
+		t.Fatalf("%s failed: expected %s to unwrap to %s but received %s", testName, instrumentedType, driverType, unwrappedType)
+	}
+}
+
+func TestRegistry_LoadConfigSqlInstrumentDriver(t *testing.T) {
+	testName := "TestRegistry_LoadConfigSqlInstrumentDriver"
+	dsn := filepath.Join(t.TempDir(), "registry.db")
+	config := `{"connections": [{
+		"name": "main", "type": "sql",
+		"config": {"driver": "sqlite", "dsn": "` + filepath.ToSlash(dsn) + `", "flavor": "sqlite", "instrument_driver": true}
+	}]}`
+	r := prom.NewRegistry()
+	if err := r.LoadConfig([]byte(config), nil); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer r.Close()
+	sqlc := promsql.GetFromRegistry(r, "main")
+	if sqlc == nil || !sqlc.IsDriverInstrumented() {
+		t.Fatalf("%s failed: expected instrumented SqlConnect but received %#v", testName, sqlc)
+	}
+	if _, err := sqlc.GetDB().Exec("CREATE TABLE tbl_registry (id INT)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	_sqlcVerifyNumCmds(t, testName, sqlc, map[string]int64{prom.MetricsCatDDL: 1})
+}
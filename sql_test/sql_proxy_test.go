@@ -594,7 +594,7 @@ func _testTxProxy_Commit(testName, dbtype string, sqlc *promsql.SqlConnect, tx *
 	if err := tx.Commit(); err != nil {
 		f(fmt.Sprintf("%s failed: %s", testName+"/"+dbtype, err))
 	}
-	_sqlcVerifyLastCommand(f, testName, sqlc, "commit", prom.MetricsCatAll, prom.MetricsCatOther)
+	_sqlcVerifyLastCommand(f, testName, sqlc, "commit", prom.MetricsCatAll, prom.MetricsCatTCL)
 }
 
 func _testTxProxy_DBBegin_Commit(testName, dbtype string, sqlc *promsql.SqlConnect, db *promsql.DBProxy, f _testFailedWithMsgFunc) {
@@ -675,7 +675,7 @@ func _testTxProxy_Rollback(testName, dbtype string, sqlc *promsql.SqlConnect, tx
 	if err := tx.Rollback(); err != nil {
 		f(fmt.Sprintf("%s failed: %s", testName+"/"+dbtype, err))
 	}
-	_sqlcVerifyLastCommand(f, testName, sqlc, "rollback", prom.MetricsCatAll, prom.MetricsCatOther)
+	_sqlcVerifyLastCommand(f, testName, sqlc, "rollback", prom.MetricsCatAll, prom.MetricsCatTCL)
 }
 
 func _testTxProxy_DBBegin_Rollback(testName, dbtype string, sqlc *promsql.SqlConnect, db *promsql.DBProxy, f _testFailedWithMsgFunc) {
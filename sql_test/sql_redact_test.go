@@ -0,0 +1,124 @@
+package sql_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/btnguyen2k/prom"
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+func TestRedactPolicy_Redact(t *testing.T) {
+	testName := "TestRedactPolicy_Redact"
+	query := "UPDATE users SET password=?, token=? WHERE email=? AND note=?"
+	params := []interface{}{"secret", "token", "john@example.com", "a long long note"}
+	testCases := []struct {
+		name     string
+		policy   *promsql.RedactPolicy
+		query    string
+		expected []interface{}
+	}{
+		{"nil", nil, query, params},
+		{"mask_all", &promsql.RedactPolicy{MaskAll: true}, query, []interface{}{"***", "***", "***", "***"}},
+		{"mask_all_custom", &promsql.RedactPolicy{MaskAll: true, Mask: "?"}, query, []interface{}{"?", "?", "?", "?"}},
+		{"by_position", &promsql.RedactPolicy{Rules: []promsql.RedactRule{{Positions: []int{0, 1}}}}, query,
+			[]interface{}{"***", "***", "john@example.com", "a long long note"}},
+		{"by_query", &promsql.RedactPolicy{Rules: []promsql.RedactRule{{QueryPattern: regexp.MustCompile(`(?i)\bpassword\b`)}}}, query,
+			[]interface{}{"***", "***", "***", "***"}},
+		{"by_query_not_matched", &promsql.RedactPolicy{Rules: []promsql.RedactRule{{QueryPattern: regexp.MustCompile(`(?i)\bcredit_card\b`)}}}, query, params},
+		{"truncate", &promsql.RedactPolicy{MaxValueLength: 6}, query,
+			[]interface{}{"secret", "token", "john@e...(16 chars)", "a long...(16 chars)"}},
+		{"first_rule_wins", &promsql.RedactPolicy{MaxValueLength: 6, Rules: []promsql.RedactRule{{Positions: []int{0}}, {Positions: []int{0, 2}, Action: promsql.RedactHash}}}, query,
+			[]interface{}{"***", "token", "sha256:855f96e983f1f8e8", "a long...(16 chars)"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := append([]interface{}{}, params...)
+			result := tc.policy.Redact(tc.query, input)
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Fatalf("%s failed: expected %#v but received %#v", testName, tc.expected, result)
+			}
+			if !reflect.DeepEqual(input, params) {
+				t.Fatalf("%s failed: input must not be modified", testName)
+			}
+		})
+	}
+}
+
+func TestRedactPolicy_TruncateBytes(t *testing.T) {
+	testName := "TestRedactPolicy_TruncateBytes"
+	policy := &promsql.RedactPolicy{MaxValueLength: 3}
+	result := policy.Redact("", []interface{}{[]byte("abc"), []byte("abcdef")})
+	expected := []interface{}{[]byte("abc"), "616263...(6 bytes)"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%s failed: expected %#v but received %#v", testName, expected, result)
+	}
+}
+
+func TestRedactPolicy_Hash(t *testing.T) {
+	testName := "TestRedactPolicy_Hash"
+	policy := &promsql.RedactPolicy{Rules: []promsql.RedactRule{{Action: promsql.RedactHash}}}
+	r1 := policy.Redact("", []interface{}{"secret", 123, []byte("secret"), nil})
+	r2 := policy.Redact("", []interface{}{"secret", 123, []byte("secret"), nil})
+	if !reflect.DeepEqual(r1, r2) {
+		t.Fatalf("%s failed: hashes must be stable %#v / %#v", testName, r1, r2)
+	}
+	for _, v := range r1 {
+		if s, ok := v.(string); !ok || !strings.HasPrefix(s, "sha256:") || len(s) != len("sha256:")+16 {
+			t.Fatalf("%s failed: unexpected hash %#v", testName, v)
+		}
+	}
+	if r1[0] != r1[2] || r1[0] == r1[1] {
+		t.Fatalf("%s failed: unexpected hashes %#v", testName, r1)
+	}
+	salted := (&promsql.RedactPolicy{HashSalt: "salt", Rules: policy.Rules}).Redact("", []interface{}{"secret"})
+	if salted[0] == r1[0] {
+		t.Fatalf("%s failed: salt must change hashes", testName)
+	}
+}
+
+func TestRedactPolicy_NamedArgs(t *testing.T) {
+	testName := "TestRedactPolicy_NamedArgs"
+	policy := &promsql.RedactPolicy{Rules: []promsql.RedactRule{{Names: []string{"pwd"}}}}
+	result := policy.Redact("UPDATE users SET password=:pwd WHERE id=:id", []interface{}{sql.Named("pwd", "secret"), sql.Named("id", 1)})
+	expected := []interface{}{sql.Named("pwd", "***"), sql.Named("id", 1)}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%s failed: expected %#v but received %#v", testName, expected, result)
+	}
+}
+
+func TestSqlConnect_RedactPolicy(t *testing.T) {
+	testName := "TestSqlConnect_RedactPolicy"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "redact.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: error [%s]", testName, err)
+	}
+	defer func() { _ = sqlc.Close() }()
+	if sqlc.GetRedactPolicy() != nil {
+		t.Fatalf("%s failed: expected no redact policy by default", testName)
+	}
+	policy := &promsql.RedactPolicy{Rules: []promsql.RedactRule{{QueryPattern: regexp.MustCompile(`(?i)\bpwd\b`), Positions: []int{1}}}}
+	if sqlc.SetRedactPolicy(policy).GetRedactPolicy() != policy {
+		t.Fatalf("%s failed: redact policy mismatched", testName)
+	}
+	db := sqlc.GetDBProxy()
+	if _, err := db.Exec("CREATE TABLE tbl_user (id INT, pwd VARCHAR(32))"); err != nil {
+		t.Fatalf("%s failed: error [%s]", testName, err)
+	}
+	if _, err := db.Exec("INSERT INTO tbl_user (id, pwd) VALUES (?, ?)", 1, "secret"); err != nil {
+		t.Fatalf("%s failed: error [%s]", testName, err)
+	}
+	m, _ := sqlc.Metrics(prom.MetricsCatAll, prom.MetricsOpts{ReturnLatestCommands: 1})
+	params := reflect.ValueOf(m.LastNCmds[0].CmdRequest).MapIndex(reflect.ValueOf("params")).Interface()
+	if !reflect.DeepEqual(params, []interface{}{1, "***"}) {
+		t.Fatalf("%s failed: expected params to be redacted but received %#v", testName, params)
+	}
+	var pwd string
+	if err := db.QueryRow("SELECT pwd FROM tbl_user WHERE id=?", 1).Scan(&pwd); err != nil || pwd != "secret" {
+		t.Fatalf("%s failed: value passed to database must not be redacted, received %#v / %s", testName, pwd, err)
+	}
+}
@@ -0,0 +1,171 @@
+package sql_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/btnguyen2k/prom"
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+type testMySqlError struct{ Number uint16 }
+
+func (e *testMySqlError) Error() string { return fmt.Sprintf("Error %d", e.Number) }
+
+type testPgError struct{ code string }
+
+func (e *testPgError) Error() string    { return "ERROR: " + e.code }
+func (e *testPgError) SQLState() string { return e.code }
+
+type testOraError struct{ code int }
+
+func (e *testOraError) Error() string { return fmt.Sprintf("ORA-%05d: error", e.code) }
+func (e *testOraError) Code() int     { return e.code }
+
+type testSqliteError struct{ code int }
+
+func (e *testSqliteError) Error() string { return "sqlite error" }
+func (e *testSqliteError) Code() int     { return e.code }
+
+func TestIsRetryableError(t *testing.T) {
+	testName := "TestIsRetryableError"
+	testCases := []struct {
+		name     string
+		flavor   promsql.DbFlavor
+		err      error
+		expected bool
+	}{
+		{"nil", promsql.FlavorMySql, nil, false},
+		{"bad_conn", promsql.FlavorPgSql, fmt.Errorf("wrapped: %w", driver.ErrBadConn), true},
+		{"mysql_deadlock", promsql.FlavorMySql, &testMySqlError{1213}, true},
+		{"mysql_lock_wait", promsql.FlavorMySql, &testMySqlError{1205}, true},
+		{"mysql_dup_key", promsql.FlavorMySql, &testMySqlError{1062}, false},
+		{"pgsql_serialization", promsql.FlavorPgSql, &testPgError{"40001"}, true},
+		{"pgsql_deadlock", promsql.FlavorPgSql, fmt.Errorf("wrapped: %w", &testPgError{"40P01"}), true},
+		{"pgsql_unique", promsql.FlavorPgSql, &testPgError{"23505"}, false},
+		{"mssql_deadlock", promsql.FlavorMsSql, &testMySqlError{1205}, true},
+		{"mssql_other", promsql.FlavorMsSql, &testMySqlError{1213}, false},
+		{"oracle_deadlock", promsql.FlavorOracle, &testOraError{60}, true},
+		{"oracle_serialize", promsql.FlavorOracle, &testOraError{8177}, true},
+		{"oracle_message", promsql.FlavorOracle, errors.New("ORA-08177: can't serialize access for this transaction"), true},
+		{"oracle_other", promsql.FlavorOracle, &testOraError{1}, false},
+		{"sqlite_busy", promsql.FlavorSqlite, &testSqliteError{5}, true},
+		{"sqlite_busy_snapshot", promsql.FlavorSqlite, &testSqliteError{517}, true},
+		{"sqlite_constraint", promsql.FlavorSqlite, &testSqliteError{19}, false},
+		{"sqlite_message", promsql.FlavorSqlite, errors.New("database is locked"), true},
+		{"unknown_flavor", promsql.FlavorUnknown, &testPgError{"40001"}, true},
+		{"unknown_mysql_deadlock", promsql.FlavorUnknown, &testMySqlError{1213}, true},
+		{"unknown_oracle_message", promsql.FlavorUnknown, &testOraError{60}, true},
+		{"unknown_sqlite_message", promsql.FlavorUnknown, errors.New("database is locked"), true},
+		{"unknown_mysql_1029", promsql.FlavorUnknown, &testMySqlError{1029}, false},
+		{"unknown_mysql_2053", promsql.FlavorUnknown, &testMySqlError{2053}, false},
+		{"unknown_mssql_517", promsql.FlavorUnknown, &testMySqlError{517}, false},
+		{"unknown_code_60", promsql.FlavorUnknown, &testSqliteError{60}, false},
+		{"unknown_sqlite_busy_code", promsql.FlavorUnknown, &testSqliteError{5}, false},
+		{"dropped_unexpected_eof", promsql.FlavorMsSql, fmt.Errorf("wrapped: %w", io.ErrUnexpectedEOF), true},
+		{"dropped_conn_reset", promsql.FlavorUnknown, &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"dropped_broken_pipe", promsql.FlavorPgSql, os.NewSyscallError("write", syscall.EPIPE), true},
+		{"mysql_invalid_conn", promsql.FlavorMySql, errors.New("invalid connection"), true},
+		{"mysql_gone_away", promsql.FlavorMySql, &testMySqlError{2006}, true},
+		{"pgsql_conn_failure", promsql.FlavorPgSql, &testPgError{"08006"}, true},
+		{"pgsql_unknown_conn_failure", promsql.FlavorUnknown, &testPgError{"08003"}, true},
+		{"oracle_eof_channel", promsql.FlavorOracle, &testOraError{3113}, true},
+		{"other_flavor", promsql.FlavorCosmosDb, &testPgError{"40001"}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if v := promsql.IsRetryableError(tc.flavor, tc.err); v != tc.expected {
+				t.Fatalf("%s failed: expected %v but received %v", testName+"/"+tc.name, tc.expected, v)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	testName := "TestRetryPolicy_Backoff"
+	policy := &promsql.RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Jitter: -1}
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond}
+	for i, e := range expected {
+		if v := policy.Backoff(i + 1); v != e {
+			t.Fatalf("%s failed: attempt %d: expected %s but received %s", testName, i+1, e, v)
+		}
+	}
+	policy = &promsql.RetryPolicy{InitialBackoff: 100 * time.Millisecond, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if v := policy.Backoff(1); v < 50*time.Millisecond || v > 150*time.Millisecond {
+			t.Fatalf("%s failed: expected backoff within [50ms, 150ms] but received %s", testName, v)
+		}
+	}
+}
+
+func TestSqlConnect_RetryPolicy(t *testing.T) {
+	testName := "TestSqlConnect_RetryPolicy"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "retry.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer sqlc.Close()
+	isNoTable := func(err error) bool { return err != nil && strings.Contains(err.Error(), "no such table") }
+	checks := 0
+	policy := &promsql.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, IsRetryable: func(flavor promsql.DbFlavor, err error) bool {
+		if flavor != promsql.FlavorSqlite {
+			t.Fatalf("%s failed: expected flavor %s but received %s", testName, promsql.FlavorSqlite, flavor)
+		}
+		if checks++; checks == 2 {
+			// the table shows up before the third attempt
+			_, _ = sqlc.GetDB().Exec("CREATE TABLE tbl_retry (id INT)")
+		}
+		return isNoTable(err)
+	}}
+	sqlc.SetRetryPolicy(policy)
+	if sqlc.GetRetryPolicy() != policy || sqlc.GetCategoryRetryPolicy(prom.MetricsCatDML) != policy {
+		t.Fatalf("%s failed: expected default retry policy", testName)
+	}
+	if _, err := sqlc.GetDBProxy().Exec("INSERT INTO tbl_retry (id) VALUES (1)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	m, _ := sqlc.Metrics(prom.MetricsCatDML, prom.MetricsOpts{ReturnLatestCommands: 1})
+	cmd := m.LastNCmds[0]
+	attempts, _ := cmd.CmdMeta.(map[string]interface{})["attempts"].([]promsql.RetryAttempt)
+	if cmd.Result != prom.CmdResultOk || len(attempts) != 3 {
+		t.Fatalf("%s failed: expected 3 attempts recorded but received %#v", testName, cmd.CmdMeta)
+	}
+	for i, a := range attempts {
+		if a.Attempt != i+1 || (i < 2 && (!strings.Contains(a.Error, "no such table") || a.Backoff <= 0)) || (i == 2 && (a.Error != "" || a.Backoff != 0)) {
+			t.Fatalf("%s failed: unexpected attempt %#v", testName, a)
+		}
+	}
+
+	// attempts exhausted
+	checks = 0
+	if _, err := sqlc.GetDBProxy().Exec("INSERT INTO tbl_not_found (id) VALUES (1)"); !isNoTable(err) {
+		t.Fatalf("%s failed: expected error but received %v", testName, err)
+	}
+	m, _ = sqlc.Metrics(prom.MetricsCatDML, prom.MetricsOpts{ReturnLatestCommands: 1})
+	if attempts, _ := m.LastNCmds[0].CmdMeta.(map[string]interface{})["attempts"].([]promsql.RetryAttempt); len(attempts) != 3 || m.LastNCmds[0].Result != prom.CmdResultError {
+		t.Fatalf("%s failed: expected 3 failed attempts recorded but received %#v", testName, m.LastNCmds[0])
+	}
+
+	// per-category policy disables retrying
+	checks = 0
+	sqlc.SetCategoryRetryPolicy(prom.MetricsCatDQL, nil)
+	if sqlc.GetCategoryRetryPolicy(prom.MetricsCatDQL) != nil {
+		t.Fatalf("%s failed: expected no retry policy for category %s", testName, prom.MetricsCatDQL)
+	}
+	if _, err := sqlc.GetDBProxy().Query("SELECT * FROM tbl_not_found"); !isNoTable(err) {
+		t.Fatalf("%s failed: expected error but received %v", testName, err)
+	}
+	m, _ = sqlc.Metrics(prom.MetricsCatDQL, prom.MetricsOpts{ReturnLatestCommands: 1})
+	if checks != 0 || m.LastNCmds[0].CmdMeta != nil {
+		t.Fatalf("%s failed: expected no retry but received %#v", testName, m.LastNCmds[0])
+	}
+}
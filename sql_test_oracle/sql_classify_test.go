@@ -0,0 +1,123 @@
+package sql_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/btnguyen2k/prom"
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+func TestClassifyStatement(t *testing.T) {
+	testName := "TestClassifyStatement"
+	testCases := []struct {
+		name, query, keyword, category string
+	}{
+		{"empty", "", "", prom.MetricsCatOther},
+		{"select", "select * from t", "SELECT", prom.MetricsCatDQL},
+		{"leading_spaces", " \n\tSELECT 1", "SELECT", prom.MetricsCatDQL},
+		{"line_comment", "-- fetch all\nSELECT * FROM t", "SELECT", prom.MetricsCatDQL},
+		{"block_comment", "/* hint */ /*+ INDEX(t) */ DELETE FROM t", "DELETE", prom.MetricsCatDML},
+		{"unterminated_comment", "/* SELECT", "", prom.MetricsCatOther},
+		{"parens", "((SELECT a FROM t) UNION (SELECT b FROM u))", "SELECT", prom.MetricsCatDQL},
+		{"values", "VALUES (1), (2)", "VALUES", prom.MetricsCatDQL},
+		{"show", "SHOW TABLES", "SHOW", prom.MetricsCatDQL},
+		{"explain", "EXPLAIN SELECT * FROM t", "EXPLAIN", prom.MetricsCatDQL},
+		{"insert", "insert into t values (1)", "INSERT", prom.MetricsCatDML},
+		{"merge", "MERGE INTO t USING s ON (t.id=s.id) WHEN MATCHED THEN UPDATE SET t.v=s.v", "MERGE", prom.MetricsCatDML},
+		{"replace", "REPLACE INTO t (id) VALUES (1)", "REPLACE", prom.MetricsCatDML},
+		{"call", "CALL proc(1)", "CALL", prom.MetricsCatDML},
+		{"truncate", "TRUNCATE TABLE t", "TRUNCATE", prom.MetricsCatDDL},
+		{"create", "create table t (id int)", "CREATE", prom.MetricsCatDDL},
+		{"grant", "GRANT SELECT ON t TO u", "GRANT", prom.MetricsCatDCL},
+		{"revoke", "REVOKE SELECT ON t FROM u", "REVOKE", prom.MetricsCatDCL},
+		{"begin", "BEGIN", "BEGIN", prom.MetricsCatTCL},
+		{"begin_semicolon", "begin ;", "BEGIN", prom.MetricsCatTCL},
+		{"begin_transaction", "BEGIN TRANSACTION", "BEGIN", prom.MetricsCatTCL},
+		{"begin_tran", "BEGIN TRAN t1", "BEGIN", prom.MetricsCatTCL},
+		{"begin_work", "BEGIN WORK", "BEGIN", prom.MetricsCatTCL},
+		{"begin_immediate", "BEGIN IMMEDIATE TRANSACTION", "BEGIN", prom.MetricsCatTCL},
+		{"begin_block", "BEGIN UPDATE t SET v=1; COMMIT; END;", "BEGIN", prom.MetricsCatOther},
+		{"begin_block_null", "BEGIN NULL; END;", "BEGIN", prom.MetricsCatOther},
+		{"begin_transactional", "BEGIN transactional_proc(); END;", "BEGIN", prom.MetricsCatOther},
+		{"end", "END", "END", prom.MetricsCatTCL},
+		{"abort", "ABORT", "ABORT", prom.MetricsCatTCL},
+		{"start_transaction", "START TRANSACTION", "START", prom.MetricsCatTCL},
+		{"savepoint", "SAVEPOINT sp1", "SAVEPOINT", prom.MetricsCatTCL},
+		{"commit", "commit;", "COMMIT", prom.MetricsCatTCL},
+		{"with_select", "WITH t AS (SELECT 1) SELECT * FROM t", "SELECT", prom.MetricsCatDQL},
+		{"with_update", "WITH s AS (SELECT id FROM u WHERE note = ')') UPDATE t SET v=1 WHERE id IN (SELECT id FROM s)", "UPDATE", prom.MetricsCatDML},
+		{"with_recursive", "WITH RECURSIVE r(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM r WHERE n<10) INSERT INTO t SELECT n FROM r", "INSERT", prom.MetricsCatDML},
+		{"with_escaped_quote", `WITH s AS (SELECT 'it\'s (' AS v, "a\"(" AS w) DELETE FROM t`, "DELETE", prom.MetricsCatDML},
+		{"with_doubled_quote", "WITH s AS (SELECT 'it''s (' AS v) DELETE FROM t", "DELETE", prom.MetricsCatDML},
+		{"with_multiple", `WITH "a" AS MATERIALIZED (SELECT 1), b AS (/* ( */ SELECT 2) DELETE FROM t`, "DELETE", prom.MetricsCatDML},
+		{"with_invalid", "WITH t AS SELECT 1", "WITH", prom.MetricsCatOther},
+		{"unknown", "VACUUM", "VACUUM", prom.MetricsCatOther},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			keyword, category := promsql.ClassifyStatement(tc.query, promsql.FlavorUnknown)
+			if keyword != tc.keyword || category != tc.category {
+				t.Fatalf("%s failed: expected (%q, %q) but received (%q, %q)", testName, tc.keyword, tc.category, keyword, category)
+			}
+		})
+	}
+}
+
+func TestClassifyStatement_HashComments(t *testing.T) {
+	testName := "TestClassifyStatement_HashComments"
+	testCases := []struct {
+		name, query       string
+		flavor            promsql.DbFlavor
+		keyword, category string
+	}{
+		{"mysql", "# fetch all\nSELECT * FROM t", promsql.FlavorMySql, "SELECT", prom.MetricsCatDQL},
+		{"mysql_with", "WITH t AS (SELECT 1 # )\n) DELETE FROM u", promsql.FlavorMySql, "DELETE", prom.MetricsCatDML},
+		{"mssql", "# fetch all\nSELECT * FROM t", promsql.FlavorMsSql, "", prom.MetricsCatOther},
+		{"pgsql", "# fetch all\nSELECT * FROM t", promsql.FlavorPgSql, "", prom.MetricsCatOther},
+		{"unknown", "# fetch all\nSELECT * FROM t", promsql.FlavorUnknown, "", prom.MetricsCatOther},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			keyword, category := promsql.ClassifyStatement(tc.query, tc.flavor)
+			if keyword != tc.keyword || category != tc.category {
+				t.Fatalf("%s failed: expected (%q, %q) but received (%q, %q)", testName, tc.keyword, tc.category, keyword, category)
+			}
+		})
+	}
+}
+
+func TestDBProxy_ClassifyCategories(t *testing.T) {
+	testName := "TestDBProxy_ClassifyCategories"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "classify.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer sqlc.Close()
+	dbp := sqlc.GetDBProxy()
+	testCases := []struct {
+		name, query, cmdName, category string
+		useQuery                       bool
+	}{
+		{"create", "CREATE TABLE tbl_classify (id INT)", "CREATE", prom.MetricsCatDDL, false},
+		{"insert", "/* seed */ INSERT INTO tbl_classify (id) VALUES (1)", "INSERT", prom.MetricsCatDML, false},
+		{"with_update", "WITH s AS (SELECT 1 AS id) UPDATE tbl_classify SET id=2 WHERE id IN (SELECT id FROM s)", "UPDATE", prom.MetricsCatDML, false},
+		{"begin", "BEGIN", "BEGIN", prom.MetricsCatTCL, false},
+		{"commit", "COMMIT", "COMMIT", prom.MetricsCatTCL, false},
+		{"select_exec", "SELECT * FROM tbl_classify", "SELECT", prom.MetricsCatOther, false},
+		{"select_query", "-- all rows\nSELECT * FROM tbl_classify", "SELECT", prom.MetricsCatDQL, true},
+		{"drop", "DROP TABLE tbl_classify", "DROP", prom.MetricsCatDDL, false},
+	}
+	for _, tc := range testCases {
+		if tc.useQuery {
+			rows, err := dbp.Query(tc.query)
+			if err != nil {
+				t.Fatalf("%s failed: %s", testName+"/"+tc.name, err)
+			}
+			_ = rows.Close()
+		} else if _, err := dbp.Exec(tc.query); err != nil {
+			t.Fatalf("%s failed: %s", testName+"/"+tc.name, err)
+		}
+		_sqlcVerifyLastCommand(func(msg string) { t.Fatalf(msg) }, testName+"/"+tc.name, sqlc, tc.cmdName, prom.MetricsCatAll, tc.category)
+	}
+}
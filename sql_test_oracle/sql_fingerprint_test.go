@@ -0,0 +1,164 @@
+package sql_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/btnguyen2k/prom"
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+func TestFingerprint(t *testing.T) {
+	testName := "TestFingerprint"
+	testCases := []struct {
+		name     string
+		queries  []string
+		expected string
+	}{
+		{"whitespaces", []string{"SELECT *  FROM t\n\tWHERE id = 1", " select * from t where id=2 ;"}, "select * from t where id = ?"},
+		{"comments", []string{"/* app */ SELECT a FROM t -- trailing\n WHERE b = 'x'", "SELECT a FROM t WHERE b = 'it''s'"}, "select a from t where b = ?"},
+		{"placeholders", []string{"SELECT a FROM t WHERE b=? AND c=?", "SELECT a FROM t WHERE b=$1 AND c=$2", "SELECT a FROM t WHERE b=:b AND c=:1", "SELECT a FROM t WHERE b=@p1 AND c=@c"}, "select a from t where b = ? and c = ?"},
+		{"numbers", []string{"SELECT a FROM t LIMIT 10 OFFSET 20", "SELECT a FROM t LIMIT 1.5e3 OFFSET 0x1F"}, "select a from t limit ? offset ?"},
+		{"in_list", []string{"DELETE FROM t WHERE id IN (1, 2, 3)", "delete from t where id in (?)", "DELETE FROM t WHERE id IN ($1,$2)"}, "delete from t where id in (?+)"},
+		{"in_subquery", []string{"SELECT a FROM t WHERE id IN (SELECT id FROM u WHERE v = 1)"}, "select a from t where id in (select id from u where v = ?)"},
+		{"values_rows", []string{"INSERT INTO t (a, b) VALUES (1, 'x')", "INSERT INTO t (a, b) VALUES (?, ?), (?, ?), (?, ?)"}, "insert into t (a, b) values (?, ?)"},
+		{"quoted_identifiers", []string{`SELECT "Col" FROM "My Table" WHERE x = N'abc'`}, `select "Col" from "My Table" where x = ?`},
+		{"casts_and_functions", []string{"SELECT COUNT(*), t.a::text FROM t WHERE b >= -1 AND c <> E'x'"}, "select count (*), t.a::text from t where b >= - ? and c <> ?"},
+		{"dollar_quoted", []string{"SELECT $$a 'quoted' string$$, $tag$x$tag$"}, "select ?, ?"},
+		{"system_variables", []string{"SELECT @@VERSION"}, "select @@version"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, query := range tc.queries {
+				if fp := promsql.Fingerprint(query, promsql.FlavorUnknown); fp != tc.expected {
+					t.Fatalf("%s failed: expected fingerprint %q of %q but received %q", testName, tc.expected, query, fp)
+				}
+			}
+		})
+	}
+	if promsql.FingerprintId("select ?") == promsql.FingerprintId("select ?, ?") {
+		t.Fatalf("%s failed: expected different ids for different fingerprints", testName)
+	}
+}
+
+func TestFingerprint_Flavors(t *testing.T) {
+	testName := "TestFingerprint_Flavors"
+	testCases := []struct {
+		name     string
+		flavor   promsql.DbFlavor
+		queries  []string
+		expected string
+	}{
+		{"mysql_hash_comments", promsql.FlavorMySql, []string{"# app\nSELECT a FROM t # trailing\n WHERE b = 'x' #", "SELECT a FROM t WHERE b = 'x'"}, "select a from t where b = ?"},
+		{"mssql_temp_table", promsql.FlavorMsSql, []string{"SELECT * FROM #tmp_orders WHERE id = @p1", "select * from #TMP_ORDERS where id = @p2"}, "select * from #tmp_orders where id = ?"},
+		{"mssql_global_temp_table", promsql.FlavorMsSql, []string{"SELECT * FROM ##tmp_users WHERE name = @p1"}, "select * from ##tmp_users where name = ?"},
+		{"pgsql_json_path", promsql.FlavorPgSql, []string{"SELECT data #>> '{a,b}' FROM t WHERE id = $1", "SELECT data#>>'{x}' FROM t WHERE id = $2"}, "select data #>> ? from t where id = ?"},
+		{"pgsql_json_ops", promsql.FlavorPgSql, []string{"SELECT data #> '{a}', data #- '{b}', 5 # 3 FROM t"}, "select data #> ?, data #- ?, ? # ? from t"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, query := range tc.queries {
+				if fp := promsql.Fingerprint(query, tc.flavor); fp != tc.expected {
+					t.Fatalf("%s failed: expected fingerprint %q of %q but received %q", testName, tc.expected, query, fp)
+				}
+			}
+		})
+	}
+	if promsql.Fingerprint("SELECT * FROM #tmp_orders WHERE id = @p1", promsql.FlavorMsSql) == promsql.Fingerprint("SELECT * FROM #tmp_users WHERE name = @p1", promsql.FlavorMsSql) {
+		t.Fatalf("%s failed: expected different fingerprints for different temp tables", testName)
+	}
+	if promsql.Fingerprint("SELECT data #>> '{a,b}' FROM t WHERE id = $1", promsql.FlavorPgSql) == promsql.Fingerprint("SELECT data #>> '{x}' FROM other WHERE k = $1", promsql.FlavorPgSql) {
+		t.Fatalf("%s failed: expected different fingerprints for different queries", testName)
+	}
+}
+
+func TestSqlConnect_TopFingerprints(t *testing.T) {
+	testName := "TestSqlConnect_TopFingerprints"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "fingerprint.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer sqlc.Close()
+	if sqlc.GetFingerprintOpts() != nil || sqlc.TopFingerprints(promsql.FingerprintByTotalCost, 0) != nil {
+		t.Fatalf("%s failed: expected fingerprint tracking disabled by default", testName)
+	}
+	sqlc.SetFingerprintOpts(&promsql.FingerprintOpts{MaxFingerprints: 4})
+	if opts := sqlc.GetFingerprintOpts(); opts == nil || opts.MaxFingerprints != 4 {
+		t.Fatalf("%s failed: unexpected fingerprint options %#v", testName, opts)
+	}
+	dbp := sqlc.GetDBProxy()
+	if _, err := dbp.Exec("CREATE TABLE tbl_fp (id INT, v VARCHAR(16))"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := dbp.Exec("INSERT INTO tbl_fp (id, v) VALUES (?, 'v')", i); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+	}
+	tx, _ := dbp.BeginProxy()
+	_, _ = tx.Exec("INSERT INTO tbl_fp (id, v) VALUES (10, 'tx')")
+	_ = tx.Commit()
+	for i := 0; i < 2; i++ {
+		if rows, err := dbp.Query("/* list */ SELECT * FROM tbl_fp WHERE id IN (1, 2, 3) AND v <> 'secret'"); err == nil {
+			_ = rows.Close()
+		}
+		_, _ = dbp.Exec("SELECT * FROM tbl_not_found")
+	}
+
+	insertFp := "insert into tbl_fp (id, v) values (?, ?)"
+	top := sqlc.TopFingerprints(promsql.FingerprintByTotalCost, 0)
+	if len(top) != 4 {
+		t.Fatalf("%s failed: expected 4 fingerprints but received %d", testName, len(top))
+	}
+	var insertStats *promsql.FingerprintStats
+	for i := range top {
+		if i > 0 && top[i].TotalCost > top[i-1].TotalCost {
+			t.Fatalf("%s failed: fingerprints not sorted by total cost", testName)
+		}
+		if top[i].Fingerprint == insertFp {
+			insertStats = &top[i]
+		}
+	}
+	if insertStats == nil || insertStats.NumCmds != 6 || insertStats.NumErrors != 0 || insertStats.Category != prom.MetricsCatDML ||
+		insertStats.Example != "INSERT INTO tbl_fp (id, v) VALUES (?, ?)" || insertStats.Id != promsql.FingerprintId(insertFp) {
+		t.Fatalf("%s failed: unexpected statistics %#v", testName, insertStats)
+	}
+	if insertStats.MeanCost != insertStats.TotalCost/6 || insertStats.P99Cost < 0 || insertStats.LastSeen.IsZero() {
+		t.Fatalf("%s failed: unexpected costs %#v", testName, insertStats)
+	}
+	m, err := sqlc.Metrics(promsql.MetricsCatFingerprintPrefix+insertStats.Id, prom.MetricsOpts{ReturnLatestCommands: 1})
+	if err != nil || m.TotalNumCmds != 6 || m.LastNCmds[0].CmdName != "INSERT" {
+		t.Fatalf("%s failed: expected commands logged under fingerprint category but received %#v / %s", testName, m, err)
+	}
+
+	for _, stats := range top {
+		if stats.Category == prom.MetricsCatDQL && stats.Example != "SELECT * FROM tbl_fp WHERE id IN (?, ?, ?) AND v <> ?" {
+			t.Fatalf("%s failed: expected literals and comments of example to be redacted %#v", testName, stats)
+		}
+	}
+
+	top = sqlc.TopFingerprints(promsql.FingerprintByErrors, 1)
+	if len(top) != 1 || top[0].Fingerprint != "select * from tbl_not_found" || top[0].NumErrors != 2 {
+		t.Fatalf("%s failed: unexpected top fingerprint by errors %#v", testName, top)
+	}
+	if top = sqlc.TopFingerprints(promsql.FingerprintByP99Cost, 2); len(top) != 2 || top[0].P99Cost < top[1].P99Cost {
+		t.Fatalf("%s failed: fingerprints not sorted by p99 cost %#v", testName, top)
+	}
+
+	// max fingerprints reached: new fingerprints are not tracked
+	_, _ = dbp.Exec("DELETE FROM tbl_fp")
+	for _, stats := range sqlc.TopFingerprints(promsql.FingerprintByTotalCost, 0) {
+		if stats.Fingerprint == "delete from tbl_fp" {
+			t.Fatalf("%s failed: expected fingerprint not tracked once max fingerprints reached", testName)
+		}
+	}
+
+	sqlc.ResetFingerprints()
+	if top = sqlc.TopFingerprints(promsql.FingerprintByTotalCost, 0); len(top) != 0 {
+		t.Fatalf("%s failed: expected no fingerprint after reset but received %d", testName, len(top))
+	}
+	sqlc.SetFingerprintOpts(nil)
+	if sqlc.TopFingerprints(promsql.FingerprintByTotalCost, 0) != nil {
+		t.Fatalf("%s failed: expected fingerprint tracking disabled", testName)
+	}
+}
@@ -0,0 +1,70 @@
+package sql_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/btnguyen2k/prom"
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+func TestSqlConnect_ContextLabels(t *testing.T) {
+	testName := "TestSqlConnect_ContextLabels"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "labels.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer sqlc.Close()
+	logger := prom.NewLabelMetricsLogger(prom.NewMemoryStoreMetricsLogger(100), prom.LabelMetricsLoggerOpts{Labels: []string{"tenant"}})
+	sqlc.RegisterMetricsLogger(logger)
+	dbp := sqlc.GetDBProxy()
+	ctx := prom.WithLabels(context.Background(), map[string]string{"tenant": "acme", "trace_id": "t-1"})
+
+	verifyLabels := func(name, category string) {
+		m, _ := sqlc.Metrics(category, prom.MetricsOpts{ReturnLatestCommands: 1})
+		if m == nil || len(m.LastNCmds) == 0 {
+			t.Fatalf("%s failed: no command logged under category %s", testName+"/"+name, category)
+		}
+		if labels := m.LastNCmds[0].Labels(); labels["tenant"] != "acme" || labels["trace_id"] != "t-1" {
+			t.Fatalf("%s failed: unexpected labels %#v", testName+"/"+name, labels)
+		}
+	}
+	if err := dbp.PingContext(ctx); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	verifyLabels("ping", prom.MetricsCatOther)
+	if _, err := dbp.ExecContext(ctx, "CREATE TABLE tbl_labels (id INT)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	verifyLabels("exec", prom.MetricsCatDDL)
+	rows, err := dbp.QueryContext(ctx, "SELECT * FROM tbl_labels")
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	_ = rows.Close()
+	verifyLabels("query", prom.MetricsCatDQL)
+
+	sqlc.SetRetryPolicy(&promsql.RetryPolicy{MaxAttempts: 2, InitialBackoff: 1, IsRetryable: func(promsql.DbFlavor, error) bool { return true }})
+	_, _ = dbp.ExecContext(ctx, "INSERT INTO tbl_not_found (id) VALUES (1)")
+	m, _ := sqlc.Metrics(prom.MetricsCatDML, prom.MetricsOpts{ReturnLatestCommands: 1})
+	meta, _ := m.LastNCmds[0].CmdMeta.(map[string]interface{})
+	if meta["attempts"] == nil || m.LastNCmds[0].Labels()["tenant"] != "acme" {
+		t.Fatalf("%s failed: expected both labels and attempts in meta but received %#v", testName, meta)
+	}
+
+	tx, _ := dbp.BeginTxProxy(ctx, nil)
+	if _, err := tx.ExecContext(ctx, "INSERT INTO tbl_labels (id) VALUES (1)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	_ = tx.Commit()
+	if _, err := dbp.Exec("INSERT INTO tbl_labels (id) VALUES (2)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if m, _ := sqlc.Metrics(prom.MetricsCatDML, prom.MetricsOpts{ReturnLatestCommands: 1}); m.LastNCmds[0].Labels() != nil {
+		t.Fatalf("%s failed: expected no labels without labeled context but received %#v", testName, m.LastNCmds[0].CmdMeta)
+	}
+	if m, err := logger.LabelMetrics(prom.MetricsCatDML, "tenant", "acme"); err != nil || m.TotalNumCmds != 2 {
+		t.Fatalf("%s failed: expected 2 DML commands of tenant acme but received %#v / %s", testName, m, err)
+	}
+}
@@ -0,0 +1,120 @@
+package sql_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/btnguyen2k/prom"
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+func _rowsProxyResponse(sqlc *promsql.SqlConnect) map[string]interface{} {
+	// CmdResponse is checked via its JSON form since its map type is not exported
+	var cmd struct {
+		CmdResponse map[string]interface{} `json:"cres"`
+	}
+	js, _ := json.Marshal(_sqlcLastCommand(sqlc, prom.MetricsCatDQL))
+	_ = json.Unmarshal(js, &cmd)
+	return cmd.CmdResponse
+}
+
+func _newRowsProxyTestSqlConnect(t *testing.T, testName string) *promsql.SqlConnect {
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "rows.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if _, err := sqlc.GetDB().Exec("CREATE TABLE tbl_rows (id INT, v VARCHAR(16))"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err := sqlc.GetDB().Exec("INSERT INTO tbl_rows (id, v) VALUES (?, 'value')", i); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+	}
+	return sqlc
+}
+
+func TestRowsProxy_FetchRows(t *testing.T) {
+	testName := "TestRowsProxy_FetchRows"
+	sqlc := _newRowsProxyTestSqlConnect(t, testName)
+	defer sqlc.Close()
+	rows, err := sqlc.GetDBProxy().QueryProxy("SELECT * FROM tbl_rows WHERE id >= ?", 1)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer rows.Close()
+	if m, _ := sqlc.Metrics(prom.MetricsCatDQL); m.TotalNumCmds != 0 {
+		t.Fatalf("%s failed: expected command not logged before rows are fetched", testName)
+	}
+	result, err := sqlc.FetchRows(rows)
+	if err != nil || len(result) != 3 || result[2]["id"] != int64(3) {
+		t.Fatalf("%s failed: unexpected result %#v / %s", testName, result, err)
+	}
+	response := _rowsProxyResponse(sqlc)
+	if response["rowsScanned"] != 3.0 || response["timeToFirstRow"] == nil || response["fetchTime"] == nil {
+		t.Fatalf("%s failed: unexpected response %#v", testName, response)
+	}
+	_sqlcVerifyLastCommand(func(msg string) { t.Fatalf(msg) }, testName, sqlc, "SELECT", prom.MetricsCatAll, prom.MetricsCatDQL)
+	if rows.NumRows() != 3 || rows.TimeToFirstRow() <= 0 || rows.FetchTime() < 0 {
+		t.Fatalf("%s failed: unexpected rows stats %d / %s / %s", testName, rows.NumRows(), rows.TimeToFirstRow(), rows.FetchTime())
+	}
+	_ = rows.Close()
+	if m, _ := sqlc.Metrics(prom.MetricsCatDQL); m.TotalNumCmds != 1 {
+		t.Fatalf("%s failed: expected command logged once but received %d", testName, m.TotalNumCmds)
+	}
+}
+
+func TestRowsProxy_Close(t *testing.T) {
+	testName := "TestRowsProxy_Close"
+	sqlc := _newRowsProxyTestSqlConnect(t, testName)
+	defer sqlc.Close()
+	tx, _ := sqlc.GetDBProxy().BeginProxy()
+	defer tx.Rollback()
+	rows, err := tx.QueryProxy("SELECT * FROM tbl_rows")
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if !rows.Next() {
+		t.Fatalf("%s failed: expected a row", testName)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if response := _rowsProxyResponse(sqlc); response["rowsScanned"] != 1.0 {
+		t.Fatalf("%s failed: unexpected response %#v", testName, response)
+	}
+	_sqlcVerifyLastCommand(func(msg string) { t.Fatalf(msg) }, testName, sqlc, "SELECT", prom.MetricsCatAll, prom.MetricsCatDQL)
+}
+
+func TestRowsProxy_FetchRowsCallback(t *testing.T) {
+	testName := "TestRowsProxy_FetchRowsCallback"
+	sqlc := _newRowsProxyTestSqlConnect(t, testName)
+	defer sqlc.Close()
+	stmt, _ := sqlc.GetDBProxy().PrepareProxy("SELECT * FROM tbl_rows WHERE id <= ?")
+	defer stmt.Close()
+	rows, err := stmt.QueryProxy(2)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	count := 0
+	if err := sqlc.FetchRowsCallback(rows, func(row map[string]interface{}, err error) bool {
+		count++
+		return err == nil
+	}); err != nil || count != 2 {
+		t.Fatalf("%s failed: expected 2 rows but received %d / %s", testName, count, err)
+	}
+	if response := _rowsProxyResponse(sqlc); response["rowsScanned"] != 2.0 {
+		t.Fatalf("%s failed: unexpected response %#v", testName, response)
+	}
+
+	conn, _ := sqlc.GetDBProxy().ConnProxy(context.Background())
+	defer conn.Close()
+	if _, err := conn.QueryContextProxy(context.Background(), "SELECT * FROM tbl_not_found"); err == nil {
+		t.Fatalf("%s failed: expected error querying invalid table", testName)
+	}
+	if cmd := _sqlcLastCommand(sqlc, prom.MetricsCatDQL); cmd.Result != prom.CmdResultError || cmd.Error == nil {
+		t.Fatalf("%s failed: expected failed command logged but received %#v", testName, cmd)
+	}
+}
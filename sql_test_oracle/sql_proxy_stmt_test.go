@@ -0,0 +1,164 @@
+package sql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btnguyen2k/prom"
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+func _sqlcLastCommand(sqlc *promsql.SqlConnect, category string) *prom.CmdExecInfo {
+	m, err := sqlc.Metrics(category, prom.MetricsOpts{ReturnLatestCommands: 1})
+	if err != nil || m == nil || len(m.LastNCmds) == 0 {
+		return nil
+	}
+	return m.LastNCmds[0]
+}
+
+func TestStmtProxy(t *testing.T) {
+	testName := "TestStmtProxy"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "stmt.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer sqlc.Close()
+	dbp := sqlc.GetDBProxy()
+	if _, err := dbp.Exec("CREATE TABLE tbl_stmt (id INT, v VARCHAR(16))"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+
+	insertQuery := "INSERT INTO tbl_stmt (id, v) VALUES (?, ?)"
+	stmt, err := dbp.PrepareProxy(insertQuery)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer stmt.Close()
+	_sqlcVerifyLastCommand(func(msg string) { t.Fatalf(msg) }, testName+"/prepare", sqlc, "prepare", prom.MetricsCatAll, prom.MetricsCatOther)
+	for i := 1; i <= 3; i++ {
+		if _, err := stmt.Exec(i, "value"); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+	}
+	// CmdRequest and CmdResponse are checked via their JSON forms since their map type is not exported
+	var cmd struct {
+		CmdRequest struct {
+			Query  string        `json:"query"`
+			Params []interface{} `json:"params"`
+		} `json:"creq"`
+		CmdResponse map[string]interface{} `json:"cres"`
+	}
+	js, _ := json.Marshal(_sqlcLastCommand(sqlc, prom.MetricsCatDML))
+	_ = json.Unmarshal(js, &cmd)
+	if cmd.CmdRequest.Query != insertQuery || len(cmd.CmdRequest.Params) != 2 || cmd.CmdRequest.Params[0] != 3.0 {
+		t.Fatalf("%s failed: unexpected request %#v", testName, cmd.CmdRequest)
+	}
+	if cmd.CmdResponse["rowsAffected"] != 1.0 {
+		t.Fatalf("%s failed: unexpected response %#v", testName, cmd.CmdResponse)
+	}
+	_sqlcVerifyLastCommand(func(msg string) { t.Fatalf(msg) }, testName+"/exec", sqlc, "INSERT", prom.MetricsCatAll, prom.MetricsCatDML)
+
+	selectStmt, err := dbp.PrepareContextProxy(context.Background(), "SELECT v FROM tbl_stmt WHERE id >= ?")
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer selectStmt.Close()
+	rows, err := selectStmt.Query(2)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if result, err := sqlc.FetchRows(rows); err != nil || len(result) != 2 {
+		t.Fatalf("%s failed: expected 2 rows but received %d / %s", testName, len(result), err)
+	}
+	_sqlcVerifyLastCommand(func(msg string) { t.Fatalf(msg) }, testName+"/query", sqlc, "SELECT", prom.MetricsCatAll, prom.MetricsCatDQL)
+	var v string
+	if err := selectStmt.QueryRow(3).Scan(&v); err != nil || v != "value" {
+		t.Fatalf("%s failed: expected value but received %q / %s", testName, v, err)
+	}
+	_sqlcVerifyLastCommand(func(msg string) { t.Fatalf(msg) }, testName+"/queryRow", sqlc, "SELECT", prom.MetricsCatAll, prom.MetricsCatDQL)
+}
+
+func TestStmtProxy_TxAndConn(t *testing.T) {
+	testName := "TestStmtProxy_TxAndConn"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "stmt.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer sqlc.Close()
+	dbp := sqlc.GetDBProxy()
+	if _, err := dbp.Exec("CREATE TABLE tbl_stmt (id INT)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	dbStmt, _ := dbp.PrepareProxy("INSERT INTO tbl_stmt (id) VALUES (?)")
+	defer dbStmt.Close()
+
+	tx, err := dbp.BeginProxy()
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	txStmt, err := tx.PrepareProxy("DELETE FROM tbl_stmt WHERE id = ?")
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if _, err := tx.StmtProxy(dbStmt).Exec(1); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	_sqlcVerifyLastCommand(func(msg string) { t.Fatalf(msg) }, testName+"/tx.Stmt", sqlc, "INSERT", prom.MetricsCatAll, prom.MetricsCatDML)
+	if _, err := txStmt.Exec(1); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	_sqlcVerifyLastCommand(func(msg string) { t.Fatalf(msg) }, testName+"/tx.Prepare", sqlc, "DELETE", prom.MetricsCatAll, prom.MetricsCatDML)
+	_ = tx.Commit()
+
+	conn, err := dbp.ConnProxy(context.Background())
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer conn.Close()
+	connStmt, err := conn.PrepareContextProxy(context.Background(), "SELECT COUNT(*) FROM tbl_stmt")
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	var count int
+	if err := connStmt.QueryRow().Scan(&count); err != nil || count != 0 {
+		t.Fatalf("%s failed: expected 0 rows but received %d / %s", testName, count, err)
+	}
+	_sqlcVerifyLastCommand(func(msg string) { t.Fatalf(msg) }, testName+"/conn.Prepare", sqlc, "SELECT", prom.MetricsCatAll, prom.MetricsCatDQL)
+	_ = connStmt.Close()
+}
+
+func TestStmtProxy_CircuitBreaker(t *testing.T) {
+	testName := "TestStmtProxy_CircuitBreaker"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "stmt.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer sqlc.Close()
+	dbp := sqlc.GetDBProxy()
+	if _, err := dbp.Exec("CREATE TABLE tbl_stmt (id INT)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	dbStmt, _ := dbp.PrepareProxy("INSERT INTO tbl_stmt (id) VALUES (?)")
+	defer dbStmt.Close()
+	tx, _ := dbp.BeginProxy()
+	defer tx.Rollback()
+	txStmt, _ := tx.PrepareProxy("INSERT INTO tbl_stmt (id) VALUES (?)")
+
+	cb := promsql.NewCircuitBreaker(promsql.CircuitBreakerOpts{ConsecutiveFailures: 1, OpenTimeout: time.Minute})
+	done, _ := cb.Allow()
+	done(errors.New("failure"))
+	sqlc.SetCircuitBreaker(cb)
+	if _, err := dbStmt.Exec(1); !errors.Is(err, promsql.ErrCircuitOpen) {
+		t.Fatalf("%s failed: expected circuit open error but received %v", testName, err)
+	}
+	if cmd := _sqlcLastCommand(sqlc, prom.MetricsCatDML); cmd.Result != prom.CmdResultRejected {
+		t.Fatalf("%s failed: expected result %s but received %v", testName, prom.CmdResultRejected, cmd.Result)
+	}
+	if _, err := txStmt.Exec(1); err != nil {
+		t.Fatalf("%s failed: expected transaction statements not guarded by circuit breaker but received %s", testName, err)
+	}
+}
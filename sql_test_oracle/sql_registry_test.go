@@ -0,0 +1,115 @@
+package sql_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btnguyen2k/prom"
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+func TestRegistry_LoadConfigSql(t *testing.T) {
+	testName := "TestRegistry_LoadConfigSql"
+	dsn := filepath.Join(t.TempDir(), "registry.db")
+	config := `{"connections": [{
+		"name": "main", "type": "sql",
+		"pool": {"max_size": 4, "min_size": 2, "idle_timeout": 60000000000},
+		"config": {"driver": "sqlite", "dsn": "` + filepath.ToSlash(dsn) + `", "timeout_ms": 5000, "flavor": "sqlite", "timezone": "Asia/Ho_Chi_Minh"}
+	}]}`
+	r := prom.NewRegistry()
+	if err := r.LoadConfig([]byte(config), nil); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer r.Close()
+	sqlc := promsql.GetFromRegistry(r, "main")
+	if sqlc == nil {
+		t.Fatalf("%s failed: cannot get SqlConnect <main>", testName)
+	}
+	if sqlc.GetDbFlavor() != promsql.FlavorSqlite || sqlc.GetTimeoutMs() != 5000 || sqlc.GetLocation().String() != "Asia/Ho_Chi_Minh" {
+		t.Fatalf("%s failed: unexpected settings %s/%d/%s", testName, sqlc.GetDbFlavor(), sqlc.GetTimeoutMs(), sqlc.GetLocation())
+	}
+	if poolOpts := sqlc.PoolOpts(); poolOpts == nil || poolOpts.MaxPoolSize != 4 || poolOpts.IdleTimeout != time.Minute {
+		t.Fatalf("%s failed: unexpected pool options %#v", testName, poolOpts)
+	}
+	if _, err := sqlc.GetDBProxy().Exec("CREATE TABLE tbl_registry (id INT)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	metrics, err := r.Metrics(prom.MetricsCatAll)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if len(metrics["main"]) != 1 || metrics["main"][0].TotalNumCmds != 1 {
+		t.Fatalf("%s failed: unexpected metrics %#v", testName, metrics)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if sqlc.IsConnected() {
+		t.Fatalf("%s failed: expected connection closed", testName)
+	}
+}
+
+func TestRegistry_RegisterSqlConnect(t *testing.T) {
+	testName := "TestRegistry_RegisterSqlConnect"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "registry.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	r := prom.NewRegistry()
+	defer r.Close()
+	if err := promsql.RegisterWithRegistry(r, "main", sqlc); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if promsql.GetFromRegistry(r, "main") != sqlc {
+		t.Fatalf("%s failed: expected the registered SqlConnect", testName)
+	}
+	if promsql.GetFromRegistry(r, "other") != nil {
+		t.Fatalf("%s failed: expected nil for unknown name", testName)
+	}
+	if err := promsql.RegisterWithRegistry(r, "nil", nil); err == nil {
+		t.Fatalf("%s failed: expected error registering nil SqlConnect", testName)
+	}
+}
+
+func TestRegistry_LoadConfigSqlInvalid(t *testing.T) {
+	testName := "TestRegistry_LoadConfigSqlInvalid"
+	for _, config := range []string{
+		`{"connections": [{"name": "main", "type": "sql"}]}`,
+		`{"connections": [{"name": "main", "type": "sql", "config": {"driver": "sqlite"}}]}`,
+		`{"connections": [{"name": "main", "type": "sql", "config": {"driver": "sqlite", "dsn": ":memory:", "timezone": "Invalid/Zone"}}]}`,
+		`{"connections": [{"name": "main", "type": "sql", "config": {"driver": "unknown_driver", "dsn": ":memory:"}}]}`,
+	} {
+		r := prom.NewRegistry()
+		if err := r.LoadConfig([]byte(config), nil); err == nil {
+			t.Fatalf("%s failed: expected error loading %s", testName, config)
+		}
+		if len(r.Names()) != 0 {
+			t.Fatalf("%s failed: expected empty registry", testName)
+		}
+	}
+}
+
+func TestHealthChecker_SqlConnect(t *testing.T) {
+	testName := "TestHealthChecker_SqlConnect"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "health.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	r := prom.NewRegistry()
+	_ = promsql.RegisterWithRegistry(r, "main", sqlc)
+	hc := prom.NewHealthChecker(prom.HealthCheckerOpts{DownAfter: 1})
+	if names := hc.AddRegistry(r); len(names) != 1 {
+		t.Fatalf("%s failed: expected SqlConnect added but received %#v", testName, names)
+	}
+	hc.CheckNow(context.Background())
+	if status, _ := hc.Status("main"); status.State != prom.HealthHealthy {
+		t.Fatalf("%s failed: expected state %s but received %#v", testName, prom.HealthHealthy, status)
+	}
+	_ = r.Close()
+	hc.CheckNow(context.Background())
+	if status, _ := hc.Status("main"); status.State != prom.HealthDown || status.LastError == "" {
+		t.Fatalf("%s failed: expected state %s but received %#v", testName, prom.HealthDown, status)
+	}
+}
@@ -0,0 +1,151 @@
+package sql_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+type scanTestBase struct {
+	Id      int64  `db:"id"`
+	Ignored string `db:"-"`
+}
+
+// ScanTestExtra is exported: pointers to embedded structs of unexported types cannot be allocated.
+type ScanTestExtra struct {
+	Note sql.NullString `db:"note"`
+}
+
+type scanTestUser struct {
+	scanTestBase
+	*ScanTestExtra
+	Name     string   `db:"username"`
+	Age      int32    // matched case-insensitively with column AGE
+	Score    *float64 `db:"score"`
+	Active   bool     `db:"active"`
+	internal string
+}
+
+func _newSqlConnectScan(t *testing.T, testName string) *promsql.SqlConnect {
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "scan.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	for _, query := range []string{
+		"CREATE TABLE tbl_scan (id INT, username VARCHAR(32), AGE INT, score REAL, active INT, note VARCHAR(32), internal VARCHAR(32))",
+		"INSERT INTO tbl_scan VALUES (1, 'alice', 30, 9.5, 1, 'first', 'x')",
+		"INSERT INTO tbl_scan VALUES (2, 'bob', 40, NULL, 0, NULL, 'y')",
+	} {
+		if _, err := sqlc.GetDB().Exec(query); err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+	}
+	return sqlc
+}
+
+func TestFetchRowsInto(t *testing.T) {
+	testName := "TestFetchRowsInto"
+	sqlc := _newSqlConnectScan(t, testName)
+	defer sqlc.Close()
+
+	dbRows, err := sqlc.GetDB().Query("SELECT * FROM tbl_scan ORDER BY id")
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer dbRows.Close()
+	users, err := promsql.FetchRowsInto[scanTestUser](sqlc, dbRows)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("%s failed: expected 2 rows but received %d", testName, len(users))
+	}
+	alice, bob := users[0], users[1]
+	if alice.Id != 1 || alice.Name != "alice" || alice.Age != 30 || alice.Score == nil || *alice.Score != 9.5 || !alice.Active {
+		t.Fatalf("%s failed: unexpected row %#v", testName, alice)
+	}
+	if alice.ScanTestExtra == nil || !alice.Note.Valid || alice.Note.String != "first" || alice.Ignored != "" || alice.internal != "" {
+		t.Fatalf("%s failed: unexpected row %#v", testName, alice)
+	}
+	if bob.Id != 2 || bob.Score != nil || bob.Active || bob.Note.Valid {
+		t.Fatalf("%s failed: unexpected row %#v", testName, bob)
+	}
+
+	rowsProxy, err := sqlc.GetDBProxy().QueryProxy("SELECT id, username FROM tbl_scan WHERE id=?", 2)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer rowsProxy.Close()
+	pointers, err := promsql.FetchRowsInto[*scanTestUser](sqlc, rowsProxy)
+	if err != nil || len(pointers) != 1 || pointers[0].Id != 2 || pointers[0].Name != "bob" {
+		t.Fatalf("%s failed: unexpected result %#v / %s", testName, pointers, err)
+	}
+}
+
+func TestFetchRowsInto_Errors(t *testing.T) {
+	testName := "TestFetchRowsInto_Errors"
+	sqlc := _newSqlConnectScan(t, testName)
+	defer sqlc.Close()
+
+	testCases := []struct {
+		name, query, errMsg string
+		fetch               func(rows *sql.Rows) error
+	}{
+		{name: "not_struct", query: "SELECT id FROM tbl_scan", errMsg: "expecting a struct", fetch: func(rows *sql.Rows) error {
+			_, err := promsql.FetchRowsInto[int](sqlc, rows)
+			return err
+		}},
+		{name: "null_to_non_pointer", query: "SELECT score FROM tbl_scan WHERE id=2", errMsg: "column score (field Score)", fetch: func(rows *sql.Rows) error {
+			_, err := promsql.FetchRowsInto[struct{ Score float64 }](sqlc, rows)
+			return err
+		}},
+		{name: "overflow", query: "SELECT 1000 AS age", errMsg: "column age (field Age): cannot convert int64 to int8", fetch: func(rows *sql.Rows) error {
+			_, err := promsql.FetchRowsInto[struct{ Age int8 }](sqlc, rows)
+			return err
+		}},
+		{name: "incompatible", query: "SELECT username FROM tbl_scan", errMsg: "column username (field Username)", fetch: func(rows *sql.Rows) error {
+			_, err := promsql.FetchRowsInto[struct{ Username int }](sqlc, rows)
+			return err
+		}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dbRows, err := sqlc.GetDB().Query(testCase.query)
+			if err != nil {
+				t.Fatalf("%s failed: %s", testName+"/"+testCase.name, err)
+			}
+			defer dbRows.Close()
+			if err := testCase.fetch(dbRows); err == nil || !strings.Contains(err.Error(), testCase.errMsg) {
+				t.Fatalf("%s failed: expected error containing <%s> but received %v", testName+"/"+testCase.name, testCase.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestFetchRowsIntoCallback(t *testing.T) {
+	testName := "TestFetchRowsIntoCallback"
+	sqlc := _newSqlConnectScan(t, testName)
+	defer sqlc.Close()
+
+	dbRows, err := sqlc.GetDB().Query("SELECT * FROM tbl_scan ORDER BY id")
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer dbRows.Close()
+	names := make([]string, 0)
+	if err := promsql.FetchRowsIntoCallback(sqlc, dbRows, func(row scanTestUser, err error) bool {
+		if err != nil {
+			t.Fatalf("%s failed: %s", testName, err)
+		}
+		names = append(names, row.Name)
+		return false
+	}); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if len(names) != 1 || names[0] != "alice" {
+		t.Fatalf("%s failed: expected callback to stop after first row but received %#v", testName, names)
+	}
+}
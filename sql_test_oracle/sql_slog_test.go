@@ -0,0 +1,38 @@
+//go:build go1.21
+
+package sql_test
+
+import (
+	"bytes"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btnguyen2k/prom"
+	promsql "github.com/btnguyen2k/prom/sql"
+)
+
+func TestSqlConnect_SlogMetricsLogger(t *testing.T) {
+	testName := "TestSqlConnect_SlogMetricsLogger"
+	sqlc, err := newSqlConnectSqlite("sqlite", filepath.Join(t.TempDir(), "slog.db"), timezoneSql, 10000, nil)
+	if err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	defer sqlc.Close()
+	buf := &bytes.Buffer{}
+	sqlc.RegisterMetricsLogger(prom.NewSlogMetricsLogger(sqlc.MetricsLogger(), prom.SlogMetricsLoggerOpts{
+		Logger: slog.New(slog.NewTextHandler(buf, nil)),
+	}))
+	sqlc.SetFingerprintOpts(&promsql.FingerprintOpts{})
+	if _, err := sqlc.GetDBProxy().Exec("CREATE TABLE tbl_slog (id INT)"); err != nil {
+		t.Fatalf("%s failed: %s", testName, err)
+	}
+	if n := strings.Count(buf.String(), `msg="command executed"`); n != 1 {
+		t.Fatalf("%s failed: expected command to be logged once but received %d records\n%s", testName, n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "category=all") || !strings.Contains(buf.String(), "cmd=CREATE") {
+		t.Fatalf("%s failed: unexpected output\n%s", testName, buf.String())
+	}
+	_sqlcVerifyNumCmds(t, testName, sqlc, map[string]int64{prom.MetricsCatAll: 1, prom.MetricsCatDDL: 1})
+}